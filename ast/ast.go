@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"sort"
 	"strings"
 
 	"github.com/darwin1224/saphire/token"
@@ -43,10 +44,14 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// LetStatement binds Value to Name, or destructures it into Pattern when
+// the binding is an array or hash pattern. The names bound by a `const`
+// declaration, whose Token is CONST, cannot be reassigned.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -56,7 +61,11 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -68,12 +77,16 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Identifier is a name. Local is the location of the local variable it
+// refers to once the program is resolved, and nil for globals.
 type Identifier struct {
 	Token token.Token
 	Value string
+	Local *Location
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) patternNode()         {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string       { return i.Value }
 
@@ -198,9 +211,12 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// BlockStatement is a list of statements. Scope is the slot layout of the
+// block once the program is resolved, when the block is a local scope.
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Scope      *Scope
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -215,9 +231,14 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// FunctionLiteral is an `fn(params) { body }` literal, a lambda
+// `|params| expr` when Token is a PIPE, or a class method when Token is the
+// method's name. Name is set for functions declared
+// with a FunctionStatement.
 type FunctionLiteral struct {
 	Token      token.Token
-	Parameters []*Identifier
+	Name       string
+	Parameters []*Parameter
 	Body       *BlockStatement
 }
 
@@ -231,7 +252,24 @@ func (fl *FunctionLiteral) String() string {
 		params = append(params, p.String())
 	}
 
-	out.WriteString(fl.TokenLiteral())
+	if fl.Token.Type == token.PIPE {
+		out.WriteString("|")
+		out.WriteString(strings.Join(params, ", "))
+		out.WriteString("| ")
+		out.WriteString(fl.Body.String())
+
+		return out.String()
+	}
+
+	if fl.Token.Type == token.IDENT {
+		// A method, whose token is its name.
+		out.WriteString(fl.Name)
+	} else {
+		out.WriteString(fl.TokenLiteral())
+		if fl.Name != "" {
+			out.WriteString(" " + fl.Name)
+		}
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -240,6 +278,177 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// FunctionStatement declares a named function, `fn name(params) { body }`.
+type FunctionStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string       { return fs.Function.String() }
+
+// Parameter is a function parameter. Default is nil for required
+// parameters, and a Variadic parameter collects the remaining positional
+// arguments into an array. A parameter destructuring its argument has a
+// Pattern instead of a Name.
+type Parameter struct {
+	Token    token.Token
+	Name     *Identifier
+	Pattern  Pattern
+	Default  Expression
+	Variadic bool
+}
+
+func (p *Parameter) TokenLiteral() string { return p.Token.Literal }
+func (p *Parameter) String() string {
+	var target Node = p.Name
+	if p.Pattern != nil {
+		target = p.Pattern
+	}
+
+	switch {
+	case p.Variadic:
+		return "..." + target.String()
+	case p.Default != nil:
+		return target.String() + " = " + p.Default.String()
+	default:
+		return target.String()
+	}
+}
+
+// Pattern is the target of a destructuring binding or a match arm: an
+// Identifier, an ArrayPattern, a HashPattern, or one of the patterns that
+// only test the value, LiteralPattern, RangePattern and WildcardPattern.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// PatternElement is an element of an array or hash pattern. Default is
+// used when the destructured value has no such element.
+type PatternElement struct {
+	Pattern Pattern
+	Default Expression
+}
+
+func (pe *PatternElement) TokenLiteral() string { return pe.Pattern.TokenLiteral() }
+func (pe *PatternElement) String() string {
+	if pe.Default != nil {
+		return pe.Pattern.String() + " = " + pe.Default.String()
+	}
+	return pe.Pattern.String()
+}
+
+// ArrayPattern destructures an array by position, `[a, b = 0, ...rest]`.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []*PatternElement
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := make([]string, 0)
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPattern destructures a hash by key, `{name, age: years, ...rest}`.
+type HashPattern struct {
+	Token token.Token
+	Pairs []*HashPatternPair
+	Rest  *Identifier
+}
+
+// HashPatternPair binds the value under Key. The shorthand `{name}` binds
+// the key to an identifier of the same name.
+type HashPatternPair struct {
+	Token token.Token
+	Key   string
+	Value *PatternElement
+}
+
+func (hp *HashPatternPair) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPatternPair) String() string {
+	key := hp.Key
+	if hp.Token.Type == token.STRING {
+		key = `"` + key + `"`
+	}
+
+	if ident, ok := hp.Value.Pattern.(*Identifier); ok && ident.Value == key {
+		return hp.Value.String()
+	}
+	return key + ": " + hp.Value.String()
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	pairs := make([]string, 0)
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.String())
+	}
+	if hp.Rest != nil {
+		pairs = append(pairs, "..."+hp.Rest.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// VariantPattern matches a value of an enum variant, `Circle(r)` or
+// `Shape.Circle(r)`, destructuring its fields in order. Without
+// parentheses, as in `Shape.Empty`, it matches the variant whatever its
+// fields hold.
+type VariantPattern struct {
+	Token     token.Token
+	Enum      *Identifier
+	Name      *Identifier
+	Arguments []Pattern
+}
+
+func (vp *VariantPattern) patternNode()         {}
+func (vp *VariantPattern) TokenLiteral() string { return vp.Token.Literal }
+func (vp *VariantPattern) String() string {
+	var out bytes.Buffer
+
+	if vp.Enum != nil {
+		out.WriteString(vp.Enum.String() + ".")
+	}
+	out.WriteString(vp.Name.String())
+
+	if vp.Arguments != nil {
+		args := make([]string, 0)
+		for _, arg := range vp.Arguments {
+			args = append(args, arg.String())
+		}
+
+		out.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -264,6 +473,29 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// SpreadExpression expands an array into the surrounding argument list or
+// array literal, as in `f(...args)`.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
+// NamedArgument passes a call argument by parameter name, as in
+// `f(eps: 0.001)`.
+type NamedArgument struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) String() string       { return na.Name.String() + ": " + na.Value.String() }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -315,9 +547,26 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// MemberExpression accesses a member by name, `person.name`. Members are
+// hash keys, module exports and methods of the object's type.
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Property.String() + ")"
+}
+
+// HashLiteral is a hash literal, `{"name": "Ada", 1: true}`. Keys lists
+// the keys of Pairs in source order.
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -326,8 +575,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := make([]string, 0)
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -336,3 +585,368 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// OrderedKeys returns the keys of Pairs in source order. Keys of literals
+// built without Keys are sorted by their String instead.
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	return keys
+}
+
+// WildcardPattern, `_`, matches any value without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// LiteralPattern matches values equal to a number, string or boolean
+// literal. Negative numbers are a UnaryExpression.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string {
+	if lp.Token.Type == token.STRING {
+		return `"` + lp.Value.String() + `"`
+	}
+	return literalString(lp.Value)
+}
+
+// RangePattern matches numbers from Low up to High, `1..10`, or up to and
+// including High when Inclusive, `1..=10`.
+type RangePattern struct {
+	Token     token.Token
+	Low       Expression
+	High      Expression
+	Inclusive bool
+}
+
+func (rp *RangePattern) patternNode()         {}
+func (rp *RangePattern) TokenLiteral() string { return rp.Token.Literal }
+func (rp *RangePattern) String() string {
+	if rp.Inclusive {
+		return literalString(rp.Low) + "..=" + literalString(rp.High)
+	}
+	return literalString(rp.Low) + ".." + literalString(rp.High)
+}
+
+// literalString renders a pattern literal, writing negative numbers
+// without the parentheses of UnaryExpression.String.
+func literalString(exp Expression) string {
+	if unary, ok := exp.(*UnaryExpression); ok {
+		return unary.Operator + unary.Right.String()
+	}
+	return exp.String()
+}
+
+// MatchExpression evaluates the body of the first arm whose pattern matches
+// Subject, `match (x) { 0 => "zero", n if n > 0 => "positive", _ => "negative" }`.
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm is a single `pattern if guard => body` arm. Guard is nil for
+// arms without a guard.
+type MatchArm struct {
+	Token   token.Token
+	Pattern Pattern
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := make([]string, 0)
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// ThrowExpression raises Value as an error, `throw "bad record"`.
+type ThrowExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (te *ThrowExpression) expressionNode()      {}
+func (te *ThrowExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *ThrowExpression) String() string       { return "throw " + te.Value.String() }
+
+// TryExpression evaluates Block and, when it fails, Catch with the error
+// bound to Param. Finally runs last in either case. Catch or Finally may be
+// nil, but not both, and Param is nil for a catch block without one.
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   Pattern
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// ImportStatement loads a module. Alias binds the whole module,
+// `import "lib/geometry.sp" as geo`, while Names binds selected exports,
+// `import { area, pi as PI } from "lib/geometry.sp"`.
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+	Alias *Identifier
+	Names []*ImportName
+}
+
+// ImportName is a single export bound by a selective import, under Alias
+// when one is given.
+type ImportName struct {
+	Name  *Identifier
+	Alias *Identifier
+}
+
+func (in *ImportName) TokenLiteral() string { return in.Name.TokenLiteral() }
+func (in *ImportName) String() string {
+	if in.Alias != nil {
+		return in.Name.String() + " as " + in.Alias.String()
+	}
+	return in.Name.String()
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+
+	if is.Names != nil {
+		names := make([]string, 0)
+		for _, name := range is.Names {
+			names = append(names, name.String())
+		}
+
+		out.WriteString("{ " + strings.Join(names, ", ") + " } from ")
+	}
+
+	out.WriteString(`"` + is.Path.Value + `"`)
+
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// ExportStatement exports the names bound by a let, fn, struct, enum or
+// class declaration from the module it appears in.
+type ExportStatement struct {
+	Token     token.Token
+	Statement Statement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string       { return es.TokenLiteral() + " " + es.Statement.String() }
+
+// StructStatement declares a struct type, `struct Point { x, y }`, binding
+// its constructor to Name.
+type StructStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	fields := make([]string, 0)
+	for _, field := range ss.Fields {
+		fields = append(fields, field.String())
+	}
+
+	return ss.TokenLiteral() + " " + ss.Name.String() + " " + braced(fields)
+}
+
+// WithExpression copies a struct with some of its fields replaced,
+// `p with { x: 3 }`.
+type WithExpression struct {
+	Token  token.Token
+	Left   Expression
+	Fields []*FieldValue
+}
+
+// FieldValue is a field set by a with expression.
+type FieldValue struct {
+	Name  *Identifier
+	Value Expression
+}
+
+func (fv *FieldValue) TokenLiteral() string { return fv.Name.TokenLiteral() }
+func (fv *FieldValue) String() string       { return fv.Name.String() + ": " + fv.Value.String() }
+
+func (we *WithExpression) expressionNode()      {}
+func (we *WithExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WithExpression) String() string {
+	fields := make([]string, 0)
+	for _, field := range we.Fields {
+		fields = append(fields, field.String())
+	}
+
+	return "(" + we.Left.String() + " with " + braced(fields) + ")"
+}
+
+// EnumStatement declares an enum, `enum Shape { Circle(r), Rect(w, h) }`,
+// binding the enum and each of its variants.
+type EnumStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+// EnumVariant is a variant of an enum. Variants without Fields are values
+// rather than constructors.
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Name.TokenLiteral() }
+func (ev *EnumVariant) String() string {
+	if ev.Fields == nil {
+		return ev.Name.String()
+	}
+
+	fields := make([]string, 0)
+	for _, field := range ev.Fields {
+		fields = append(fields, field.String())
+	}
+
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	variants := make([]string, 0)
+	for _, variant := range es.Variants {
+		variants = append(variants, variant.String())
+	}
+
+	return es.TokenLiteral() + " " + es.Name.String() + " " + braced(variants)
+}
+
+// AssignExpression stores Value in a variable, `x = 1`, an element,
+// `xs[0] = 1`, or a field, `self.balance = 0`.
+type AssignExpression struct {
+	Token  token.Token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Target.String() + " = " + ae.Value.String() + ")"
+}
+
+// ClassStatement declares a class, `class Savings extends Account { ... }`,
+// binding its constructor to Name. Superclass is nil for classes that do
+// not extend another.
+type ClassStatement struct {
+	Token      token.Token
+	Name       *Identifier
+	Superclass Expression
+	Methods    []*FunctionLiteral
+}
+
+func (cs *ClassStatement) statementNode()       {}
+func (cs *ClassStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ClassStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " " + cs.Name.String() + " ")
+	if cs.Superclass != nil {
+		out.WriteString("extends " + cs.Superclass.String() + " ")
+	}
+
+	methods := make([]string, 0)
+	for _, method := range cs.Methods {
+		methods = append(methods, method.String())
+	}
+	out.WriteString(braced(methods))
+
+	return out.String()
+}
+
+// braced renders items as a brace-delimited, comma-separated list.
+func braced(items []string) string {
+	if len(items) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
@@ -0,0 +1,279 @@
+package ast
+
+import "fmt"
+
+// Rewrite traverses the tree rooted at node in depth-first order, like
+// Walk, and replaces each node with the result of f. The children of a
+// node are rewritten before f is called with the node, so f sees them
+// already replaced. Rewrite returns the replacement of node itself.
+//
+// Returning the node passed to f keeps it. Returning nil removes the node
+// from the list holding it, such as the statements of a block or the
+// arguments of a call, or clears the field holding it otherwise. The
+// replacement must fit where the node was: an Expression for an
+// expression, a Statement for a statement, a Pattern for a pattern, and a
+// node of the same type for the parts of nodes such as parameters and
+// match arms. Rewrite panics otherwise.
+func Rewrite(node Node, f func(Node) Node) Node {
+	r := &rewriter{f: f}
+	return r.node(node)
+}
+
+type rewriter struct {
+	f func(Node) Node
+}
+
+func (r *rewriter) node(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteList(r, n.Statements)
+
+	case *LetStatement:
+		if n.Name != nil {
+			n.Name = rewriteNode(r, n.Name)
+		}
+		if n.Pattern != nil {
+			n.Pattern = rewriteNode(r, n.Pattern)
+		}
+		if n.Value != nil {
+			n.Value = rewriteNode(r, n.Value)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			n.ReturnValue = rewriteNode(r, n.ReturnValue)
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			n.Expression = rewriteNode(r, n.Expression)
+		}
+
+	case *BlockStatement:
+		n.Statements = rewriteList(r, n.Statements)
+
+	case *FunctionStatement:
+		n.Name = rewriteNode(r, n.Name)
+		n.Function = rewriteNode(r, n.Function)
+
+	case *ImportStatement:
+		n.Names = rewriteList(r, n.Names)
+		n.Path = rewriteNode(r, n.Path)
+		if n.Alias != nil {
+			n.Alias = rewriteNode(r, n.Alias)
+		}
+
+	case *ImportName:
+		n.Name = rewriteNode(r, n.Name)
+		if n.Alias != nil {
+			n.Alias = rewriteNode(r, n.Alias)
+		}
+
+	case *ExportStatement:
+		n.Statement = rewriteNode(r, n.Statement)
+
+	case *StructStatement:
+		n.Name = rewriteNode(r, n.Name)
+		n.Fields = rewriteList(r, n.Fields)
+
+	case *EnumStatement:
+		n.Name = rewriteNode(r, n.Name)
+		n.Variants = rewriteList(r, n.Variants)
+
+	case *EnumVariant:
+		n.Name = rewriteNode(r, n.Name)
+		if n.Fields != nil {
+			n.Fields = rewriteList(r, n.Fields)
+		}
+
+	case *ClassStatement:
+		n.Name = rewriteNode(r, n.Name)
+		if n.Superclass != nil {
+			n.Superclass = rewriteNode(r, n.Superclass)
+		}
+		n.Methods = rewriteList(r, n.Methods)
+
+	case *Identifier, *NumberLiteral, *StringLiteral, *Boolean, *WildcardPattern:
+		// Leaves.
+
+	case *UnaryExpression:
+		n.Right = rewriteNode(r, n.Right)
+
+	case *BinaryExpression:
+		n.Left = rewriteNode(r, n.Left)
+		n.Right = rewriteNode(r, n.Right)
+
+	case *IfExpression:
+		n.Condition = rewriteNode(r, n.Condition)
+		n.Consequence = rewriteNode(r, n.Consequence)
+		if n.Alternative != nil {
+			n.Alternative = rewriteNode(r, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		n.Parameters = rewriteList(r, n.Parameters)
+		n.Body = rewriteNode(r, n.Body)
+
+	case *Parameter:
+		if n.Pattern != nil {
+			n.Pattern = rewriteNode(r, n.Pattern)
+		} else {
+			n.Name = rewriteNode(r, n.Name)
+		}
+		if n.Default != nil {
+			n.Default = rewriteNode(r, n.Default)
+		}
+
+	case *CallExpression:
+		n.Function = rewriteNode(r, n.Function)
+		n.Arguments = rewriteList(r, n.Arguments)
+
+	case *SpreadExpression:
+		n.Value = rewriteNode(r, n.Value)
+
+	case *NamedArgument:
+		n.Name = rewriteNode(r, n.Name)
+		n.Value = rewriteNode(r, n.Value)
+
+	case *ArrayLiteral:
+		n.Elements = rewriteList(r, n.Elements)
+
+	case *IndexExpression:
+		n.Left = rewriteNode(r, n.Left)
+		n.Index = rewriteNode(r, n.Index)
+
+	case *MemberExpression:
+		n.Object = rewriteNode(r, n.Object)
+		n.Property = rewriteNode(r, n.Property)
+
+	case *HashLiteral:
+		// A pair is removed when its key or value is.
+		keys := make([]Expression, 0, len(n.Pairs))
+		pairs := make(map[Expression]Expression, len(n.Pairs))
+		for _, key := range n.OrderedKeys() {
+			value := n.Pairs[key]
+			key = rewriteNode(r, key)
+			value = rewriteNode(r, value)
+			if key != nil && value != nil {
+				keys = append(keys, key)
+				pairs[key] = value
+			}
+		}
+		n.Keys, n.Pairs = keys, pairs
+
+	case *MatchExpression:
+		n.Subject = rewriteNode(r, n.Subject)
+		n.Arms = rewriteList(r, n.Arms)
+
+	case *MatchArm:
+		n.Pattern = rewriteNode(r, n.Pattern)
+		if n.Guard != nil {
+			n.Guard = rewriteNode(r, n.Guard)
+		}
+		n.Body = rewriteNode(r, n.Body)
+
+	case *ThrowExpression:
+		n.Value = rewriteNode(r, n.Value)
+
+	case *TryExpression:
+		n.Block = rewriteNode(r, n.Block)
+		if n.Param != nil {
+			n.Param = rewriteNode(r, n.Param)
+		}
+		if n.Catch != nil {
+			n.Catch = rewriteNode(r, n.Catch)
+		}
+		if n.Finally != nil {
+			n.Finally = rewriteNode(r, n.Finally)
+		}
+
+	case *WithExpression:
+		n.Left = rewriteNode(r, n.Left)
+		n.Fields = rewriteList(r, n.Fields)
+
+	case *FieldValue:
+		n.Name = rewriteNode(r, n.Name)
+		n.Value = rewriteNode(r, n.Value)
+
+	case *AssignExpression:
+		n.Target = rewriteNode(r, n.Target)
+		n.Value = rewriteNode(r, n.Value)
+
+	case *ArrayPattern:
+		n.Elements = rewriteList(r, n.Elements)
+		if n.Rest != nil {
+			n.Rest = rewriteNode(r, n.Rest)
+		}
+
+	case *HashPattern:
+		n.Pairs = rewriteList(r, n.Pairs)
+		if n.Rest != nil {
+			n.Rest = rewriteNode(r, n.Rest)
+		}
+
+	case *HashPatternPair:
+		n.Value = rewriteNode(r, n.Value)
+
+	case *PatternElement:
+		n.Pattern = rewriteNode(r, n.Pattern)
+		if n.Default != nil {
+			n.Default = rewriteNode(r, n.Default)
+		}
+
+	case *VariantPattern:
+		if n.Enum != nil {
+			n.Enum = rewriteNode(r, n.Enum)
+		}
+		n.Name = rewriteNode(r, n.Name)
+		if n.Arguments != nil {
+			n.Arguments = rewriteList(r, n.Arguments)
+		}
+
+	case *LiteralPattern:
+		n.Value = rewriteNode(r, n.Value)
+
+	case *RangePattern:
+		n.Low = rewriteNode(r, n.Low)
+		n.High = rewriteNode(r, n.High)
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return r.f(node)
+}
+
+// rewriteNode rewrites n, which must not be nil, and returns its
+// replacement as the type of the field holding it.
+func rewriteNode[T Node](r *rewriter, n T) T {
+	var zero T
+
+	replaced := r.node(n)
+	if replaced == nil {
+		return zero
+	}
+
+	t, ok := replaced.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace %T with %T", n, replaced))
+	}
+	return t
+}
+
+// rewriteList rewrites the nodes of list, dropping those replaced with nil.
+func rewriteList[T Node](r *rewriter, list []T) []T {
+	out := list[:0]
+	for _, n := range list {
+		replaced := r.node(n)
+		if replaced == nil {
+			continue
+		}
+
+		t, ok := replaced.(T)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: cannot replace %T with %T", n, replaced))
+		}
+		out = append(out, t)
+	}
+	return out
+}
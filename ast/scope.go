@@ -0,0 +1,31 @@
+package ast
+
+// Location is where the local variable an identifier refers to lives at
+// runtime: Depth environments out from the one the identifier is evaluated
+// in, in slot Slot. It is set by the resolver package.
+type Location struct {
+	Depth int
+	Slot  int
+}
+
+// Scope is the slot layout of the environments created for one local scope
+// of a program: the name bound in each slot, in slot order. It is set on
+// blocks by the resolver package.
+type Scope struct {
+	Names []string
+	index map[string]int
+}
+
+func NewScope(names []string) *Scope {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	return &Scope{Names: names, index: index}
+}
+
+// Slot returns the slot of name, if the scope has one.
+func (s *Scope) Slot(name string) (int, bool) {
+	i, ok := s.index[name]
+	return i, ok
+}
@@ -0,0 +1,279 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for each node. If the
+// visitor w it returns is not nil, Walk visits each of the children of the
+// node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, visiting
+// the children of each node in source order. It calls v.Visit(node) first;
+// node must not be nil.
+//
+// Besides statements, expressions and patterns, Walk visits the parts of
+// nodes that implement Node: parameters, pattern elements and pairs, match
+// arms, imported names, field values and enum variants.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		} else if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *FunctionStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+
+	case *ImportStatement:
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+		Walk(v, n.Path)
+		if n.Alias != nil {
+			Walk(v, n.Alias)
+		}
+
+	case *ImportName:
+		Walk(v, n.Name)
+		if n.Alias != nil {
+			Walk(v, n.Alias)
+		}
+
+	case *ExportStatement:
+		Walk(v, n.Statement)
+
+	case *StructStatement:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+
+	case *EnumStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+
+	case *EnumVariant:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+
+	case *ClassStatement:
+		Walk(v, n.Name)
+		if n.Superclass != nil {
+			Walk(v, n.Superclass)
+		}
+		for _, method := range n.Methods {
+			Walk(v, method)
+		}
+
+	case *Identifier, *NumberLiteral, *StringLiteral, *Boolean, *WildcardPattern:
+		// Leaves.
+
+	case *UnaryExpression:
+		Walk(v, n.Right)
+
+	case *BinaryExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+
+	case *Parameter:
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		} else {
+			Walk(v, n.Name)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *SpreadExpression:
+		Walk(v, n.Value)
+
+	case *NamedArgument:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *MemberExpression:
+		Walk(v, n.Object)
+		Walk(v, n.Property)
+
+	case *HashLiteral:
+		for _, key := range n.OrderedKeys() {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+
+	case *MatchExpression:
+		Walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+
+	case *MatchArm:
+		Walk(v, n.Pattern)
+		if n.Guard != nil {
+			Walk(v, n.Guard)
+		}
+		Walk(v, n.Body)
+
+	case *ThrowExpression:
+		Walk(v, n.Value)
+
+	case *TryExpression:
+		Walk(v, n.Block)
+		if n.Param != nil {
+			Walk(v, n.Param)
+		}
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+
+	case *WithExpression:
+		Walk(v, n.Left)
+		for _, field := range n.Fields {
+			Walk(v, field)
+		}
+
+	case *FieldValue:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *AssignExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			Walk(v, el)
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			Walk(v, pair)
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *HashPatternPair:
+		Walk(v, n.Value)
+
+	case *PatternElement:
+		Walk(v, n.Pattern)
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *VariantPattern:
+		if n.Enum != nil {
+			Walk(v, n.Enum)
+		}
+		Walk(v, n.Name)
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+
+	case *LiteralPattern:
+		Walk(v, n.Value)
+
+	case *RangePattern:
+		Walk(v, n.Low)
+		Walk(v, n.High)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		Walk(v, exp)
+	}
+}
+
+func walkIdentifiers(v Visitor, idents []*Identifier) {
+	for _, ident := range idents {
+		Walk(v, ident)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order like
+// Walk. It calls f(node) for each node, and visits the children of the
+// node only if f returns true. After the children, f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,215 @@
+package ast_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/parser"
+	"github.com/darwin1224/saphire/token"
+)
+
+// everyNode uses every kind of node.
+const everyNode = `import { area, pi as PI } from "lib/geometry";
+import "lib/other" as other;
+export let x = 1;
+const [a, b = 2, ...rest] = [1, 2, 3];
+let {name, age: years = 0, ...others} = {"name": "n", "age": 3};
+fn add(p, q = 1, ...more) { return p + q; }
+let f = |[y, z]| -y * z;
+struct Point { x, y }
+enum Shape { Circle(r), Empty }
+class Savings extends Account { init(b) { self.b = b } }
+let p = Point(1, 2) with { x: 3 };
+let m = match (x) { 0 => "zero", 1..=9 => "digit", Circle(r) if r > 0 => r, Shape.Empty => 0, _ => throw "bad" };
+try { f(...args, eps: 1e-9) } catch (e) { e } finally { xs[0] = p.x }
+if (true) { 1 } else { 2 }`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func nodeType(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func TestInspectVisitsEveryNodeType(t *testing.T) {
+	program := parse(t, everyNode)
+
+	seen := make(map[string]bool)
+	depth := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		seen[nodeType(node)] = true
+		return true
+	})
+
+	if depth != 0 {
+		t.Errorf("Inspect called f with nil %d times too few", depth)
+	}
+
+	expected := []string{
+		"Program", "ImportStatement", "ImportName", "ExportStatement", "LetStatement",
+		"ReturnStatement", "ExpressionStatement", "BlockStatement", "FunctionStatement",
+		"StructStatement", "EnumStatement", "EnumVariant", "ClassStatement",
+		"Identifier", "NumberLiteral", "StringLiteral", "Boolean", "UnaryExpression",
+		"BinaryExpression", "IfExpression", "FunctionLiteral", "Parameter",
+		"CallExpression", "SpreadExpression", "NamedArgument", "ArrayLiteral",
+		"IndexExpression", "MemberExpression", "HashLiteral", "MatchExpression",
+		"MatchArm", "ThrowExpression", "TryExpression", "WithExpression", "FieldValue",
+		"AssignExpression", "ArrayPattern", "HashPattern", "HashPatternPair",
+		"PatternElement", "VariantPattern", "LiteralPattern", "RangePattern",
+		"WildcardPattern",
+	}
+	for _, typ := range expected {
+		if !seen[typ] {
+			t.Errorf("Inspect did not visit a %s", typ)
+		}
+	}
+	if len(seen) != len(expected) {
+		var got []string
+		for typ := range seen {
+			got = append(got, typ)
+		}
+		sort.Strings(got)
+		t.Errorf("wrong node types visited. got=%v", got)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := parse(t, `let h = {"b": f(1, x), "a": [2, -y]}; h.a[0]`)
+
+	var order []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier, *ast.NumberLiteral, *ast.StringLiteral:
+			order = append(order, node.String())
+		}
+		return true
+	})
+
+	expected := "h b f 1 x a 2 y h a 0"
+	if got := strings.Join(order, " "); got != expected {
+		t.Errorf("wrong order. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, `let f = fn(x) { x + inner }; outer`)
+
+	var names []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, fn := node.(*ast.FunctionLiteral)
+		return !fn
+	})
+
+	if got := strings.Join(names, " "); got != "f outer" {
+		t.Errorf("wrong identifiers. got=%q", got)
+	}
+}
+
+type counter map[string]int
+
+func (c counter) Visit(node ast.Node) ast.Visitor {
+	if node != nil {
+		c[nodeType(node)]++
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	c := counter{}
+	ast.Walk(c, parse(t, `match (v) { [a, ...b] => a, {k} => k, n if n > 0 => n }`))
+
+	if c["MatchArm"] != 3 || c["PatternElement"] != 2 || c["HashPatternPair"] != 1 || c["Identifier"] != 9 {
+		t.Errorf("wrong counts. got=%v", c)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, `let total = add(1, 2); debug(total); {"k": [total, 3]}`)
+
+	result := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Value == "total" {
+				return &ast.Identifier{Token: node.Token, Value: "sum"}
+			}
+		case *ast.NumberLiteral:
+			value := node.Value * 10
+			literal := fmt.Sprint(value)
+			return &ast.NumberLiteral{Token: token.Token{Type: token.NUM, Literal: literal}, Value: value}
+		case *ast.ExpressionStatement:
+			if call, ok := node.Expression.(*ast.CallExpression); ok && call.Function.String() == "debug" {
+				return nil
+			}
+		}
+		return node
+	})
+
+	if result != program {
+		t.Fatalf("Rewrite replaced the program")
+	}
+
+	expected := "let sum = add(10, 20);{k:[sum, 30]}"
+	if got := program.String(); got != expected {
+		t.Errorf("wrong program. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestRewriteReplacesRoot(t *testing.T) {
+	exp := parse(t, `1 + 2`).Statements[0].(*ast.ExpressionStatement).Expression
+
+	result := ast.Rewrite(exp, func(node ast.Node) ast.Node {
+		if be, ok := node.(*ast.BinaryExpression); ok {
+			return be.Right
+		}
+		return node
+	})
+
+	if result.String() != "2" {
+		t.Errorf("wrong result. got=%q", result.String())
+	}
+}
+
+func TestRewritePanicsOnMismatchedNode(t *testing.T) {
+	program := parse(t, `let x = 1;`)
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "cannot replace *ast.NumberLiteral with *ast.BlockStatement") {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	ast.Rewrite(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.NumberLiteral); ok {
+			return &ast.BlockStatement{}
+		}
+		return node
+	})
+}
+
+func TestHashLiteralKeepsSourceOrder(t *testing.T) {
+	program := parse(t, `{"c": 1, "a": 2, "b": 3}`)
+
+	if got := program.String(); got != "{c:1, a:2, b:3}" {
+		t.Errorf("wrong String. got=%q", got)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/darwin1224/saphire"
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/repl"
+)
+
+const (
+	SaphireExt = ".sp"
+)
+
+// Usage:
+//
+//	saphire [flags]                       start the REPL
+//	saphire [flags] [run] file.sp|.spc    run a source or compiled file
+//	saphire compile [-o out.spc] file.sp  compile a source file for the vm
+//	saphire fmt [-w] [-check] files...    format source files
+func main() {
+	warnShadow := flag.Bool("warn-shadow", false, "warn about declarations that shadow an enclosing variable")
+	check := flag.Bool("check", false, "report undefined and unused variables before running")
+	optimize := flag.Bool("optimize", false, "fold constants, remove dead code and inline trivial functions before running")
+	engineName := flag.String("engine", "tree", "backend that runs programs: tree or vm")
+	cacheDir := flag.String("cache", defaultCacheDir(), "directory caching programs compiled by the vm engine (empty disables caching)")
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "compile":
+		compileFile(flag.Args()[1:])
+		return
+	case "fmt":
+		formatFiles(flag.Args()[1:])
+		return
+	case "run":
+		// Flags may also follow the subcommand.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "usage: saphire run [flags] file")
+			os.Exit(2)
+		}
+	}
+
+	engine, err := saphire.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 {
+		startRepl(engine)
+		return
+	}
+
+	filename := flag.Arg(0)
+	if err := checkExt(filename); err != nil {
+		panic(err)
+	}
+
+	opts := []saphire.Option{saphire.WithModulePath(modulePath()...)}
+	if *warnShadow {
+		opts = append(opts, saphire.WithShadowWarnings())
+	}
+	if *check {
+		opts = append(opts, saphire.WithStaticChecks())
+	}
+	if *optimize {
+		opts = append(opts, saphire.WithOptimizations())
+	}
+
+	runtime := saphire.New(opts...)
+	runtime.SetEngine(engine)
+	runtime.SetCacheDir(*cacheDir)
+	if _, err := runtime.RunFile(filename); err != nil {
+		var parseErr *saphire.ParseError
+		if errors.As(err, &parseErr) {
+			printParserErrors(os.Stdout, parseErr.Errors)
+			return
+		}
+
+		fmt.Fprintln(os.Stderr, "error:", err)
+
+		var runtimeErr *saphire.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			for _, line := range runtimeErr.Object.Trace {
+				fmt.Fprintln(os.Stderr, "\t"+line)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+// compileFile implements `saphire compile`, which writes the compiled form
+// of a source file next to it, or to the file given with -o.
+func compileFile(args []string) {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := fs.String("o", "", "output file (default: the source file with the "+compiler.FileExt+" extension)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: saphire compile [-o out"+compiler.FileExt+"] file"+SaphireExt)
+		os.Exit(2)
+	}
+
+	filename := fs.Arg(0)
+	if filepath.Ext(filename) != SaphireExt {
+		fmt.Fprintf(os.Stderr, "error: invalid file extension %s (expected .sp)\n", filepath.Ext(filename))
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(filename, SaphireExt) + compiler.FileExt
+	}
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	bc, err := saphire.Compile(string(source))
+	if err != nil {
+		var parseErr *saphire.ParseError
+		if errors.As(err, &parseErr) {
+			printParserErrors(os.Stdout, parseErr.Errors)
+		} else {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+
+	if err := compiler.WriteFile(*out, bc); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// formatFiles implements `saphire fmt`, which prints source files in the
+// canonical format, rewrites them with -w and lists the files whose
+// format differs with -check.
+func formatFiles(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to the source file instead of printing it")
+	check := fs.Bool("check", false, "list files whose format differs and exit with status 1 if there are any")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: saphire fmt [-w] [-check] file"+SaphireExt+"...")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, filename := range fs.Args() {
+		info, err := os.Stat(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			status = 1
+			continue
+		}
+
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			status = 1
+			continue
+		}
+
+		formatted, err := saphire.Format(string(source))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", filename, err)
+			status = 1
+			continue
+		}
+
+		changed := formatted != string(source)
+		if *check && changed {
+			fmt.Println(filename)
+			status = 1
+		}
+		if *write && changed {
+			if err := os.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				status = 1
+			}
+		}
+		if !*check && !*write {
+			fmt.Print(formatted)
+		}
+	}
+	os.Exit(status)
+}
+
+func startRepl(engine saphire.Engine) {
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Hello %s! This is the Saphire programming language!\n", user.Username)
+	fmt.Printf("Feel free to type in commands\n")
+
+	if engine == saphire.VM {
+		repl.StartVM(os.Stdin, os.Stdout)
+		return
+	}
+	repl.Start(os.Stdin, os.Stdout)
+}
+
+func checkExt(filename string) error {
+	ext := filepath.Ext(filename)
+	if ext != SaphireExt && ext != compiler.FileExt {
+		return fmt.Errorf("error: invalid file extension %s (expected .sp or .spc)", ext)
+	}
+	return nil
+}
+
+// defaultCacheDir returns the directory of the compile cache in the user's
+// cache directory, or "" if there is none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "saphire")
+}
+
+// modulePath returns the directories listed in SAPHIRE_PATH, which are
+// searched for imported modules.
+func modulePath() []string {
+	if env := os.Getenv("SAPHIRE_PATH"); env != "" {
+		return filepath.SplitList(env)
+	}
+	return nil
+}
+
+func printParserErrors(out io.Writer, errors []string) {
+	for _, msg := range errors {
+		io.WriteString(out, " parser errors:\n")
+		io.WriteString(out, "\t"+msg+"\n")
+	}
+}
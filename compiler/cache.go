@@ -0,0 +1,59 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// FileExt is the extension of files holding compiled programs.
+const FileExt = ".spc"
+
+// Cache stores compiled programs in a directory, keyed by the SHA-256 hash
+// of their source and whether they were optimized, so that programs whose
+// source did not change are not parsed and compiled again.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache storing programs in dir, which is created when
+// the first program is stored.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) path(source []byte, optimized bool) string {
+	h := sha256.New()
+	if optimized {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write(source)
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+FileExt)
+}
+
+// Load returns the program compiled from source, optimized or not, if it is
+// cached. Entries that cannot be decoded, like those written with another
+// format version or corrupted, are misses.
+func (c *Cache) Load(source []byte, optimized bool) (*Bytecode, bool) {
+	bc, err := ReadFile(c.path(source, optimized))
+	if err != nil {
+		return nil, false
+	}
+	return bc, true
+}
+
+// Store caches bc as the program compiled from source, optimized or not.
+func (c *Cache) Store(source []byte, optimized bool, bc *Bytecode) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	return WriteFile(c.path(source, optimized), bc)
+}
@@ -0,0 +1,312 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions. Each instruction is
+// an Opcode followed by its operands, big-endian.
+type Instructions []byte
+
+// String disassembles the instructions, one per line.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, operand := range operands {
+			fmt.Fprintf(&out, " %d", operand)
+		}
+		out.WriteString("\n")
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+type Opcode byte
+
+const (
+	// OpConstant pushes a constant.
+	OpConstant Opcode = iota
+	OpTrue
+	OpFalse
+	OpNil
+	OpPop
+	OpDup
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpMinus
+	OpBang
+
+	// OpJump jumps to an absolute offset. OpJumpIfFalse pops the condition
+	// first.
+	OpJump
+	OpJumpIfFalse
+
+	// Globals are looked up by name, the string constant of the operand,
+	// in the environment the program runs in.
+	OpGetGlobal
+	// OpDefineGlobal pops a value and binds it, as `let` does.
+	OpDefineGlobal
+	// OpConstGlobal marks a global bound by `const` as a constant.
+	OpConstGlobal
+	// OpAssignGlobal stores the value on top of the stack in an existing,
+	// non-constant global, leaving the value on the stack.
+	OpAssignGlobal
+	// OpCheckGlobal fails if the global is a constant declared in the
+	// environment, before it is declared again.
+	OpCheckGlobal
+
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpSetFree
+
+	// OpClosure creates a closure of the function constant, capturing the
+	// variables listed in its Free.
+	OpClosure
+	// OpCall calls the function below its operand count of arguments.
+	OpCall
+	// OpCallArgs calls the function below an array of positional
+	// arguments and its first operand count of named arguments, whose
+	// names are the array constant of its second operand.
+	OpCallArgs
+	OpReturnValue
+	// OpReturn ends the program without a value.
+	OpReturn
+
+	// OpArray collects its operand count of values into an array. OpAppend
+	// and OpSpread add one value, or the elements of an array, to the
+	// array below.
+	OpArray
+	OpAppend
+	OpSpread
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpMember
+	OpSetMember
+	// OpCheckWith fails if the value below is not a struct with the
+	// fields named by the array constant. OpWith then copies it with those
+	// fields replaced by the values above it.
+	OpCheckWith
+	OpWith
+
+	// OpStruct, OpEnum and OpClass create types from the descriptions in
+	// their array constants.
+	OpStruct
+	OpEnum
+	OpVariant
+	OpClass
+
+	OpThrow
+	// OpTry runs the try block closure, and the catch and finally closures
+	// above it when its operand flags them, as a try expression.
+	OpTry
+	// OpWrapReturn marks the value returned by a `return` in a try, catch or
+	// finally block as returning from the enclosing function.
+	OpWrapReturn
+	// OpFail raises an error with the message of the string constant.
+	OpFail
+	// OpShadow reports that the declaration at the line and column of its
+	// operands shadows the variable named by its string constant, if shadow
+	// warnings are enabled. When its last operand is set, the variable is
+	// a global that may not exist.
+	OpShadow
+
+	// Patterns test the value on top of the stack. When the value does not
+	// match, they jump to their fail operand, unwinding the stack to the
+	// last OpMark, or raise an error if the operand is NoMatch.
+	OpMark
+	OpUnmark
+	OpMatchEqual
+	OpMatchRange
+	OpMatchArray
+	OpMatchHash
+	OpMatchVariant
+	OpElement
+	OpArrayRest
+	OpHashRest
+	OpField
+	// OpDefault jumps to its second operand unless the value on top of the
+	// stack is missing, which it then pops.
+	OpDefault
+	// OpParamDefault jumps to its second operand if the parameter slot is
+	// already bound.
+	OpParamDefault
+	OpNoMatch
+
+	OpImport
+	OpImportName
+	OpExport
+)
+
+// NoMatch is the fail operand of patterns that raise an error instead of
+// jumping.
+const NoMatch = 0xFFFF
+
+// Definition describes an opcode: its name and the width in bytes of each
+// of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:     {"OpConstant", []int{2}},
+	OpTrue:         {"OpTrue", []int{}},
+	OpFalse:        {"OpFalse", []int{}},
+	OpNil:          {"OpNil", []int{}},
+	OpPop:          {"OpPop", []int{}},
+	OpDup:          {"OpDup", []int{}},
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpJump:         {"OpJump", []int{2}},
+	OpJumpIfFalse:  {"OpJumpIfFalse", []int{2}},
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpDefineGlobal: {"OpDefineGlobal", []int{2}},
+	OpConstGlobal:  {"OpConstGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpCheckGlobal:  {"OpCheckGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpSetLocal:     {"OpSetLocal", []int{2}},
+	OpGetFree:      {"OpGetFree", []int{2}},
+	OpSetFree:      {"OpSetFree", []int{2}},
+	OpClosure:      {"OpClosure", []int{2}},
+	OpCall:         {"OpCall", []int{1}},
+	OpCallArgs:     {"OpCallArgs", []int{1, 2}},
+	OpReturnValue:  {"OpReturnValue", []int{}},
+	OpReturn:       {"OpReturn", []int{}},
+	OpArray:        {"OpArray", []int{2}},
+	OpAppend:       {"OpAppend", []int{}},
+	OpSpread:       {"OpSpread", []int{}},
+	OpHash:         {"OpHash", []int{2}},
+	OpIndex:        {"OpIndex", []int{}},
+	OpSetIndex:     {"OpSetIndex", []int{}},
+	OpMember:       {"OpMember", []int{2}},
+	OpSetMember:    {"OpSetMember", []int{2}},
+	OpCheckWith:    {"OpCheckWith", []int{2}},
+	OpWith:         {"OpWith", []int{2}},
+	OpStruct:       {"OpStruct", []int{2}},
+	OpEnum:         {"OpEnum", []int{2}},
+	OpVariant:      {"OpVariant", []int{2}},
+	OpClass:        {"OpClass", []int{2, 1}},
+	OpThrow:        {"OpThrow", []int{}},
+	OpTry:          {"OpTry", []int{1}},
+	OpWrapReturn:   {"OpWrapReturn", []int{}},
+	OpFail:         {"OpFail", []int{2}},
+	OpShadow:       {"OpShadow", []int{2, 2, 2, 1}},
+	OpMark:         {"OpMark", []int{}},
+	OpUnmark:       {"OpUnmark", []int{}},
+	OpMatchEqual:   {"OpMatchEqual", []int{2, 2}},
+	OpMatchRange:   {"OpMatchRange", []int{2, 2, 1}},
+	OpMatchArray:   {"OpMatchArray", []int{2, 2, 2, 2, 1}},
+	OpMatchHash:    {"OpMatchHash", []int{2, 2}},
+	OpMatchVariant: {"OpMatchVariant", []int{2, 2, 2}},
+	OpElement:      {"OpElement", []int{2}},
+	OpArrayRest:    {"OpArrayRest", []int{2}},
+	OpHashRest:     {"OpHashRest", []int{2}},
+	OpField:        {"OpField", []int{2, 2, 2, 1}},
+	OpDefault:      {"OpDefault", []int{2}},
+	OpParamDefault: {"OpParamDefault", []int{2, 2}},
+	OpNoMatch:      {"OpNoMatch", []int{}},
+	OpImport:       {"OpImport", []int{2}},
+	OpImportName:   {"OpImportName", []int{2}},
+	OpExport:       {"OpExport", []int{2}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += def.OperandWidths[i]
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction of def and returns
+// them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ins[offset])
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
@@ -0,0 +1,882 @@
+// Package compiler lowers Saphire programs to bytecode for the stack-based
+// virtual machine of package vm.
+//
+// Each function is compiled to a Function holding its instructions. Local
+// variables live in slots of the function's frame, the variables a closure
+// captures from enclosing functions are listed in its Free captures, and
+// globals are looked up by name in the environment the program runs in,
+// so that the host, the REPL and modules can share them with the
+// interpreter.
+//
+// As in package resolver, the bodies of functions are compiled at the end
+// of the enclosing function or program, once every variable they can
+// capture is declared. The blocks of a try expression are compiled to
+// functions of their own, so that errors raised in them unwind to the try
+// expression.
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/token"
+)
+
+// Compile compiles program.
+func Compile(program *ast.Program) (bc *Bytecode, err error) {
+	c := &compiler{
+		strings: make(map[string]int),
+		numbers: make(map[uint64]int),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			limit, ok := r.(limitError)
+			if !ok {
+				panic(r)
+			}
+			bc, err = nil, limit
+		}
+	}()
+
+	main := &Function{Name: "<main>"}
+	u := &unit{fn: main, free: make(map[string]*Symbol)}
+	c.unit = u
+	c.scope = &scope{unit: u, store: make(map[string]*Symbol), global: true}
+
+	c.compileProgram(program)
+	c.finish(u)
+
+	for _, obj := range c.constants {
+		if fn, ok := obj.(*Function); ok {
+			fn.Constants = c.constants
+		}
+	}
+	main.Constants = c.constants
+
+	return &Bytecode{Main: main, Constants: c.constants}, nil
+}
+
+// limitError reports a program too large for the operands of the
+// instruction set.
+type limitError string
+
+func (e limitError) Error() string { return "compile error: " + string(e) }
+
+type compiler struct {
+	constants []object.Object
+	strings   map[string]int
+	// numbers is keyed by the bits of each number, so that -0 and 0 are
+	// different constants.
+	numbers map[uint64]int
+
+	unit  *unit
+	scope *scope
+}
+
+// unit is a function being compiled.
+type unit struct {
+	fn      *Function
+	free    map[string]*Symbol
+	pending []*pending
+	// block is set for the blocks of try expressions, and outer is the
+	// unit they appear in.
+	block bool
+	outer *unit
+}
+
+// pending is a function literal whose body is compiled at the end of the
+// enclosing unit, in scope.
+type pending struct {
+	lit   *ast.FunctionLiteral
+	fn    *Function
+	scope *scope
+}
+
+func (u *unit) newSlot(name string) int {
+	u.fn.Locals = append(u.fn.Locals, name)
+	return len(u.fn.Locals) - 1
+}
+
+// capture returns the free variable of u for sym, a variable of an
+// enclosing function.
+func (u *unit) capture(sym *Symbol) *Symbol {
+	if free, ok := u.free[sym.Name]; ok {
+		return free
+	}
+
+	capture := Capture{Name: sym.Name, Index: sym.Index}
+	switch sym.Scope {
+	case LocalScope:
+		capture.Kind = CaptureLocal
+	case FreeScope:
+		capture.Kind = CaptureFree
+	case SelfScope:
+		capture.Kind = CaptureSelf
+	case SuperScope:
+		capture.Kind = CaptureSuper
+	}
+
+	u.fn.Free = append(u.fn.Free, capture)
+	free := &Symbol{Name: sym.Name, Scope: FreeScope, Index: len(u.fn.Free) - 1, Const: sym.Const}
+	u.free[sym.Name] = free
+	return free
+}
+
+func (c *compiler) compileProgram(program *ast.Program) {
+	n := len(program.Statements)
+	for i, stmt := range program.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i == n-1 {
+			c.compileExpression(es.Expression)
+			c.emit(OpReturnValue)
+			return
+		}
+		c.compileStatement(stmt)
+	}
+	c.emit(OpReturn)
+}
+
+// finish compiles the functions deferred to the end of u.
+func (c *compiler) finish(u *unit) {
+	for len(u.pending) > 0 {
+		p := u.pending[0]
+		u.pending = u.pending[1:]
+		c.compileFunctionBody(p)
+	}
+}
+
+func (c *compiler) compileStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		c.compileExpression(stmt.Expression)
+		c.emit(OpPop)
+	case *ast.LetStatement:
+		c.compileLetStatement(stmt)
+	case *ast.ReturnStatement:
+		c.compileExpression(stmt.ReturnValue)
+		if c.unit.block {
+			c.emit(OpWrapReturn)
+		}
+		c.emit(OpReturnValue)
+	case *ast.FunctionStatement:
+		c.checkRedeclare(stmt.Name.Value)
+		c.compileFunction(stmt.Function, stmt.Function.Name)
+		c.store(c.scope.declare(stmt.Name.Value, false))
+	case *ast.ImportStatement:
+		c.compileImportStatement(stmt)
+	case *ast.ExportStatement:
+		c.compileExportStatement(stmt)
+	case *ast.StructStatement:
+		c.compileStructStatement(stmt)
+	case *ast.EnumStatement:
+		c.compileEnumStatement(stmt)
+	case *ast.ClassStatement:
+		c.compileClassStatement(stmt)
+	case *ast.BlockStatement:
+		c.compileScopedBlock(stmt)
+		c.emit(OpPop)
+	}
+}
+
+func (c *compiler) compileLetStatement(ls *ast.LetStatement) {
+	isConst := ls.Token.Type == token.CONST
+
+	var names []string
+	if ls.Pattern != nil {
+		names = patternNames(ls.Pattern, names)
+	} else {
+		names = append(names, ls.Name.Value)
+	}
+	c.checkRedeclare(names...)
+	c.checkShadowing(ls, names)
+
+	if ls.Pattern != nil {
+		c.compileExpression(ls.Value)
+		c.compilePattern(ls.Pattern, nil, isConst)
+	} else {
+		// Functions take the name of the binding they are defined in, so that
+		// Inspect and traces can refer to them.
+		if fl, ok := ls.Value.(*ast.FunctionLiteral); ok && fl.Name == "" {
+			c.compileFunction(fl, ls.Name.Value)
+		} else {
+			c.compileExpression(ls.Value)
+		}
+		c.store(c.scope.declare(ls.Name.Value, isConst))
+	}
+
+	if isConst && c.scope.global {
+		for _, name := range names {
+			c.emit(OpConstGlobal, c.addString(name))
+		}
+	}
+}
+
+// checkRedeclare fails if one of names is a constant declared in the
+// current scope.
+func (c *compiler) checkRedeclare(names ...string) {
+	for _, name := range names {
+		if c.scope.global {
+			c.emit(OpCheckGlobal, c.addString(name))
+			continue
+		}
+
+		if sym, ok := c.scope.declared(name); ok && sym.Const {
+			c.fail("cannot redeclare constant `%s`", name)
+		}
+	}
+}
+
+// checkShadowing reports the names declared by ls in a local scope that
+// shadow a variable of an enclosing scope, or possibly a global.
+func (c *compiler) checkShadowing(ls *ast.LetStatement, names []string) {
+	if c.scope.global {
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := c.scope.declared(name); ok {
+			continue
+		}
+
+		global := 1
+		if c.scope.enclosing(name) {
+			global = 0
+		}
+		c.emit(OpShadow, c.addString(name), min(ls.Token.Line, 0xFFFF), min(ls.Token.Column, 0xFFFF), global)
+	}
+}
+
+// store pops a value into the variable sym.
+func (c *compiler) store(sym *Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(OpDefineGlobal, c.addString(sym.Name))
+	case LocalScope:
+		c.emit(OpSetLocal, sym.Index)
+	default:
+		c.emit(OpSetFree, sym.Index)
+	}
+}
+
+func (c *compiler) load(sym *Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(OpGetGlobal, c.addString(sym.Name))
+	case LocalScope:
+		c.emit(OpGetLocal, sym.Index)
+	default:
+		c.emit(OpGetFree, sym.Index)
+	}
+}
+
+// fail compiles a runtime error, for code the interpreter rejects when it
+// runs rather than when it parses.
+func (c *compiler) fail(format string, a ...interface{}) {
+	c.emit(OpFail, c.addString(fmt.Sprintf(format, a...)))
+}
+
+func (c *compiler) compileExpression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		c.load(c.scope.resolve(node.Value))
+	case *ast.NumberLiteral:
+		c.emit(OpConstant, c.addNumber(node.Value))
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.addString(node.Value))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast.UnaryExpression:
+		c.compileExpression(node.Right)
+		switch node.Operator {
+		case "-":
+			c.emit(OpMinus)
+		default:
+			c.emit(OpBang)
+		}
+	case *ast.BinaryExpression:
+		c.compileExpression(node.Left)
+		c.compileExpression(node.Right)
+		c.emit(binaryOps[node.Operator])
+	case *ast.IfExpression:
+		c.compileIfExpression(node)
+	case *ast.FunctionLiteral:
+		c.compileFunction(node, node.Name)
+	case *ast.CallExpression:
+		c.compileCallExpression(node)
+	case *ast.SpreadExpression:
+		c.fail("spread is only allowed in call arguments and array literals")
+	case *ast.ArrayLiteral:
+		c.compileElements(node.Elements)
+	case *ast.HashLiteral:
+		c.compileHashLiteral(node)
+	case *ast.IndexExpression:
+		c.compileExpression(node.Left)
+		c.compileExpression(node.Index)
+		c.emit(OpIndex)
+	case *ast.MemberExpression:
+		c.compileExpression(node.Object)
+		c.emit(OpMember, c.addString(node.Property.Value))
+	case *ast.WithExpression:
+		c.compileWithExpression(node)
+	case *ast.AssignExpression:
+		c.compileAssignExpression(node)
+	case *ast.MatchExpression:
+		c.compileMatchExpression(node)
+	case *ast.ThrowExpression:
+		c.compileExpression(node.Value)
+		c.emit(OpThrow)
+	case *ast.TryExpression:
+		c.compileTryExpression(node)
+	default:
+		c.fail("cannot compile %T", node)
+	}
+}
+
+var binaryOps = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"**": OpPow,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+	"<=": OpLessEqual,
+	">=": OpGreaterEqual,
+}
+
+// compileBlock compiles the statements of block in the current scope,
+// leaving the value of the last one on the stack.
+func (c *compiler) compileBlock(block *ast.BlockStatement) {
+	n := len(block.Statements)
+	for i, stmt := range block.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i == n-1 {
+			c.compileExpression(es.Expression)
+			return
+		}
+		c.compileStatement(stmt)
+	}
+	c.emit(OpNil)
+}
+
+// compileScopedBlock compiles block in a scope of its own.
+func (c *compiler) compileScopedBlock(block *ast.BlockStatement) {
+	outer := c.scope
+	c.scope = newScope(outer, c.unit)
+	c.compileBlock(block)
+	c.scope = outer
+}
+
+func (c *compiler) compileIfExpression(ie *ast.IfExpression) {
+	c.compileExpression(ie.Condition)
+	jumpIfFalse := c.emit(OpJumpIfFalse, 0)
+
+	c.compileScopedBlock(ie.Consequence)
+	jump := c.emit(OpJump, 0)
+
+	c.patchJump(jumpIfFalse)
+	if ie.Alternative != nil {
+		c.compileScopedBlock(ie.Alternative)
+	} else {
+		c.emit(OpNil)
+	}
+	c.patchJump(jump)
+}
+
+// compileFunction emits the closure of fl, named name, and defers the
+// compilation of its body.
+func (c *compiler) compileFunction(fl *ast.FunctionLiteral, name string) {
+	c.deferFunction(fl, name, c.scope)
+}
+
+func (c *compiler) deferFunction(fl *ast.FunctionLiteral, name string, s *scope) {
+	fn := &Function{Name: name, Body: fl.Body.String()}
+	for _, param := range fl.Parameters {
+		p := Parameter{Source: param.String(), Default: param.Default != nil, Variadic: param.Variadic}
+		if param.Name != nil {
+			p.Name = param.Name.Value
+		}
+		fn.Parameters = append(fn.Parameters, p)
+	}
+
+	c.emit(OpClosure, c.addConstant(fn))
+
+	// Functions in try blocks are compiled at the end of the enclosing
+	// function, like any other.
+	target := c.unit
+	for target.block {
+		target = target.outer
+	}
+	target.pending = append(target.pending, &pending{lit: fl, fn: fn, scope: s})
+}
+
+func (c *compiler) compileFunctionBody(p *pending) {
+	outerUnit, outerScope := c.unit, c.scope
+	defer func() { c.unit, c.scope = outerUnit, outerScope }()
+
+	u := &unit{fn: p.fn, free: make(map[string]*Symbol)}
+	c.unit = u
+	c.scope = newScope(p.scope, u)
+
+	// Parameters take the first slots, in order. Parameters with a pattern
+	// keep their argument in a slot without a name.
+	slots := make([]int, len(p.lit.Parameters))
+	for i, param := range p.lit.Parameters {
+		if param.Name == nil {
+			slots[i] = u.newSlot("")
+			continue
+		}
+
+		slots[i] = u.newSlot(param.Name.Value)
+		c.scope.store[param.Name.Value] = &Symbol{Name: param.Name.Value, Scope: LocalScope, Index: slots[i]}
+	}
+
+	for i, param := range p.lit.Parameters {
+		if param.Default != nil {
+			skip := c.emit(OpParamDefault, slots[i], 0)
+			c.compileExpression(param.Default)
+			c.emit(OpSetLocal, slots[i])
+			c.patchOperand(skip, 1, len(c.unit.fn.Instructions))
+		}
+
+		if param.Pattern != nil {
+			c.emit(OpGetLocal, slots[i])
+			c.compilePattern(param.Pattern, nil, false)
+		}
+	}
+
+	c.compileBlock(p.lit.Body)
+	c.emit(OpReturnValue)
+
+	c.finish(u)
+}
+
+// compileBlockFunction emits the closure of a block of a try expression.
+// The catch block receives the caught error as its argument, destructured
+// by param.
+func (c *compiler) compileBlockFunction(block *ast.BlockStatement, catch bool, param ast.Pattern) {
+	fn := &Function{Name: "<block>", Body: block.String(), Block: true}
+
+	outerUnit, outerScope := c.unit, c.scope
+	u := &unit{fn: fn, free: make(map[string]*Symbol), block: true, outer: outerUnit}
+	c.unit = u
+	c.scope = newScope(outerScope, u)
+
+	if catch {
+		fn.Parameters = []Parameter{{}}
+		slot := u.newSlot("")
+		if param != nil {
+			c.emit(OpGetLocal, slot)
+			c.compilePattern(param, nil, false)
+		}
+	}
+
+	c.compileBlock(block)
+	c.emit(OpReturnValue)
+
+	c.unit, c.scope = outerUnit, outerScope
+	c.emit(OpClosure, c.addConstant(fn))
+}
+
+func (c *compiler) compileTryExpression(te *ast.TryExpression) {
+	c.compileBlockFunction(te.Block, false, nil)
+
+	flags := 0
+	if te.Catch != nil {
+		c.compileBlockFunction(te.Catch, true, te.Param)
+		flags |= TryCatch
+	}
+	if te.Finally != nil {
+		c.compileBlockFunction(te.Finally, false, nil)
+		flags |= TryFinally
+	}
+
+	c.emit(OpTry, flags)
+}
+
+// Flags of OpTry.
+const (
+	TryCatch   = 1
+	TryFinally = 2
+)
+
+func (c *compiler) compileCallExpression(call *ast.CallExpression) {
+	c.compileExpression(call.Function)
+
+	positional := call.Arguments
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.NamedArgument); ok {
+			positional = call.Arguments[:i]
+			break
+		}
+	}
+	named := call.Arguments[len(positional):]
+
+	spread := false
+	for _, arg := range positional {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			spread = true
+		}
+	}
+
+	var pos int
+	if !spread && len(named) == 0 && len(positional) <= 0xFF {
+		for _, arg := range positional {
+			c.compileExpression(arg)
+		}
+		pos = c.emit(OpCall, len(positional))
+	} else {
+		c.compileElements(positional)
+
+		names := make([]object.Object, len(named))
+		for i, arg := range named {
+			arg := arg.(*ast.NamedArgument)
+			c.compileExpression(arg.Value)
+			names[i] = &object.String{Value: arg.Name.Value}
+		}
+		if len(named) > 0xFF {
+			panic(limitError("too many named arguments"))
+		}
+		pos = c.emit(OpCallArgs, len(named), c.addConstant(&object.Array{Elements: names}))
+	}
+
+	name := "<anonymous>"
+	switch fn := call.Function.(type) {
+	case *ast.Identifier:
+		name = fn.Value
+	case *ast.MemberExpression:
+		name = fn.Property.Value
+	}
+	c.unit.fn.Calls = append(c.unit.fn.Calls, CallSite{Offset: pos, Name: name, Line: call.Token.Line})
+}
+
+// compileElements builds an array of the values of exps, expanding spread
+// arrays.
+func (c *compiler) compileElements(exps []ast.Expression) {
+	spread := false
+	for _, e := range exps {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			spread = true
+		}
+	}
+
+	if !spread {
+		for _, e := range exps {
+			c.compileExpression(e)
+		}
+		c.emit(OpArray, len(exps))
+		return
+	}
+
+	c.emit(OpArray, 0)
+	for _, e := range exps {
+		if s, ok := e.(*ast.SpreadExpression); ok {
+			c.compileExpression(s.Value)
+			c.emit(OpSpread)
+			continue
+		}
+		c.compileExpression(e)
+		c.emit(OpAppend)
+	}
+}
+
+func (c *compiler) compileHashLiteral(hl *ast.HashLiteral) {
+	keys := make([]ast.Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	// The pairs are compiled in a stable order, so that the same source
+	// always compiles to the same bytecode.
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	for _, key := range keys {
+		c.compileExpression(key)
+		c.compileExpression(hl.Pairs[key])
+	}
+	c.emit(OpHash, len(keys))
+}
+
+func (c *compiler) compileWithExpression(we *ast.WithExpression) {
+	names := make([]object.Object, len(we.Fields))
+	for i, field := range we.Fields {
+		names[i] = &object.String{Value: field.Name.Value}
+	}
+	fields := c.addConstant(&object.Array{Elements: names})
+
+	c.compileExpression(we.Left)
+	c.emit(OpCheckWith, fields)
+	for _, field := range we.Fields {
+		c.compileExpression(field.Value)
+	}
+	c.emit(OpWith, fields)
+}
+
+func (c *compiler) compileAssignExpression(ae *ast.AssignExpression) {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		c.compileExpression(ae.Value)
+
+		sym := c.scope.resolve(target.Value)
+		switch {
+		case sym.Scope == GlobalScope:
+			c.emit(OpAssignGlobal, c.addString(sym.Name))
+		case sym.Const:
+			c.fail("cannot assign to constant `%s`", sym.Name)
+		case sym.Scope == LocalScope:
+			c.emit(OpDup)
+			c.emit(OpSetLocal, sym.Index)
+		default:
+			c.emit(OpDup)
+			c.emit(OpSetFree, sym.Index)
+		}
+	case *ast.IndexExpression:
+		c.compileExpression(target.Left)
+		c.compileExpression(target.Index)
+		c.compileExpression(ae.Value)
+		c.emit(OpSetIndex)
+	case *ast.MemberExpression:
+		c.compileExpression(target.Object)
+		c.compileExpression(ae.Value)
+		c.emit(OpSetMember, c.addString(target.Property.Value))
+	default:
+		c.fail("invalid assignment target %s", ae.Target)
+	}
+}
+
+// compileMatchExpression keeps the subject in a slot and tries the arms in
+// order. An arm whose pattern does not match or whose guard is falsy jumps
+// to the next one.
+func (c *compiler) compileMatchExpression(me *ast.MatchExpression) {
+	c.compileExpression(me.Subject)
+	subject := c.unit.newSlot("")
+	c.emit(OpSetLocal, subject)
+
+	var ends []int
+	for _, arm := range me.Arms {
+		outer := c.scope
+		c.scope = newScope(outer, c.unit)
+
+		fail := &failTarget{}
+		c.emit(OpMark)
+		c.emit(OpGetLocal, subject)
+		c.compilePattern(arm.Pattern, fail, false)
+		c.emit(OpUnmark)
+
+		if arm.Guard != nil {
+			c.compileExpression(arm.Guard)
+			fail.jumps = append(fail.jumps, c.emit(OpJumpIfFalse, 0))
+		}
+
+		c.compileBlock(arm.Body)
+		ends = append(ends, c.emit(OpJump, 0))
+		c.scope = outer
+
+		next := len(c.unit.fn.Instructions)
+		for _, pos := range fail.patterns {
+			c.patchOperand(pos, 1, next)
+		}
+		for _, pos := range fail.fields {
+			c.patchOperand(pos, 2, next)
+		}
+		for _, pos := range fail.jumps {
+			c.patchOperand(pos, 0, next)
+		}
+	}
+
+	c.emit(OpGetLocal, subject)
+	c.emit(OpNoMatch)
+
+	for _, pos := range ends {
+		c.patchJump(pos)
+	}
+}
+
+func (c *compiler) compileImportStatement(is *ast.ImportStatement) {
+	if !c.scope.global {
+		c.fail("import is only allowed at the top level")
+		return
+	}
+
+	c.emit(OpImport, c.addString(is.Path.Value))
+
+	if is.Alias != nil {
+		c.emit(OpDup)
+		c.emit(OpDefineGlobal, c.addString(is.Alias.Value))
+	}
+
+	for _, name := range is.Names {
+		bound := name.Name
+		if name.Alias != nil {
+			bound = name.Alias
+		}
+
+		c.emit(OpDup)
+		c.emit(OpImportName, c.addString(name.Name.Value))
+		c.emit(OpDefineGlobal, c.addString(bound.Value))
+	}
+
+	c.emit(OpPop)
+}
+
+func (c *compiler) compileExportStatement(es *ast.ExportStatement) {
+	if !c.scope.global {
+		c.fail("export is only allowed at the top level")
+		return
+	}
+
+	c.compileStatement(es.Statement)
+
+	var names []string
+	switch stmt := es.Statement.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			names = patternNames(stmt.Pattern, names)
+		} else {
+			names = append(names, stmt.Name.Value)
+		}
+	case *ast.FunctionStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.StructStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.ClassStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.EnumStatement:
+		names = append(names, stmt.Name.Value)
+		for _, variant := range stmt.Variants {
+			names = append(names, variant.Name.Value)
+		}
+	}
+
+	for _, name := range names {
+		c.emit(OpExport, c.addString(name))
+	}
+}
+
+func (c *compiler) compileStructStatement(ss *ast.StructStatement) {
+	c.checkRedeclare(ss.Name.Value)
+
+	desc := []object.Object{&object.String{Value: ss.Name.Value}}
+	for _, field := range ss.Fields {
+		desc = append(desc, &object.String{Value: field.Value})
+	}
+
+	c.emit(OpStruct, c.addConstant(&object.Array{Elements: desc}))
+	c.store(c.scope.declare(ss.Name.Value, false))
+}
+
+// compileEnumStatement creates the enum type, described by its name and an
+// array of the name and fields of each variant, and binds it and its
+// variants.
+func (c *compiler) compileEnumStatement(es *ast.EnumStatement) {
+	names := []string{es.Name.Value}
+	for _, v := range es.Variants {
+		names = append(names, v.Name.Value)
+	}
+	c.checkRedeclare(names...)
+
+	desc := []object.Object{&object.String{Value: es.Name.Value}}
+	for _, v := range es.Variants {
+		variant := []object.Object{&object.String{Value: v.Name.Value}}
+		for _, field := range v.Fields {
+			variant = append(variant, &object.String{Value: field.Value})
+		}
+		desc = append(desc, &object.Array{Elements: variant})
+	}
+
+	c.emit(OpEnum, c.addConstant(&object.Array{Elements: desc}))
+	c.emit(OpDup)
+	c.store(c.scope.declare(es.Name.Value, false))
+
+	for i, v := range es.Variants {
+		c.emit(OpDup)
+		c.emit(OpVariant, i)
+		c.store(c.scope.declare(v.Name.Value, false))
+	}
+	c.emit(OpPop)
+}
+
+// compileClassStatement creates the class from its superclass, if any, and
+// the closures of its methods, which see `self` and `super` as free
+// variables bound when a method is looked up on an instance.
+func (c *compiler) compileClassStatement(cs *ast.ClassStatement) {
+	c.checkRedeclare(cs.Name.Value)
+
+	flags := 0
+	if cs.Superclass != nil {
+		c.compileExpression(cs.Superclass)
+		flags = 1
+	}
+
+	desc := []object.Object{&object.String{Value: cs.Name.Value}}
+	ms := methodScope(c.scope, cs.Superclass != nil)
+	for _, method := range cs.Methods {
+		desc = append(desc, &object.String{Value: method.Name})
+		c.deferFunction(method, cs.Name.Value+"."+method.Name, ms)
+	}
+
+	c.emit(OpClass, c.addConstant(&object.Array{Elements: desc}), flags)
+	c.store(c.scope.declare(cs.Name.Value, false))
+}
+
+// emit appends an instruction to the current unit and returns its offset.
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	ins := Make(op, operands...)
+	pos := len(c.unit.fn.Instructions)
+	c.unit.fn.Instructions = append(c.unit.fn.Instructions, ins...)
+
+	if pos > 0xFFFF-len(ins) {
+		panic(limitError("function too large"))
+	}
+	return pos
+}
+
+// patchJump points the jump at pos to the end of the current code.
+func (c *compiler) patchJump(pos int) {
+	c.patchOperand(pos, 0, len(c.unit.fn.Instructions))
+}
+
+// patchOperand replaces operand n of the instruction at pos.
+func (c *compiler) patchOperand(pos, n, value int) {
+	ins := c.unit.fn.Instructions
+	def, _ := Lookup(ins[pos])
+
+	operands, _ := ReadOperands(def, ins[pos+1:])
+	operands[n] = value
+	copy(ins[pos:], Make(Opcode(ins[pos]), operands...))
+}
+
+func (c *compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	if len(c.constants) > 0xFFFF {
+		panic(limitError("too many constants"))
+	}
+	return len(c.constants) - 1
+}
+
+func (c *compiler) addString(s string) int {
+	if i, ok := c.strings[s]; ok {
+		return i
+	}
+	i := c.addConstant(&object.String{Value: s})
+	c.strings[s] = i
+	return i
+}
+
+func (c *compiler) addNumber(n float64) int {
+	bits := math.Float64bits(n)
+	if i, ok := c.numbers[bits]; ok {
+		return i
+	}
+	i := c.addConstant(&object.Number{Value: n})
+	c.numbers[bits] = i
+	return i
+}
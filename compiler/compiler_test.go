@@ -0,0 +1,339 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpCall, []int{3}, []byte{byte(OpCall), 3}},
+		{OpClass, []int{1, 1}, []byte{byte(OpClass), 0, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("wrong encoding of %d. want=%v, got=%v", tt.op, tt.expected, instruction)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	var ins Instructions
+	for _, instruction := range [][]byte{
+		Make(OpConstant, 1),
+		Make(OpGetLocal, 2),
+		Make(OpCall, 1),
+		Make(OpMatchRange, 3, NoMatch, 1),
+	} {
+		ins = append(ins, instruction...)
+	}
+
+	expected := `0000 OpConstant 1
+0003 OpGetLocal 2
+0006 OpCall 1
+0008 OpMatchRange 3 65535 1
+`
+	if ins.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	bc, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	return bc
+}
+
+func TestCompileProgram(t *testing.T) {
+	bc := compile(t, "let x = 1; x + 2")
+
+	expected := `0000 OpCheckGlobal 0
+0003 OpConstant 1
+0006 OpDefineGlobal 0
+0009 OpGetGlobal 0
+0012 OpConstant 2
+0015 OpAdd
+0016 OpReturnValue
+`
+	if got := bc.Main.Instructions.String(); got != expected {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", expected, got)
+	}
+	if bc.Main.Name != "<main>" {
+		t.Errorf("wrong name of main. got=%q", bc.Main.Name)
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	bc := compile(t, `let outer = fn(a, b = 2) {
+	let c = a + b;
+	fn(d) { a + c + d }
+};`)
+
+	var outer, inner *Function
+	for _, constant := range bc.Constants {
+		fn, ok := constant.(*Function)
+		if !ok {
+			continue
+		}
+		switch fn.Name {
+		case "outer":
+			outer = fn
+		case "":
+			inner = fn
+		}
+	}
+	if outer == nil || inner == nil {
+		t.Fatalf("functions not compiled. constants=%v", bc.Constants)
+	}
+
+	if got := strings.Join(outer.Locals, ","); got != "a,b,c" {
+		t.Errorf("wrong locals of outer. got=%q", got)
+	}
+	if len(outer.Parameters) != 2 || !outer.Parameters[1].Default || outer.Parameters[1].Source != "b = 2" {
+		t.Errorf("wrong parameters of outer. got=%+v", outer.Parameters)
+	}
+
+	expected := []Capture{{Name: "a", Kind: CaptureLocal, Index: 0}, {Name: "c", Kind: CaptureLocal, Index: 2}}
+	if len(inner.Free) != len(expected) {
+		t.Fatalf("wrong captures of inner. got=%+v", inner.Free)
+	}
+	for i, capture := range expected {
+		if inner.Free[i] != capture {
+			t.Errorf("wrong capture %d of inner. want=%+v, got=%+v", i, capture, inner.Free[i])
+		}
+	}
+
+	expectedInspect := "fn outer(a, b = 2) {\nlet c = (a + b);fn(d) ((a + c) + d)\n}"
+	if got := outer.Inspect(); got != expectedInspect {
+		t.Errorf("wrong Inspect of outer. got=%q", got)
+	}
+}
+
+func TestCompileCallSites(t *testing.T) {
+	bc := compile(t, "let f = fn(x) { x };\n\nf(1)")
+
+	if len(bc.Main.Calls) != 1 {
+		t.Fatalf("wrong number of call sites. got=%+v", bc.Main.Calls)
+	}
+
+	call := bc.Main.Calls[0]
+	site, ok := bc.Main.CallSite(call.Offset)
+	if !ok || site.Name != "f" || site.Line != 3 {
+		t.Errorf("wrong call site. got=%+v", site)
+	}
+	if _, ok := bc.Main.CallSite(call.Offset + 1); ok {
+		t.Errorf("found call site at offset without call")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	bc := compile(t, `let outer = fn(a, b = 2, ...rest) {
+	let [c, [d]] = [a, [b]];
+	fn(e) { a + c + d + e + len(rest) }
+};
+match ({x: 1}) { {x} => x, _ => "none" }
+try { outer(1)(2.5) } catch (e) { e }`)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, bc); err != nil {
+		t.Fatalf("Encode returned error: %s", err)
+	}
+
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode returned error: %s", err)
+	}
+
+	if got := decoded.Main.Instructions.String(); got != bc.Main.Instructions.String() {
+		t.Errorf("wrong instructions of main.\nwant=%q\ngot=%q", bc.Main.Instructions, got)
+	}
+	if len(decoded.Constants) != len(bc.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bc.Constants), len(decoded.Constants))
+	}
+	for i, constant := range bc.Constants {
+		got := decoded.Constants[i]
+		if got.Type() != constant.Type() || got.Inspect() != constant.Inspect() {
+			t.Errorf("wrong constant %d. want=%s, got=%s", i, constant.Inspect(), got.Inspect())
+		}
+
+		fn, ok := constant.(*Function)
+		if !ok {
+			continue
+		}
+		gotFn := got.(*Function)
+		if gotFn.Instructions.String() != fn.Instructions.String() {
+			t.Errorf("wrong instructions of constant %d", i)
+		}
+		if strings.Join(gotFn.Locals, ",") != strings.Join(fn.Locals, ",") {
+			t.Errorf("wrong locals of constant %d. want=%q, got=%q", i, fn.Locals, gotFn.Locals)
+		}
+		if len(gotFn.Free) != len(fn.Free) || len(gotFn.Calls) != len(fn.Calls) || len(gotFn.Parameters) != len(fn.Parameters) {
+			t.Errorf("wrong function %d. want=%+v, got=%+v", i, fn, gotFn)
+		}
+		for j := range fn.Parameters {
+			if gotFn.Parameters[j] != fn.Parameters[j] {
+				t.Errorf("wrong parameter %d of constant %d. want=%+v, got=%+v", j, i, fn.Parameters[j], gotFn.Parameters[j])
+			}
+		}
+		if gotFn.Block != fn.Block {
+			t.Errorf("wrong block flag of constant %d", i)
+		}
+		if &gotFn.Constants[0] != &decoded.Constants[0] {
+			t.Errorf("constant %d does not share the constants of the program", i)
+		}
+	}
+
+	data := buf.Bytes()
+	if _, err := Decode(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrFormat) {
+		t.Errorf("expected ErrFormat for truncated data. got=%v", err)
+	}
+	if _, err := Decode(strings.NewReader("let x = 1;")); !errors.Is(err, ErrFormat) {
+		t.Errorf("expected ErrFormat for source. got=%v", err)
+	}
+
+	future := append([]byte(Magic), FormatVersion+1)
+	if _, err := Decode(bytes.NewReader(future)); !errors.Is(err, ErrVersion) {
+		t.Errorf("expected ErrVersion. got=%v", err)
+	}
+}
+
+// TestDecodeVerifies checks that programs with a valid checksum but
+// instructions the VM cannot run are rejected. Constant 0 is the number 1.
+func TestDecodeVerifies(t *testing.T) {
+	concat := func(parts ...Instructions) Instructions {
+		var ins Instructions
+		for _, part := range parts {
+			ins = append(ins, part...)
+		}
+		return ins
+	}
+
+	tests := []struct {
+		name   string
+		modify func(bc *Bytecode)
+	}{
+		{"unknown opcode", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Instructions{0xFE}, Make(OpReturn))
+		}},
+		{"truncated operand", func(bc *Bytecode) {
+			bc.Main.Instructions = Make(OpConstant, 0)[:2]
+		}},
+		{"constant out of range", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpConstant, 999), Make(OpReturn))
+		}},
+		{"name that is not a string", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpGetGlobal, 0), Make(OpReturn))
+		}},
+		{"closure of a number", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpClosure, 0), Make(OpReturn))
+		}},
+		{"local out of range", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpGetLocal, len(bc.Main.Locals)), Make(OpReturn))
+		}},
+		{"jump into an instruction", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpJump, 1), Make(OpReturn))
+		}},
+		{"no return", func(bc *Bytecode) {
+			bc.Main.Instructions = Make(OpPop)
+		}},
+		{"call site that is not a call", func(bc *Bytecode) {
+			bc.Main.Calls = []CallSite{{Offset: 0, Name: "f", Line: 1}}
+		}},
+		{"stack underflow", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpPop), Make(OpPop), Make(OpReturnValue))
+		}},
+		{"stack of another depth after a jump", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpTrue), Make(OpJumpIfFalse, 7), Make(OpConstant, 0), Make(OpReturn))
+		}},
+		{"pattern without a mark", func(bc *Bytecode) {
+			name := slices.IndexFunc(bc.Constants, func(c object.Object) bool { return c.Type() == object.STRING_OBJ })
+			bc.Main.Instructions = concat(Make(OpNil), Make(OpMatchHash, name, 7), Make(OpPop), Make(OpReturn))
+		}},
+		{"unmark without a mark", func(bc *Bytecode) {
+			bc.Main.Instructions = concat(Make(OpUnmark), Make(OpReturn))
+		}},
+	}
+
+	for _, tt := range tests {
+		bc := compile(t, "1; let x = 2; x + 3")
+		tt.modify(bc)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, bc); err != nil {
+			t.Fatalf("Encode returned error: %s", err)
+		}
+		if _, err := Decode(&buf); !errors.Is(err, ErrFormat) {
+			t.Errorf("%s: expected ErrFormat. got=%v", tt.name, err)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(filepath.Join(t.TempDir(), "cache"))
+	source := []byte("let x = 1; x + 2")
+
+	if _, ok := cache.Load(source, false); ok {
+		t.Fatalf("empty cache returned a program")
+	}
+
+	bc := compile(t, string(source))
+	if err := cache.Store(source, false, bc); err != nil {
+		t.Fatalf("Store returned error: %s", err)
+	}
+
+	cached, ok := cache.Load(source, false)
+	if !ok {
+		t.Fatalf("stored program not found")
+	}
+	if cached.Main.Instructions.String() != bc.Main.Instructions.String() {
+		t.Errorf("wrong cached instructions. got=%q", cached.Main.Instructions)
+	}
+
+	if _, ok := cache.Load([]byte("let x = 2; x + 2"), false); ok {
+		t.Errorf("cache returned a program for another source")
+	}
+	if _, ok := cache.Load(source, true); ok {
+		t.Errorf("cache returned a plain program as optimized")
+	}
+
+	// Corrupt entries are misses.
+	path := cache.path(source, false)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read cached program: %s", err)
+	}
+	data[len(data)/2] ^= 0xFF
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("cannot write cached program: %s", err)
+	}
+	if _, ok := cache.Load(source, false); ok {
+		t.Errorf("cache returned a corrupt program")
+	}
+}
@@ -0,0 +1,358 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/darwin1224/saphire/object"
+)
+
+// Compiled programs are stored in files starting with Magic and the
+// FormatVersion of the encoding, and ending with a CRC-32 checksum of what
+// precedes it. The version changes whenever the encoding or the instruction
+// set does, so that files written by other versions are rejected instead of
+// misread.
+const (
+	Magic         = "SPC\x00"
+	FormatVersion = 2
+)
+
+const checksumSize = 4
+
+// ErrFormat is returned when decoding data that is not a compiled program.
+var ErrFormat = errors.New("not a compiled saphire program")
+
+// ErrVersion is returned when decoding a program compiled for another
+// version of the format.
+var ErrVersion = errors.New("compiled program has an unsupported format version")
+
+// Tags of the encoded constants.
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagArray
+	tagFunction
+)
+
+// Encode writes bc to w in the binary format read by Decode.
+func Encode(w io.Writer, bc *Bytecode) error {
+	e := &encoder{}
+	e.buf = append(e.buf, Magic...)
+	e.uint(FormatVersion)
+
+	e.uint(uint64(len(bc.Constants)))
+	for _, constant := range bc.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+	e.function(bc.Main)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, crc32.ChecksumIEEE(e.buf))
+
+	_, err := w.Write(e.buf)
+	return err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(n uint64) {
+	e.buf = binary.AppendUvarint(e.buf, n)
+}
+
+func (e *encoder) int(n int) {
+	e.buf = binary.AppendVarint(e.buf, int64(n))
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Number:
+		e.buf = append(e.buf, tagNumber)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf = append(e.buf, tagString)
+		e.string(obj.Value)
+	case *object.Array:
+		e.buf = append(e.buf, tagArray)
+		e.uint(uint64(len(obj.Elements)))
+		for _, el := range obj.Elements {
+			if err := e.constant(el); err != nil {
+				return err
+			}
+		}
+	case *Function:
+		e.buf = append(e.buf, tagFunction)
+		e.function(obj)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+// function encodes fn without its constants, which are those of the
+// program.
+func (e *encoder) function(fn *Function) {
+	e.string(fn.Name)
+	e.string(fn.Body)
+	e.bool(fn.Block)
+
+	e.uint(uint64(len(fn.Parameters)))
+	for _, p := range fn.Parameters {
+		e.string(p.Name)
+		e.string(p.Source)
+		e.bool(p.Default)
+		e.bool(p.Variadic)
+	}
+
+	e.uint(uint64(len(fn.Instructions)))
+	e.buf = append(e.buf, fn.Instructions...)
+
+	e.uint(uint64(len(fn.Locals)))
+	for _, name := range fn.Locals {
+		e.string(name)
+	}
+
+	e.uint(uint64(len(fn.Free)))
+	for _, capture := range fn.Free {
+		e.string(capture.Name)
+		e.buf = append(e.buf, byte(capture.Kind))
+		e.int(capture.Index)
+	}
+
+	e.uint(uint64(len(fn.Calls)))
+	for _, call := range fn.Calls {
+		e.int(call.Offset)
+		e.string(call.Name)
+		e.int(call.Line)
+	}
+}
+
+// Decode reads a program written by Encode. Data that is corrupt, or whose
+// instructions do not pass the checks of the compiler on their operands, is
+// rejected with ErrFormat, so that the VM never runs it.
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, ErrFormat
+	}
+	version, n := binary.Uvarint(data[len(Magic):])
+	if n > 0 && version != FormatVersion {
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrVersion, version, FormatVersion)
+	}
+	if n <= 0 || len(data) < len(Magic)+n+checksumSize {
+		return nil, ErrFormat
+	}
+
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrFormat)
+	}
+	d := &decoder{r: bytes.NewReader(body[len(Magic)+n:])}
+
+	bc := &Bytecode{Constants: make([]object.Object, d.count())}
+	for i := range bc.Constants {
+		bc.Constants[i] = d.constant()
+	}
+	bc.Main = d.function()
+	if d.err == nil && d.r.Len() > 0 {
+		d.fail(fmt.Errorf("%d bytes after the program", d.r.Len()))
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, d.err)
+	}
+	if err := verify(bc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+
+	// Functions share the constants of the program.
+	bc.Main.Constants = bc.Constants
+	for _, constant := range bc.Constants {
+		if fn, ok := constant.(*Function); ok {
+			fn.Constants = bc.Constants
+		}
+	}
+
+	return bc, nil
+}
+
+// maxCount bounds the lengths read by a decoder, so that corrupt data
+// cannot make it allocate without limit.
+const maxCount = 1 << 28
+
+// decoder reads encoded values, keeping the first error. Values read after
+// an error are zero.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	return n
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(d.r)
+	d.fail(err)
+	return int(n)
+}
+
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > maxCount {
+		d.fail(fmt.Errorf("length %d too large", n))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() == 1
+}
+
+func (d *decoder) bytes() []byte {
+	buf := make([]byte, d.count())
+	if d.err == nil {
+		_, err := io.ReadFull(d.r, buf)
+		d.fail(err)
+	}
+	return buf
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagNumber:
+		var buf [8]byte
+		if d.err == nil {
+			_, err := io.ReadFull(d.r, buf[:])
+			d.fail(err)
+		}
+		return &object.Number{Value: math.Float64frombits(binary.BigEndian.Uint64(buf[:]))}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagArray:
+		elements := make([]object.Object, d.count())
+		for i := range elements {
+			elements[i] = d.constant()
+		}
+		return &object.Array{Elements: elements}
+	case tagFunction:
+		return d.function()
+	default:
+		d.fail(fmt.Errorf("unknown constant tag %d", tag))
+		return &object.String{}
+	}
+}
+
+func (d *decoder) function() *Function {
+	fn := &Function{Name: d.string(), Body: d.string(), Block: d.bool()}
+
+	fn.Parameters = make([]Parameter, d.count())
+	for i := range fn.Parameters {
+		fn.Parameters[i] = Parameter{Name: d.string(), Source: d.string(), Default: d.bool(), Variadic: d.bool()}
+	}
+
+	fn.Instructions = d.bytes()
+
+	fn.Locals = make([]string, d.count())
+	for i := range fn.Locals {
+		fn.Locals[i] = d.string()
+	}
+
+	fn.Free = make([]Capture, d.count())
+	for i := range fn.Free {
+		fn.Free[i] = Capture{Name: d.string(), Kind: CaptureKind(d.byte()), Index: d.int()}
+	}
+
+	fn.Calls = make([]CallSite, d.count())
+	for i := range fn.Calls {
+		fn.Calls[i] = CallSite{Offset: d.int(), Name: d.string(), Line: d.int()}
+	}
+
+	return fn
+}
+
+// ReadFile decodes the compiled program stored in the file at path.
+func ReadFile(path string) (*Bytecode, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bc, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bc, nil
+}
+
+// WriteFile encodes bc to the file at path. The file is replaced
+// atomically, so that concurrent readers never see a partial program.
+func WriteFile(path string, bc *Bytecode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := Encode(f, bc); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
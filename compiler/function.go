@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/darwin1224/saphire/object"
+)
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+// Bytecode is a compiled program: its top-level code, and the constants
+// its instructions refer to by index.
+type Bytecode struct {
+	Main      *Function
+	Constants []object.Object
+}
+
+// Function is the compiled code of a function literal, a method, the
+// blocks of a try expression or the top level of a program. It is a
+// constant of the program, from which OpClosure creates closures.
+type Function struct {
+	Name       string
+	Parameters []Parameter
+	// Body is the source of the function's body, shown by Inspect.
+	Body string
+
+	Instructions Instructions
+	// Constants is the constant pool of the program the function belongs
+	// to.
+	Constants []object.Object
+	// Locals names the slots of the function's frame. The parameters come
+	// first, and slots without a name hold values the compiler keeps, such
+	// as the subject of a match.
+	Locals []string
+	// Free lists the variables a closure of the function captures.
+	Free []Capture
+	// Calls locates the calls made by the function, for error traces.
+	Calls []CallSite
+	// Block is set for the blocks of a try expression, which run in frames
+	// of their own but are not function calls.
+	Block bool
+}
+
+// Parameter is a parameter of a compiled function. Name is empty for a
+// parameter destructured by a pattern.
+type Parameter struct {
+	Name     string
+	Source   string
+	Default  bool
+	Variadic bool
+}
+
+// CaptureKind tells where a closure captures a variable from.
+type CaptureKind byte
+
+const (
+	// CaptureLocal captures a slot of the frame creating the closure, and
+	// CaptureFree a variable the creating closure captured itself.
+	CaptureLocal CaptureKind = iota
+	CaptureFree
+	// CaptureSelf and CaptureSuper are left unbound until a method is
+	// bound to an instance.
+	CaptureSelf
+	CaptureSuper
+)
+
+type Capture struct {
+	Name  string
+	Kind  CaptureKind
+	Index int
+}
+
+// CallSite is the name and line of the call at Offset.
+type CallSite struct {
+	Offset int
+	Name   string
+	Line   int
+}
+
+func (f *Function) Type() object.ObjectType { return COMPILED_FUNCTION_OBJ }
+
+// Inspect renders the function like an interpreted function with the same
+// source.
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := make([]string, 0)
+	for _, p := range f.Parameters {
+		params = append(params, p.Source)
+	}
+
+	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body)
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CallSite returns the call made by the instruction at offset.
+func (f *Function) CallSite(offset int) (CallSite, bool) {
+	i := sort.Search(len(f.Calls), func(i int) bool { return f.Calls[i].Offset >= offset })
+	if i < len(f.Calls) && f.Calls[i].Offset == offset {
+		return f.Calls[i], true
+	}
+	return CallSite{}, false
+}
@@ -0,0 +1,187 @@
+package compiler
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// failTarget collects the instructions of a match arm that jump to the
+// next arm when the subject does not match: pattern tests, whose fail
+// operand is their second, hash field lookups, whose fail operand is their
+// third, and the jump of the guard.
+type failTarget struct {
+	patterns []int
+	fields   []int
+	jumps    []int
+}
+
+// compilePattern destructures the value on top of the stack into pattern,
+// declaring the names it binds. A value that does not match jumps to fail,
+// or raises a match error when fail is nil.
+func (c *compiler) compilePattern(pattern ast.Pattern, fail *failTarget, isConst bool) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.store(c.scope.declare(pattern.Value, isConst))
+	case *ast.WildcardPattern:
+		c.emit(OpPop)
+	case *ast.LiteralPattern:
+		c.compileExpression(pattern.Value)
+		c.emitTest(fail, OpMatchEqual, c.addString(pattern.String()))
+	case *ast.RangePattern:
+		c.compileExpression(pattern.Low)
+		c.compileExpression(pattern.High)
+
+		inclusive := 0
+		if pattern.Inclusive {
+			inclusive = 1
+		}
+		c.emitTest(fail, OpMatchRange, c.addString(pattern.String()), inclusive)
+	case *ast.ArrayPattern:
+		c.compileArrayPattern(pattern, fail, isConst)
+	case *ast.HashPattern:
+		c.compileHashPattern(pattern, fail, isConst)
+	case *ast.VariantPattern:
+		c.compileVariantPattern(pattern, fail, isConst)
+	default:
+		c.fail("unknown pattern: %s", pattern)
+	}
+}
+
+// emitTest emits a pattern test, whose second operand is its fail target.
+func (c *compiler) emitTest(fail *failTarget, op Opcode, pattern int, operands ...int) {
+	pos := c.emit(op, append([]int{pattern, NoMatch}, operands...)...)
+	if fail != nil {
+		fail.patterns = append(fail.patterns, pos)
+	}
+}
+
+func (c *compiler) compileArrayPattern(pattern *ast.ArrayPattern, fail *failTarget, isConst bool) {
+	required := 0
+	for i, el := range pattern.Elements {
+		if el.Default == nil {
+			required = i + 1
+		}
+	}
+
+	rest := 0
+	if pattern.Rest != nil {
+		rest = 1
+	}
+	c.emitTest(fail, OpMatchArray, c.addString(pattern.String()), required, len(pattern.Elements), rest)
+
+	for i, el := range pattern.Elements {
+		c.emit(OpDup)
+		c.emit(OpElement, i)
+		c.compileElementDefault(el)
+		c.compilePattern(el.Pattern, fail, isConst)
+	}
+
+	if pattern.Rest != nil {
+		c.emit(OpDup)
+		c.emit(OpArrayRest, len(pattern.Elements))
+		c.store(c.scope.declare(pattern.Rest.Value, isConst))
+	}
+
+	c.emit(OpPop)
+}
+
+func (c *compiler) compileHashPattern(pattern *ast.HashPattern, fail *failTarget, isConst bool) {
+	source := c.addString(pattern.String())
+	c.emitTest(fail, OpMatchHash, source)
+
+	keys := make([]object.Object, len(pattern.Pairs))
+	for i, pair := range pattern.Pairs {
+		keys[i] = &object.String{Value: pair.Key}
+
+		hasDefault := 0
+		if pair.Value.Default != nil {
+			hasDefault = 1
+		}
+
+		c.emit(OpDup)
+		pos := c.emit(OpField, source, c.addString(pair.Key), NoMatch, hasDefault)
+		if fail != nil {
+			fail.fields = append(fail.fields, pos)
+		}
+		c.compileElementDefault(pair.Value)
+		c.compilePattern(pair.Value.Pattern, fail, isConst)
+	}
+
+	if pattern.Rest != nil {
+		c.emit(OpDup)
+		c.emit(OpHashRest, c.addConstant(&object.Array{Elements: keys}))
+		c.store(c.scope.declare(pattern.Rest.Value, isConst))
+	}
+
+	c.emit(OpPop)
+}
+
+// compileElementDefault replaces a missing element with its default.
+func (c *compiler) compileElementDefault(el *ast.PatternElement) {
+	if el.Default == nil {
+		return
+	}
+
+	skip := c.emit(OpDefault, 0)
+	c.compileExpression(el.Default)
+	c.patchJump(skip)
+}
+
+// compileVariantPattern looks up the variant, by name or as a member of its
+// enum, and matches the value against it, described by the pattern's
+// source and the variant's name. The third operand of the test is the
+// number of argument patterns, or NoMatch if the pattern has none.
+func (c *compiler) compileVariantPattern(pattern *ast.VariantPattern, fail *failTarget, isConst bool) {
+	if pattern.Enum != nil {
+		c.compileExpression(pattern.Enum)
+		c.emit(OpMember, c.addString(pattern.Name.Value))
+	} else {
+		c.compileExpression(pattern.Name)
+	}
+
+	desc := c.addConstant(&object.Array{Elements: []object.Object{
+		&object.String{Value: pattern.String()},
+		&object.String{Value: pattern.Name.String()},
+	}})
+
+	args := NoMatch
+	if pattern.Arguments != nil {
+		args = len(pattern.Arguments)
+	}
+	c.emitTest(fail, OpMatchVariant, desc, args)
+
+	for i, arg := range pattern.Arguments {
+		c.emit(OpDup)
+		c.emit(OpElement, i)
+		c.compilePattern(arg, fail, isConst)
+	}
+
+	c.emit(OpPop)
+}
+
+// patternNames appends the names bound by pattern to names.
+func patternNames(pattern ast.Pattern, names []string) []string {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		names = append(names, pattern.Value)
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			names = patternNames(el.Pattern, names)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			names = patternNames(pair.Value.Pattern, names)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+	case *ast.VariantPattern:
+		for _, arg := range pattern.Arguments {
+			names = patternNames(arg, names)
+		}
+	}
+	return names
+}
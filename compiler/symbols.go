@@ -0,0 +1,113 @@
+package compiler
+
+// SymbolScope tells where the value of a variable is stored at runtime.
+type SymbolScope int
+
+const (
+	// GlobalScope variables are bound by name in the environment the
+	// program runs in, along with builtins and names defined by the host.
+	GlobalScope SymbolScope = iota
+	// LocalScope variables live in a slot of the frame of a call.
+	LocalScope
+	// FreeScope variables are captured by a closure from an enclosing
+	// function.
+	FreeScope
+	// SelfScope and SuperScope are `self` and `super` in methods, bound when
+	// the method is looked up on an instance.
+	SelfScope
+	SuperScope
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool
+}
+
+// scope is a block of the program that declarations are bound in. Scopes
+// of the same unit share its frame slots.
+type scope struct {
+	outer *scope
+	unit  *unit
+	store map[string]*Symbol
+	// global is set for the top-level scope of a program, whose names are
+	// globals, and method for the scope binding `self` and `super` around
+	// the methods of a class.
+	global bool
+	method bool
+}
+
+func newScope(outer *scope, u *unit) *scope {
+	return &scope{outer: outer, unit: u, store: make(map[string]*Symbol)}
+}
+
+// declare binds name in s, reusing its slot if s already declares it.
+func (s *scope) declare(name string, isConst bool) *Symbol {
+	if s.global {
+		return &Symbol{Name: name, Scope: GlobalScope, Const: isConst}
+	}
+
+	if sym, ok := s.store[name]; ok {
+		sym.Const = isConst
+		return sym
+	}
+
+	sym := &Symbol{Name: name, Scope: LocalScope, Index: s.unit.newSlot(name), Const: isConst}
+	s.store[name] = sym
+	return sym
+}
+
+// declared returns the symbol name declared in s itself.
+func (s *scope) declared(name string) (*Symbol, bool) {
+	sym, ok := s.store[name]
+	return sym, ok
+}
+
+// resolve finds the variable name as seen from s. Variables of enclosing
+// functions are captured by every function in between, and names that no
+// scope declares are globals.
+func (s *scope) resolve(name string) *Symbol {
+	for sc := s; sc != nil; sc = sc.outer {
+		switch {
+		case sc.unit == s.unit:
+			if sym, ok := sc.store[name]; ok {
+				return sym
+			}
+		case sc.method:
+			if sym, ok := sc.store[name]; ok {
+				return s.unit.capture(sym)
+			}
+		default:
+			sym := sc.resolve(name)
+			if sym.Scope == GlobalScope {
+				return sym
+			}
+			return s.unit.capture(sym)
+		}
+	}
+
+	return &Symbol{Name: name, Scope: GlobalScope}
+}
+
+// enclosing reports whether a scope enclosing s, other than the global
+// scope, declares name.
+func (s *scope) enclosing(name string) bool {
+	for sc := s.outer; sc != nil && !sc.global; sc = sc.outer {
+		if _, ok := sc.store[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// methodScope returns the scope binding `self` and, for classes that
+// extend another, `super` around the methods of a class.
+func methodScope(outer *scope, super bool) *scope {
+	s := &scope{outer: outer, store: make(map[string]*Symbol), method: true}
+	s.store["self"] = &Symbol{Name: "self", Scope: SelfScope}
+	if super {
+		s.store["super"] = &Symbol{Name: "super", Scope: SuperScope}
+	}
+	return s
+}
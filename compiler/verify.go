@@ -0,0 +1,420 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/darwin1224/saphire/object"
+)
+
+// Kinds of operands checked by verify.
+const (
+	operandNone = iota
+	// operandConstant is the index of a constant other than a function.
+	operandConstant
+	operandString
+	// operandNames is the index of an array constant of strings.
+	operandNames
+	operandEnum
+	operandFunction
+	operandLocal
+	operandFree
+	operandJump
+	// operandFail is a jump target or NoMatch.
+	operandFail
+)
+
+// operandKinds lists the kinds of the operands of the opcodes with
+// operands that index something.
+var operandKinds = map[Opcode][]int{
+	OpConstant:     {operandConstant},
+	OpJump:         {operandJump},
+	OpJumpIfFalse:  {operandJump},
+	OpGetGlobal:    {operandString},
+	OpDefineGlobal: {operandString},
+	OpConstGlobal:  {operandString},
+	OpAssignGlobal: {operandString},
+	OpCheckGlobal:  {operandString},
+	OpGetLocal:     {operandLocal},
+	OpSetLocal:     {operandLocal},
+	OpGetFree:      {operandFree},
+	OpSetFree:      {operandFree},
+	OpClosure:      {operandFunction},
+	OpCallArgs:     {operandNone, operandNames},
+	OpMember:       {operandString},
+	OpSetMember:    {operandString},
+	OpCheckWith:    {operandNames},
+	OpWith:         {operandNames},
+	OpStruct:       {operandNames},
+	OpEnum:         {operandEnum},
+	OpClass:        {operandNames},
+	OpFail:         {operandString},
+	OpShadow:       {operandString},
+	OpMatchEqual:   {operandString, operandFail},
+	OpMatchRange:   {operandString, operandFail},
+	OpMatchArray:   {operandString, operandFail},
+	OpMatchHash:    {operandString, operandFail},
+	OpMatchVariant: {operandNames, operandFail},
+	OpHashRest:     {operandNames},
+	OpField:        {operandString, operandString, operandFail},
+	OpDefault:      {operandJump},
+	OpParamDefault: {operandLocal, operandJump},
+	OpImport:       {operandString},
+	OpImportName:   {operandString},
+	OpExport:       {operandString},
+}
+
+// verify checks that the instructions of every function of bc are whole,
+// known instructions whose operands are in range: constants of the kind
+// the instruction expects, slots and captured variables of the function,
+// and jumps to the start of an instruction. It also checks that every
+// instruction finds the values it takes on the stack, and that every path
+// to an instruction leaves the stack as deep, so that the stack of a
+// function is bounded.
+func verify(bc *Bytecode) error {
+	if bc.Main == nil {
+		return fmt.Errorf("program has no main function")
+	}
+	if err := verifyFunction(bc.Main, bc.Constants); err != nil {
+		return fmt.Errorf("main: %w", err)
+	}
+
+	for i, constant := range bc.Constants {
+		if fn, ok := constant.(*Function); ok {
+			if err := verifyFunction(fn, bc.Constants); err != nil {
+				return fmt.Errorf("constant %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func verifyFunction(fn *Function, constants []object.Object) error {
+	ins := fn.Instructions
+
+	if len(fn.Parameters) > len(fn.Locals) {
+		return fmt.Errorf("%d parameters but %d local slots", len(fn.Parameters), len(fn.Locals))
+	}
+
+	// starts holds the offsets at which instructions start.
+	starts := make(map[int]Opcode)
+	var jumps []int
+	last := Opcode(0)
+
+	for ip := 0; ip < len(ins); {
+		op := Opcode(ins[ip])
+		def, ok := definitions[op]
+		if !ok {
+			return fmt.Errorf("unknown opcode %d at %d", op, ip)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+1+width > len(ins) {
+			return fmt.Errorf("%s at %d is truncated", def.Name, ip)
+		}
+
+		operands, _ := ReadOperands(def, ins[ip+1:])
+		for i, kind := range operandKinds[op] {
+			operand := operands[i]
+
+			switch kind {
+			case operandJump:
+				jumps = append(jumps, operand)
+			case operandFail:
+				if operand != NoMatch {
+					jumps = append(jumps, operand)
+				}
+			case operandLocal:
+				if operand >= len(fn.Locals) {
+					return fmt.Errorf("%s at %d uses slot %d of %d", def.Name, ip, operand, len(fn.Locals))
+				}
+			case operandFree:
+				if operand >= len(fn.Free) {
+					return fmt.Errorf("%s at %d uses captured variable %d of %d", def.Name, ip, operand, len(fn.Free))
+				}
+			case operandConstant, operandString, operandNames, operandEnum, operandFunction:
+				if operand >= len(constants) {
+					return fmt.Errorf("%s at %d uses constant %d of %d", def.Name, ip, operand, len(constants))
+				}
+				if err := verifyConstant(kind, constants[operand], fn); err != nil {
+					return fmt.Errorf("%s at %d: constant %d %w", def.Name, ip, operand, err)
+				}
+			}
+		}
+
+		switch op {
+		case OpCallArgs:
+			names := constants[operands[1]].(*object.Array)
+			if operands[0] > len(names.Elements) {
+				return fmt.Errorf("%s at %d has %d named arguments but %d names", def.Name, ip, operands[0], len(names.Elements))
+			}
+		case OpClass, OpStruct, OpMatchVariant:
+			min := 1
+			if op == OpMatchVariant {
+				min = 2
+			}
+			if names := constants[operands[0]].(*object.Array); len(names.Elements) < min {
+				return fmt.Errorf("%s at %d: constant %d has %d names, want at least %d", def.Name, ip, operands[0], len(names.Elements), min)
+			}
+		}
+
+		starts[ip] = op
+		last = op
+		ip += 1 + width
+	}
+
+	if last != OpReturnValue && last != OpReturn {
+		return fmt.Errorf("instructions do not end with a return")
+	}
+
+	for _, target := range jumps {
+		if _, ok := starts[target]; !ok {
+			return fmt.Errorf("jump to %d is not the start of an instruction", target)
+		}
+	}
+
+	for i, call := range fn.Calls {
+		if op, ok := starts[call.Offset]; !ok || (op != OpCall && op != OpCallArgs) {
+			return fmt.Errorf("call site %d is not a call", call.Offset)
+		}
+		if i > 0 && call.Offset <= fn.Calls[i-1].Offset {
+			return fmt.Errorf("call sites are out of order")
+		}
+	}
+
+	return verifyStack(fn, constants)
+}
+
+// stackState is the depth of the stack of a function before an
+// instruction, and the depths at which the patterns being matched were
+// marked.
+type stackState struct {
+	depth int
+	marks []int
+}
+
+func (s stackState) equal(other stackState) bool {
+	return s.depth == other.depth && slices.Equal(s.marks, other.marks)
+}
+
+// verifyStack follows every path through the instructions of fn, which
+// verifyFunction has checked are whole and jump to instructions, and
+// checks their use of the stack.
+func verifyStack(fn *Function, constants []object.Object) error {
+	ins := fn.Instructions
+	states := map[int]stackState{0: {}}
+	work := []int{0}
+
+	// reach records that the instruction at ip is reached with state.
+	reach := func(from, ip int, state stackState) error {
+		if ip >= len(ins) {
+			return fmt.Errorf("instruction at %d runs past the end", from)
+		}
+		if seen, ok := states[ip]; ok {
+			if !seen.equal(state) {
+				return fmt.Errorf("instruction at %d is reached with stack depths %d and %d", ip, seen.depth, state.depth)
+			}
+			return nil
+		}
+		states[ip] = state
+		work = append(work, ip)
+		return nil
+	}
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		state := states[ip]
+
+		op := Opcode(ins[ip])
+		def := definitions[op]
+		operands, width := ReadOperands(def, ins[ip+1:])
+		next := ip + 1 + width
+
+		need, effect := stackEffect(op, operands, constants)
+		if state.depth < need {
+			return fmt.Errorf("%s at %d needs a stack of depth %d, got %d", def.Name, ip, need, state.depth)
+		}
+		after := stackState{depth: state.depth + effect, marks: state.marks}
+
+		var err error
+		switch op {
+		case OpReturnValue, OpReturn, OpThrow, OpFail, OpNoMatch:
+		case OpJump:
+			err = reach(ip, operands[0], after)
+		case OpJumpIfFalse, OpParamDefault:
+			if err = reach(ip, operands[len(operands)-1], after); err == nil {
+				err = reach(ip, next, after)
+			}
+		case OpDefault:
+			// A missing value is dropped for its default to replace it.
+			if err = reach(ip, operands[0], after); err == nil {
+				err = reach(ip, next, stackState{depth: after.depth - 1, marks: after.marks})
+			}
+		case OpMark:
+			after.marks = append(slices.Clip(state.marks), state.depth)
+			err = reach(ip, next, after)
+		case OpUnmark:
+			if len(state.marks) == 0 {
+				return fmt.Errorf("%s at %d has no mark", def.Name, ip)
+			}
+			after.marks = state.marks[:len(state.marks)-1]
+			err = reach(ip, next, after)
+		case OpMatchEqual, OpMatchRange, OpMatchArray, OpMatchHash, OpMatchVariant, OpField:
+			fail := operands[1]
+			if op == OpField {
+				fail = operands[2]
+			}
+			if fail != NoMatch {
+				if len(state.marks) == 0 {
+					return fmt.Errorf("%s at %d has no mark", def.Name, ip)
+				}
+				marks := state.marks[:len(state.marks)-1]
+				if err = reach(ip, fail, stackState{depth: state.marks[len(state.marks)-1], marks: marks}); err != nil {
+					return err
+				}
+			}
+			err = reach(ip, next, after)
+		default:
+			err = reach(ip, next, after)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns the number of values the instruction op with
+// operands needs on the stack, and by how much it changes the depth of the
+// stack. verifyFunction has checked the constants the operands index.
+func stackEffect(op Opcode, operands []int, constants []object.Object) (need, effect int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNil, OpGetGlobal, OpGetLocal, OpGetFree,
+		OpClosure, OpStruct, OpEnum, OpImport:
+		return 0, 1
+	case OpPop, OpJumpIfFalse, OpDefineGlobal, OpSetLocal, OpSetFree,
+		OpReturnValue, OpThrow, OpNoMatch:
+		return 1, -1
+	case OpDup:
+		return 1, 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpEqual, OpNotEqual,
+		OpLess, OpGreater, OpLessEqual, OpGreaterEqual, OpIndex, OpSetMember:
+		return 2, -1
+	case OpSetIndex:
+		return 3, -2
+	case OpAppend, OpSpread, OpMatchVariant:
+		return 2, -1
+	case OpMinus, OpBang, OpMember, OpVariant, OpWrapReturn, OpArrayRest,
+		OpHashRest, OpImportName, OpAssignGlobal, OpCheckWith, OpElement,
+		OpMatchArray, OpMatchHash, OpField, OpDefault:
+		return 1, 0
+	case OpCall:
+		return operands[0] + 1, -operands[0]
+	case OpCallArgs:
+		// The callee, the array of positional arguments and the named ones.
+		return operands[0] + 2, -operands[0] - 1
+	case OpArray:
+		return operands[0], 1 - operands[0]
+	case OpHash:
+		return 2 * operands[0], 1 - 2*operands[0]
+	case OpWith:
+		n := len(constants[operands[0]].(*object.Array).Elements)
+		return n + 1, -n
+	case OpClass:
+		n := len(constants[operands[0]].(*object.Array).Elements) - 1
+		if operands[1] == 1 {
+			n++
+		}
+		return n, 1 - n
+	case OpTry:
+		n := 1
+		if operands[0]&TryCatch != 0 {
+			n++
+		}
+		if operands[0]&TryFinally != 0 {
+			n++
+		}
+		return n, 1 - n
+	case OpMatchEqual:
+		return 2, -2
+	case OpMatchRange:
+		return 3, -3
+	default:
+		return 0, 0
+	}
+}
+
+// verifyConstant checks that constant is of the kind an operand of a
+// function in fn expects.
+func verifyConstant(kind int, constant object.Object, fn *Function) error {
+	switch kind {
+	case operandConstant:
+		if _, ok := constant.(*Function); ok {
+			return fmt.Errorf("is a function")
+		}
+	case operandString:
+		if _, ok := constant.(*object.String); !ok {
+			return fmt.Errorf("is not a string")
+		}
+	case operandNames:
+		if !isNames(constant) {
+			return fmt.Errorf("is not an array of strings")
+		}
+	case operandEnum:
+		// An enum is described by its name followed by the names of each
+		// variant and its fields.
+		array, ok := constant.(*object.Array)
+		if !ok || len(array.Elements) == 0 {
+			return fmt.Errorf("is not an enum")
+		}
+		if _, ok := array.Elements[0].(*object.String); !ok {
+			return fmt.Errorf("is not an enum")
+		}
+		for _, variant := range array.Elements[1:] {
+			if !isNames(variant) || len(variant.(*object.Array).Elements) == 0 {
+				return fmt.Errorf("is not an enum")
+			}
+		}
+	case operandFunction:
+		closure, ok := constant.(*Function)
+		if !ok {
+			return fmt.Errorf("is not a function")
+		}
+		// The closure captures variables of fn, which creates it.
+		for _, capture := range closure.Free {
+			switch capture.Kind {
+			case CaptureLocal:
+				if capture.Index < 0 || capture.Index >= len(fn.Locals) {
+					return fmt.Errorf("captures slot %d of %d", capture.Index, len(fn.Locals))
+				}
+			case CaptureFree:
+				if capture.Index < 0 || capture.Index >= len(fn.Free) {
+					return fmt.Errorf("captures variable %d of %d", capture.Index, len(fn.Free))
+				}
+			case CaptureSelf, CaptureSuper:
+			default:
+				return fmt.Errorf("has capture of unknown kind %d", capture.Kind)
+			}
+		}
+	}
+	return nil
+}
+
+func isNames(constant object.Object) bool {
+	array, ok := constant.(*object.Array)
+	if !ok {
+		return false
+	}
+	for _, el := range array.Elements {
+		if _, ok := el.(*object.String); !ok {
+			return false
+		}
+	}
+	return true
+}
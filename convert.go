@@ -0,0 +1,611 @@
+package saphire
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// applyFunc calls a callable Saphire object. Conversions made outside of a
+// Runtime can only call builtins.
+type applyFunc func(fn object.Object, args []object.Object) object.Object
+
+func applyBuiltin(fn object.Object, args []object.Object) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		return builtin.Fn(args...)
+	}
+	return &object.Error{Message: fmt.Sprintf("cannot call %s outside of a runtime", fn.Type())}
+}
+
+// ToObject converts a Go value to its Saphire representation:
+//
+//   - nil and nil pointers become nil
+//   - bools become booleans, integers and floats become numbers
+//   - strings become strings
+//   - slices and arrays become arrays
+//   - maps with string, number or bool keys become hashes
+//   - structs become hashes keyed by field name, or by the `saphire` tag;
+//     fields tagged `saphire:"-"` and unexported fields are skipped
+//   - funcs become builtins whose arguments and results are converted with
+//     FromObject and ToObject; a trailing error result becomes a Saphire error
+//
+// Values that already implement object.Object are returned unchanged.
+func ToObject(v any) (object.Object, error) {
+	if v == nil {
+		return interpreter.NIL, nil
+	}
+	return toObject(reflect.ValueOf(v), applyBuiltin)
+}
+
+// FromObject stores the Go representation of obj in the value pointed to by
+// target, following the rules of ToObject in reverse. Assigning to an `any`
+// yields float64, string, bool, nil, []any and map[string]any (or map[any]any
+// for hashes with non-string keys); Saphire structs become map[string]any
+// or fill a Go struct like hashes do, and functions are kept as
+// object.Object.
+//
+// Functions assigned to a Go func type report Saphire errors through a
+// trailing error result. Calls to a func type without one panic with the
+// error instead.
+func FromObject(obj object.Object, target any) error {
+	return fromObject(obj, target, applyBuiltin)
+}
+
+func fromObject(obj object.Object, target any, apply applyFunc) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("saphire: FromObject target must be a non-nil pointer, got %T", target)
+	}
+	return assign(obj, rv.Elem(), apply)
+}
+
+func toObject(rv reflect.Value, apply applyFunc) (object.Object, error) {
+	if !rv.IsValid() {
+		return interpreter.NIL, nil
+	}
+
+	if rv.Type().Implements(objectType) {
+		if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return interpreter.NIL, nil
+		}
+		return rv.Interface().(object.Object), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return interpreter.TRUE, nil
+		}
+		return interpreter.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Number{Value: float64(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &object.Number{Value: float64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Number{Value: rv.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return interpreter.NIL, nil
+		}
+		return toObject(rv.Elem(), apply)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return interpreter.NIL, nil
+		}
+
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			element, err := toObject(rv.Index(i), apply)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return interpreter.NIL, nil
+		}
+
+		pairs := make(map[object.HashKey]object.HashPair, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key(), apply)
+			if err != nil {
+				return nil, err
+			}
+
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("saphire: unusable as hash key: %s", key.Type())
+			}
+
+			value, err := toObject(iter.Value(), apply)
+			if err != nil {
+				return nil, err
+			}
+
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Struct:
+		pairs := make(map[object.HashKey]object.HashPair)
+		for _, field := range structFields(rv.Type()) {
+			// Fields promoted through a nil embedded pointer are left out.
+			fv, err := rv.FieldByIndexErr(field.index)
+			if err != nil {
+				continue
+			}
+
+			value, err := toObject(fv, apply)
+			if err != nil {
+				return nil, err
+			}
+
+			key := &object.String{Value: field.name}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return interpreter.NIL, nil
+		}
+		return funcToBuiltin("<host>", rv, apply), nil
+	default:
+		return nil, fmt.Errorf("saphire: cannot convert %s to a Saphire value", rv.Type())
+	}
+}
+
+func funcToBuiltin(name string, fn reflect.Value, apply applyFunc) *object.Builtin {
+	fnType := fn.Type()
+	numIn := fnType.NumIn()
+
+	minArgs, maxArgs := numIn, numIn
+	if fnType.IsVariadic() {
+		minArgs, maxArgs = numIn-1, -1
+	}
+
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := interpreter.CheckArity(name, args, minArgs, maxArgs); err != nil {
+			return err
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if fnType.IsVariadic() && i >= numIn-1 {
+				paramType = fnType.In(numIn - 1).Elem()
+			} else {
+				paramType = fnType.In(i)
+			}
+
+			value := reflect.New(paramType).Elem()
+			if err := assign(arg, value, apply); err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d: %s", i+1, err)}
+			}
+			in[i] = value
+		}
+
+		return resultsToObject(fn.Call(in), apply)
+	}}
+}
+
+func resultsToObject(results []reflect.Value, apply applyFunc) object.Object {
+	if n := len(results); n > 0 && results[n-1].Type() == errorType {
+		if err, _ := results[n-1].Interface().(error); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		results = results[:n-1]
+	}
+
+	objects := make([]object.Object, len(results))
+	for i, result := range results {
+		obj, err := toObject(result, apply)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		objects[i] = obj
+	}
+
+	switch len(objects) {
+	case 0:
+		return interpreter.NIL
+	case 1:
+		return objects[0]
+	default:
+		return &object.Array{Elements: objects}
+	}
+}
+
+func assign(obj object.Object, target reflect.Value, apply applyFunc) error {
+	targetType := target.Type()
+
+	// Blocks ending with a statement that is not an expression, like a
+	// function whose body ends with let, evaluate to no object at all.
+	if obj == nil {
+		obj = interpreter.NIL
+	}
+
+	if objValue := reflect.ValueOf(obj); objValue.Type().AssignableTo(targetType) {
+		if targetType.Kind() != reflect.Interface || targetType.NumMethod() > 0 {
+			target.Set(objValue)
+			return nil
+		}
+	}
+
+	if obj.Type() == object.NIL_OBJ {
+		switch targetType.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			target.Set(reflect.Zero(targetType))
+			return nil
+		}
+	}
+
+	switch targetType.Kind() {
+	case reflect.Interface:
+		if targetType.NumMethod() > 0 {
+			break
+		}
+
+		value, err := toGo(obj)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			target.Set(reflect.Zero(targetType))
+		} else {
+			target.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			target.SetBool(b.Value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := obj.(*object.Number); ok {
+			if !isInteger(n.Value, targetType.Bits(), true) {
+				return fmt.Errorf("cannot convert %v to %s", n.Value, targetType)
+			}
+			target.SetInt(int64(n.Value))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := obj.(*object.Number); ok {
+			if !isInteger(n.Value, targetType.Bits(), false) {
+				return fmt.Errorf("cannot convert %v to %s", n.Value, targetType)
+			}
+			target.SetUint(uint64(n.Value))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := obj.(*object.Number); ok {
+			target.SetFloat(n.Value)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			target.SetString(s.Value)
+			return nil
+		}
+	case reflect.Pointer:
+		value := reflect.New(targetType.Elem())
+		if err := assign(obj, value.Elem(), apply); err != nil {
+			return err
+		}
+		target.Set(value)
+		return nil
+	case reflect.Slice:
+		if arr, ok := obj.(*object.Array); ok {
+			slice := reflect.MakeSlice(targetType, len(arr.Elements), len(arr.Elements))
+			for i, element := range arr.Elements {
+				if err := assign(element, slice.Index(i), apply); err != nil {
+					return fmt.Errorf("index %d: %w", i, err)
+				}
+			}
+			target.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if arr, ok := obj.(*object.Array); ok {
+			if len(arr.Elements) != targetType.Len() {
+				return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(arr.Elements), targetType)
+			}
+			for i, element := range arr.Elements {
+				if err := assign(element, target.Index(i), apply); err != nil {
+					return fmt.Errorf("index %d: %w", i, err)
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if hash, ok := obj.(*object.Hash); ok {
+			m := reflect.MakeMapWithSize(targetType, len(hash.Pairs))
+			for _, pair := range hash.Pairs {
+				key := reflect.New(targetType.Key()).Elem()
+				if err := assign(pair.Key, key, apply); err != nil {
+					return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+
+				value := reflect.New(targetType.Elem()).Elem()
+				if err := assign(pair.Value, value, apply); err != nil {
+					return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+
+				m.SetMapIndex(key, value)
+			}
+			target.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if hash, ok := obj.(*object.Hash); ok {
+			for _, field := range structFields(targetType) {
+				key := &object.String{Value: field.name}
+				pair, ok := hash.Pairs[key.HashKey()]
+				if !ok {
+					continue
+				}
+				fv, err := fieldByIndex(target, field.index)
+				if err == nil {
+					err = assign(pair.Value, fv, apply)
+				}
+				if err != nil {
+					return fmt.Errorf("field %s: %w", field.name, err)
+				}
+			}
+			return nil
+		}
+		if s, ok := obj.(*object.Struct); ok {
+			for _, field := range structFields(targetType) {
+				value, ok := s.Get(field.name)
+				if !ok {
+					continue
+				}
+				fv, err := fieldByIndex(target, field.index)
+				if err == nil {
+					err = assign(value, fv, apply)
+				}
+				if err != nil {
+					return fmt.Errorf("field %s: %w", field.name, err)
+				}
+			}
+			return nil
+		}
+	case reflect.Func:
+		switch obj.Type() {
+		case object.FUNCTION_OBJ, object.BUILTIN_OBJ:
+			target.Set(objectToFunc(obj, targetType, apply))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), targetType)
+}
+
+func objectToFunc(fn object.Object, fnType reflect.Type, apply applyFunc) reflect.Value {
+	numOut := fnType.NumOut()
+	returnsError := numOut > 0 && fnType.Out(numOut-1) == errorType
+
+	return reflect.MakeFunc(fnType, func(in []reflect.Value) []reflect.Value {
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				panic(err)
+			}
+
+			out := make([]reflect.Value, numOut)
+			for i := range out[:numOut-1] {
+				out[i] = reflect.Zero(fnType.Out(i))
+			}
+			out[numOut-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		if fnType.IsVariadic() {
+			last := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := 0; i < last.Len(); i++ {
+				in = append(in, last.Index(i))
+			}
+		}
+
+		args := make([]object.Object, len(in))
+		for i, arg := range in {
+			obj, err := toObject(arg, apply)
+			if err != nil {
+				return fail(err)
+			}
+			args[i] = obj
+		}
+
+		result := apply(fn, args)
+		if errObj, ok := result.(*object.Error); ok {
+			return fail(&RuntimeError{Object: errObj})
+		}
+
+		values := numOut
+		if returnsError {
+			values--
+		}
+
+		out := make([]reflect.Value, 0, numOut)
+		switch values {
+		case 0:
+		case 1:
+			value := reflect.New(fnType.Out(0)).Elem()
+			if err := assign(result, value, apply); err != nil {
+				return fail(err)
+			}
+			out = append(out, value)
+		default:
+			arr, ok := result.(*object.Array)
+			if !ok || len(arr.Elements) != values {
+				return fail(fmt.Errorf("cannot convert %s to %d results", result.Type(), values))
+			}
+			for i, element := range arr.Elements {
+				value := reflect.New(fnType.Out(i)).Elem()
+				if err := assign(element, value, apply); err != nil {
+					return fail(err)
+				}
+				out = append(out, value)
+			}
+		}
+
+		if returnsError {
+			out = append(out, reflect.Zero(errorType))
+		}
+		return out
+	})
+}
+
+// toGo converts obj to the natural Go value used when the target is `any`.
+func toGo(obj object.Object) (any, error) {
+	return toGoValue(obj, make(map[object.Object]bool))
+}
+
+// toGoValue is toGo for an element of the containers in seen, which are
+// being converted. Go values cannot refer to themselves the way arrays and
+// hashes assigned into themselves do, so a container within itself is an
+// error.
+func toGoValue(obj object.Object, seen map[object.Object]bool) (any, error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash, *object.Struct:
+		if seen[obj] {
+			return nil, fmt.Errorf("cannot convert %s that contains itself", obj.Type())
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *object.Nil:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Number:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := toGoValue(element, seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		stringKeys := make(map[string]any, len(obj.Pairs))
+		anyKeys := make(map[any]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := toGoValue(pair.Key, seen)
+			if err != nil {
+				return nil, err
+			}
+			value, err := toGoValue(pair.Value, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			if s, ok := key.(string); ok {
+				stringKeys[s] = value
+			}
+			anyKeys[key] = value
+		}
+
+		if len(stringKeys) == len(anyKeys) {
+			return stringKeys, nil
+		}
+		return anyKeys, nil
+	case *object.Struct:
+		fields := make(map[string]any, len(obj.Values))
+		for i, element := range obj.Values {
+			value, err := toGoValue(element, seen)
+			if err != nil {
+				return nil, err
+			}
+			fields[obj.StructType.Fields[i]] = value
+		}
+		return fields, nil
+	case *object.Error:
+		return nil, errors.New(obj.Message)
+	default:
+		return obj, nil
+	}
+}
+
+// isInteger reports whether v is a whole number in the range of the
+// integers of size bits, signed or not, which converts to them exactly.
+// Fractions, NaN and infinities are not.
+func isInteger(v float64, bits int, signed bool) bool {
+	if v != math.Trunc(v) || math.IsInf(v, 0) {
+		return false
+	}
+	if signed {
+		limit := math.Ldexp(1, bits-1)
+		return v >= -limit && v < limit
+	}
+	return v >= 0 && v < math.Ldexp(1, bits)
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but allocates the nil
+// embedded pointers the field is promoted through, so that it can be set.
+// Pointers to unexported structs cannot be set, as in encoding/json.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("saphire"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+
+	return fields
+}
@@ -0,0 +1,333 @@
+package saphire
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/darwin1224/saphire/object"
+)
+
+type point struct {
+	X       float64 `saphire:"x"`
+	Y       float64 `saphire:"y"`
+	Label   string
+	Ignored int `saphire:"-"`
+	hidden  int
+}
+
+type Coords struct {
+	X, Y float64
+}
+
+type labeled struct {
+	*Coords
+	Name string `saphire:"name"`
+}
+
+type labeledPoint struct {
+	*point
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{42, "42.00"},
+		{uint8(7), "7.00"},
+		{1.5, "1.50"},
+		{"saphire", "saphire"},
+		{[]int{1, 2, 3}, "[1.00, 2.00, 3.00]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string]int{"one": 1}, "{one: 1.00}"},
+		{(*point)(nil), "nil"},
+		{&object.String{Value: "as is"}, "as is"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong. got=%q, want=%q", tt.input, obj.Inspect(), tt.expected)
+		}
+	}
+
+	if _, err := ToObject(make(chan int)); err == nil {
+		t.Errorf("expected error converting chan")
+	}
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	obj, err := ToObject(point{X: 1, Y: 2, Label: "p", Ignored: 3, hidden: 4})
+	if err != nil {
+		t.Fatalf("ToObject returned error: %s", err)
+	}
+
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		t.Fatalf("object is not Hash. got=%T", obj)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+	}
+
+	var p point
+	if err := FromObject(obj, &p); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if p != (point{X: 1, Y: 2, Label: "p"}) {
+		t.Errorf("struct round trip wrong. got=%+v", p)
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	rt := New()
+	result, err := rt.Run(`{"name": "saphire", "tags": ["a", "b"], "ok": true}`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	var generic any
+	if err := FromObject(result, &generic); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	expected := map[string]any{"name": "saphire", "tags": []any{"a", "b"}, "ok": true}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("generic conversion wrong. got=%#v", generic)
+	}
+
+	var typed struct {
+		Name string   `saphire:"name"`
+		Tags []string `saphire:"tags"`
+	}
+	if err := FromObject(result, &typed); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if typed.Name != "saphire" || !reflect.DeepEqual(typed.Tags, []string{"a", "b"}) {
+		t.Errorf("typed conversion wrong. got=%+v", typed)
+	}
+
+	var n int
+	if err := FromObject(&object.Number{Value: 1.5}, &n); err == nil {
+		t.Errorf("expected error converting 1.5 to int")
+	}
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e19, -1e19, 0x1p63} {
+		if err := FromObject(&object.Number{Value: v}, &n); err == nil {
+			t.Errorf("expected error converting %v to int", v)
+		}
+	}
+	var b uint8
+	for _, v := range []float64{-1, 256, math.Inf(1)} {
+		if err := FromObject(&object.Number{Value: v}, &b); err == nil {
+			t.Errorf("expected error converting %v to uint8", v)
+		}
+	}
+	if err := FromObject(&object.Number{Value: 255}, &b); err != nil || b != 255 {
+		t.Errorf("255 not converted to uint8. got=%d (%v)", b, err)
+	}
+	if err := FromObject(&object.Number{Value: -0x1p63}, &n); err != nil || n != math.MinInt64 {
+		t.Errorf("-2^63 not converted to int. got=%d (%v)", n, err)
+	}
+	if err := FromObject(&object.String{Value: "x"}, &n); err == nil {
+		t.Errorf("expected error converting STRING to int")
+	}
+	if err := FromObject(&object.Number{Value: 1}, n); err == nil {
+		t.Errorf("expected error for non-pointer target")
+	}
+
+	cyclic, err := rt.Run("let xs = [1]; xs[0] = xs; xs")
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if err := FromObject(cyclic, &generic); err == nil {
+		t.Errorf("expected error converting an array that contains itself")
+	}
+
+	var obj object.Object
+	if err := FromObject(result, &obj); err != nil || obj != result {
+		t.Errorf("object.Object target should receive the object itself. got=%v (%v)", obj, err)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	rt := New()
+
+	rt.RegisterFunc("join", func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	})
+	rt.RegisterFunc("check", func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative input")
+		}
+		return n * 2, nil
+	})
+	rt.RegisterFunc("apply", func(f func(float64) float64, x float64) float64 {
+		return f(x)
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`join("-", "a", "b", "c")`, "a-b-c"},
+		{`check(21)`, "42.00"},
+		{`apply(fn(x) { x * x }, 3)`, "9.00"},
+	}
+
+	for _, tt := range tests {
+		result, err := rt.Run(tt.input)
+		if err != nil {
+			t.Errorf("Run(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("Run(%q) wrong. got=%q, want=%q", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`check(-1)`, "negative input"},
+		{`check("x")`, "argument 1: cannot convert STRING to int"},
+		{`check()`, "function `check` expects 1 argument, got 0"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := rt.Run(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Run(%q) wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+
+	if err := rt.RegisterFunc("bad", 42); err == nil {
+		t.Errorf("expected error registering non-func")
+	}
+}
+
+func TestFromObjectFunc(t *testing.T) {
+	rt := New()
+	if _, err := rt.Run(`let add = fn(x, y) { x + y }; let fail = fn() { 1 + true }`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	addObj, _ := rt.Get("add")
+	var add func(int, int) int
+	if err := rt.FromObject(addObj, &add); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if got := add(2, 3); got != 5 {
+		t.Errorf("converted function returned wrong value. got=%d", got)
+	}
+
+	failObj, _ := rt.Get("fail")
+	var fail func() (float64, error)
+	if err := rt.FromObject(failObj, &fail); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if _, err := fail(); err == nil {
+		t.Errorf("expected error from failing function")
+	}
+
+	if _, err := rt.Run(`let noValue = fn() { let y = 1 }`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	noValueObj, _ := rt.Get("noValue")
+	var noValue func() (any, error)
+	if err := rt.FromObject(noValueObj, &noValue); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if got, err := noValue(); got != nil || err != nil {
+		t.Errorf("wrong result of function without a value. got=%v, %v", got, err)
+	}
+
+	var mustFail func() float64
+	if err := rt.FromObject(failObj, &mustFail); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	defer func() {
+		if _, ok := recover().(*RuntimeError); !ok {
+			t.Errorf("expected a panic with a *RuntimeError")
+		}
+	}()
+	mustFail()
+}
+
+func TestEmbeddedPointers(t *testing.T) {
+	obj, err := ToObject(labeled{Name: "origin"})
+	if err != nil {
+		t.Fatalf("ToObject returned error: %s", err)
+	}
+	if obj.Inspect() != "{name: origin}" {
+		t.Errorf("fields of nil embedded pointer not left out. got=%q", obj.Inspect())
+	}
+
+	rt := New()
+	result, err := rt.Run(`{"name": "p", "X": 1, "Y": 2}`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	var l labeled
+	if err := FromObject(result, &l); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if l.Name != "p" || l.Coords == nil || l.X != 1 || l.Y != 2 {
+		t.Errorf("embedded pointer not allocated. got=%+v", l)
+	}
+
+	if err := FromObject(obj, &l); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if l.Name != "origin" || l.X != 1 {
+		t.Errorf("missing fields should be left alone. got=%+v", l)
+	}
+
+	var lp labeledPoint
+	if err := FromObject(result, &lp); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	point, err := rt.Run(`{"x": 1}`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if err := FromObject(point, &lp); err == nil {
+		t.Errorf("expected error setting a field of an unexported embedded pointer")
+	}
+}
+
+func TestFromObjectStruct(t *testing.T) {
+	rt := New()
+	result, err := rt.Run(`struct Point { x, y }; Point(1, 2)`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	var generic any
+	if err := FromObject(result, &generic); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if !reflect.DeepEqual(generic, map[string]any{"x": 1.0, "y": 2.0}) {
+		t.Errorf("generic conversion wrong. got=%#v", generic)
+	}
+
+	var typed struct {
+		X float64 `saphire:"x"`
+		Y float64 `saphire:"y"`
+	}
+	if err := FromObject(result, &typed); err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if typed.X != 1 || typed.Y != 2 {
+		t.Errorf("typed conversion wrong. got=%+v", typed)
+	}
+}
@@ -0,0 +1,425 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/parser"
+	"github.com/darwin1224/saphire/token"
+)
+
+// infix reports whether exp is made of an operator between two operands,
+// whose precedence decides where it needs parentheses.
+func infix(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.BinaryExpression, *ast.AssignExpression:
+		return true
+	}
+	return false
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.BinaryExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	}
+	return parser.INDEX
+}
+
+// open reports whether exp ends with an expression that would take in an
+// operator following it, like the body of `|x| x + 1` or the value of
+// `throw err`. Such an expression needs parentheses before an operator.
+func open(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral:
+		return exp.Token.Type == token.PIPE && exp.Body.Token.Type != token.LBRACE
+	case *ast.ThrowExpression:
+		return true
+	case *ast.UnaryExpression:
+		return !infix(exp.Right) && open(exp.Right)
+	case *ast.SpreadExpression:
+		return !infix(exp.Value) && open(exp.Value)
+	case *ast.BinaryExpression:
+		return !rightParens(exp) && open(exp.Right)
+	case *ast.AssignExpression:
+		return open(exp.Value)
+	}
+	return false
+}
+
+// leftParens reports whether the left operand of exp needs parentheses.
+// Operators are left associative, so an operand of the same precedence
+// does not.
+func leftParens(exp *ast.BinaryExpression) bool {
+	left := exp.Left
+	return infix(left) && precedence(left) < precedence(exp) || open(left)
+}
+
+func rightParens(exp *ast.BinaryExpression) bool {
+	right := exp.Right
+	return infix(right) && precedence(right) <= precedence(exp)
+}
+
+// operandParens reports whether exp needs parentheses as the operand of a
+// postfix operator: a call, index, member access or with expression.
+func operandParens(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.UnaryExpression, *ast.SpreadExpression:
+		return true
+	}
+	return infix(exp) || open(exp)
+}
+
+func (p *printer) operand(exp ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+		p.expression(exp)
+		p.write(")")
+		return
+	}
+	p.expression(exp)
+}
+
+// start returns the position of the first token of exp.
+func start(exp ast.Expression) pos {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return posOf(exp.Token)
+	case *ast.NumberLiteral:
+		return posOf(exp.Token)
+	case *ast.StringLiteral:
+		return posOf(exp.Token)
+	case *ast.Boolean:
+		return posOf(exp.Token)
+	case *ast.UnaryExpression:
+		return posOf(exp.Token)
+	case *ast.BinaryExpression:
+		return start(exp.Left)
+	case *ast.IfExpression:
+		return posOf(exp.Token)
+	case *ast.FunctionLiteral:
+		return posOf(exp.Token)
+	case *ast.CallExpression:
+		return start(exp.Function)
+	case *ast.SpreadExpression:
+		return posOf(exp.Token)
+	case *ast.NamedArgument:
+		return posOf(exp.Token)
+	case *ast.ArrayLiteral:
+		return posOf(exp.Token)
+	case *ast.IndexExpression:
+		return start(exp.Left)
+	case *ast.MemberExpression:
+		return start(exp.Object)
+	case *ast.HashLiteral:
+		return posOf(exp.Token)
+	case *ast.MatchExpression:
+		return posOf(exp.Token)
+	case *ast.ThrowExpression:
+		return posOf(exp.Token)
+	case *ast.TryExpression:
+		return posOf(exp.Token)
+	case *ast.WithExpression:
+		return start(exp.Left)
+	case *ast.AssignExpression:
+		return start(exp.Target)
+	}
+	return pos{}
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+
+	case *ast.NumberLiteral:
+		p.write(exp.Token.Literal)
+
+	case *ast.StringLiteral:
+		p.write(`"` + exp.Value + `"`)
+
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+
+	case *ast.UnaryExpression:
+		p.write(exp.Operator)
+		p.operand(exp.Right, infix(exp.Right))
+
+	case *ast.BinaryExpression:
+		p.operand(exp.Left, leftParens(exp))
+		p.write(" " + exp.Operator + " ")
+		p.operand(exp.Right, rightParens(exp))
+
+	case *ast.AssignExpression:
+		p.expression(exp.Target)
+		p.write(" = ")
+		p.expression(exp.Value)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		if exp.Token.Type == token.PIPE {
+			p.parameters("|", "| ", exp.Parameters)
+			p.body(exp.Body)
+			return
+		}
+		p.write("fn")
+		p.parameters("(", ") ", exp.Parameters)
+		p.block(exp.Body)
+
+	case *ast.CallExpression:
+		p.operand(exp.Function, operandParens(exp.Function))
+		from := posOf(exp.Token)
+		p.list("(", ")", from, p.src.closes[from], len(exp.Arguments),
+			func(i int) pos { return start(exp.Arguments[i]) },
+			func(p *printer, i int) { p.expression(exp.Arguments[i]) },
+			false)
+
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.operand(exp.Value, infix(exp.Value))
+
+	case *ast.NamedArgument:
+		p.write(exp.Name.Value + ": ")
+		p.expression(exp.Value)
+
+	case *ast.ArrayLiteral:
+		from := posOf(exp.Token)
+		p.list("[", "]", from, p.src.closes[from], len(exp.Elements),
+			func(i int) pos { return start(exp.Elements[i]) },
+			func(p *printer, i int) { p.expression(exp.Elements[i]) },
+			false)
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, operandParens(exp.Left))
+		p.write("[")
+		p.expression(exp.Index)
+		p.write("]")
+
+	case *ast.MemberExpression:
+		p.operand(exp.Object, operandParens(exp.Object))
+		p.write("." + exp.Property.Value)
+
+	case *ast.HashLiteral:
+		keys := exp.OrderedKeys()
+		from := posOf(exp.Token)
+		p.list("{", "}", from, p.src.closes[from], len(keys),
+			func(i int) pos { return start(keys[i]) },
+			func(p *printer, i int) {
+				p.expression(keys[i])
+				p.write(": ")
+				p.expression(exp.Pairs[keys[i]])
+			},
+			false)
+
+	case *ast.WithExpression:
+		p.operand(exp.Left, operandParens(exp.Left))
+		p.write(" with ")
+		from := p.src.next(posOf(exp.Token))
+		p.list("{", "}", from, p.src.closes[from], len(exp.Fields),
+			func(i int) pos { return posOf(exp.Fields[i].Name.Token) },
+			func(p *printer, i int) {
+				p.write(exp.Fields[i].Name.Value + ": ")
+				p.expression(exp.Fields[i].Value)
+			},
+			true)
+
+	case *ast.MatchExpression:
+		p.match(exp)
+
+	case *ast.ThrowExpression:
+		p.write("throw ")
+		p.expression(exp.Value)
+
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		if exp.Catch != nil {
+			p.write(" catch ")
+			if exp.Param != nil {
+				p.write("(")
+				p.pattern(exp.Param)
+				p.write(") ")
+			}
+			p.block(exp.Catch)
+		}
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+	}
+}
+
+// body prints the body of a lambda or match arm, which is a block or a
+// single expression.
+func (p *printer) body(body *ast.BlockStatement) {
+	if body.Token.Type == token.LBRACE {
+		p.block(body)
+		return
+	}
+
+	exp := body.Statements[0].(*ast.ExpressionStatement).Expression
+
+	// A body starting with a brace is kept in parentheses, since empty
+	// braces parse as a block.
+	q := p.measure()
+	q.expression(exp)
+	p.operand(exp, strings.HasPrefix(q.out.String(), "{"))
+}
+
+func (p *printer) match(exp *ast.MatchExpression) {
+	p.write("match (")
+	p.expression(exp.Subject)
+	p.write(") ")
+
+	subject := p.src.next(posOf(exp.Token))
+	open := p.src.next(p.src.closes[subject])
+	close := p.src.closes[open]
+	if len(exp.Arms) == 0 && !p.hasComments(open, close) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.line()
+	for i, arm := range exp.Arms {
+		p.comments(posOf(arm.Token), i == 0, false)
+		p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			p.write(" if ")
+			p.expression(arm.Guard)
+		}
+		p.write(" => ")
+		p.body(arm.Body)
+		if i < len(exp.Arms)-1 && arm.Body.Token.Type != token.LBRACE {
+			p.write(",")
+		}
+		p.line()
+	}
+	p.comments(close, len(exp.Arms) == 0, true)
+	p.indent--
+	p.write("}")
+}
+
+func (p *printer) parameters(open, close string, params []*ast.Parameter) {
+	p.write(open)
+	for i, param := range params {
+		if i > 0 {
+			p.write(", ")
+		}
+		if param.Variadic {
+			p.write("...")
+		}
+		if param.Pattern != nil {
+			p.pattern(param.Pattern)
+		} else {
+			p.write(param.Name.Value)
+		}
+		if param.Default != nil {
+			p.write(" = ")
+			p.expression(param.Default)
+		}
+	}
+	p.write(close)
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		p.write(pattern.Value)
+
+	case *ast.WildcardPattern:
+		p.write("_")
+
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value)
+
+	case *ast.RangePattern:
+		p.expression(pattern.Low)
+		p.write(pattern.Token.Literal)
+		p.expression(pattern.High)
+
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.patternElement(el)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				p.write(", ")
+			}
+			p.write("..." + pattern.Rest.Value)
+		}
+		p.write("]")
+
+	case *ast.HashPattern:
+		p.write("{")
+		for i, pair := range pattern.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.hashPatternPair(pair)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Pairs) > 0 {
+				p.write(", ")
+			}
+			p.write("..." + pattern.Rest.Value)
+		}
+		p.write("}")
+
+	case *ast.VariantPattern:
+		if pattern.Enum != nil {
+			p.write(pattern.Enum.Value + ".")
+		}
+		p.write(pattern.Name.Value)
+		if pattern.Arguments == nil {
+			return
+		}
+		p.write("(")
+		for i, arg := range pattern.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(arg)
+		}
+		p.write(")")
+	}
+}
+
+func (p *printer) patternElement(el *ast.PatternElement) {
+	p.pattern(el.Pattern)
+	if el.Default != nil {
+		p.write(" = ")
+		p.expression(el.Default)
+	}
+}
+
+// hashPatternPair prints a pair, using the shorthand `name` for
+// `name: name`.
+func (p *printer) hashPatternPair(pair *ast.HashPatternPair) {
+	if pair.Token.Type == token.IDENT {
+		if ident, ok := pair.Value.Pattern.(*ast.Identifier); ok && ident.Value == pair.Key {
+			p.patternElement(pair.Value)
+			return
+		}
+		p.write(pair.Key + ": ")
+	} else {
+		p.write(`"` + pair.Key + `": `)
+	}
+	p.patternElement(pair.Value)
+}
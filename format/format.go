@@ -0,0 +1,527 @@
+// Package format prints Saphire programs in a canonical layout.
+//
+// The layout indents blocks by two spaces, puts spaces around binary
+// operators, keeps only the parentheses the parser needs, ends statements
+// with semicolons where the language allows and breaks call arguments,
+// array elements and hash literals that do not fit on a line into one
+// element per line. Comments are kept, either on a line of their own or at
+// the end of the line they were on, and runs of blank lines between
+// statements are collapsed to one.
+package format
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/token"
+)
+
+const (
+	// width is the column past which lists are broken over several lines.
+	width = 80
+
+	indentation = "  "
+)
+
+// Program returns the formatted source of program, which must have been
+// parsed without errors from src. The source is needed for the comments
+// and blank lines, which the AST does not record.
+func Program(program *ast.Program, src string) string {
+	p := &printer{src: scan(src)}
+
+	p.statements(program.Statements, false)
+	p.comments(pos{math.MaxInt, 0}, len(program.Statements) == 0, true)
+
+	if p.out.Len() == 0 {
+		return ""
+	}
+	return p.out.String() + "\n"
+}
+
+// pos is a position in the source.
+type pos struct {
+	line, column int
+}
+
+func (a pos) before(b pos) bool {
+	return a.line < b.line || (a.line == b.line && a.column < b.column)
+}
+
+func posOf(tok token.Token) pos {
+	return pos{tok.Line, tok.Column}
+}
+
+type comment struct {
+	lexer.Comment
+
+	// trailing is set for comments that follow a token on the same line.
+	trailing bool
+}
+
+func (c comment) pos() pos {
+	return pos{c.Line, c.Column}
+}
+
+// source holds what the printer needs from the source besides the AST.
+type source struct {
+	tokens   []token.Token
+	index    map[pos]int
+	closes   map[pos]pos
+	comments []comment
+}
+
+func scan(src string) *source {
+	s := &source{index: make(map[pos]int), closes: make(map[pos]pos)}
+
+	l := lexer.New(src)
+	var opens []pos
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		s.index[posOf(tok)] = len(s.tokens)
+		s.tokens = append(s.tokens, tok)
+
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			opens = append(opens, posOf(tok))
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if len(opens) > 0 {
+				s.closes[opens[len(opens)-1]] = posOf(tok)
+				opens = opens[:len(opens)-1]
+			}
+		}
+	}
+
+	for _, c := range l.Comments() {
+		i := s.tokenBefore(pos{c.Line, c.Column})
+		trailing := i >= 0 && s.tokens[i].Line == c.Line
+		s.comments = append(s.comments, comment{Comment: c, trailing: trailing})
+	}
+
+	return s
+}
+
+// tokenBefore returns the index of the last token before at, or -1.
+func (s *source) tokenBefore(at pos) int {
+	return sort.Search(len(s.tokens), func(i int) bool {
+		return !posOf(s.tokens[i]).before(at)
+	}) - 1
+}
+
+// next returns the position of the token after the one at at.
+func (s *source) next(at pos) pos {
+	i, ok := s.index[at]
+	if !ok || i+1 >= len(s.tokens) {
+		return pos{}
+	}
+	return posOf(s.tokens[i+1])
+}
+
+// openBrace returns the position of the first `{` after at that is not
+// nested in parentheses or brackets.
+func (s *source) openBrace(at pos) pos {
+	for i := s.tokenBefore(at) + 1; i < len(s.tokens); i++ {
+		switch tok := s.tokens[i]; tok.Type {
+		case token.LBRACE:
+			return posOf(tok)
+		case token.LPAREN, token.LBRACKET:
+			close := s.closes[posOf(tok)]
+			for i+1 < len(s.tokens) && posOf(s.tokens[i+1]).before(close) {
+				i++
+			}
+		}
+	}
+	return pos{}
+}
+
+type printer struct {
+	src *source
+	out strings.Builder
+
+	indent int
+	// newlines is the number of line breaks to write before the next text,
+	// which are held back so that trailing comments can go before them.
+	newlines int
+	column   int
+	// code is set when the last text written was code rather than a
+	// comment.
+	code bool
+	// next is the index of the first comment not yet printed.
+	next int
+
+	// flat is set for printers measuring the width of code, which never
+	// break lists and leave out comments.
+	flat bool
+}
+
+func (p *printer) write(s string) {
+	if p.newlines > 0 && p.out.Len() > 0 {
+		p.out.WriteString(strings.Repeat("\n", p.newlines))
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.column = len(indentation) * p.indent
+	}
+	p.newlines = 0
+
+	p.out.WriteString(s)
+	p.column += len(s)
+	p.code = true
+}
+
+// line ends the current line.
+func (p *printer) line() {
+	p.newlines = max(p.newlines, 1)
+}
+
+// currentColumn returns the column the next text is written at.
+func (p *printer) currentColumn() int {
+	if p.newlines > 0 {
+		return len(indentation) * p.indent
+	}
+	return p.column
+}
+
+// comments prints the comments before at, where the printer is about to
+// start a line, and the blank lines before them and before at. A trailing
+// comment goes at the end of the last line when that line ended with code.
+// Blank lines are left out before the first line of a list, which first
+// reports, and before the closing brace of a list, which closing reports.
+func (p *printer) comments(at pos, first, closing bool) {
+	if p.flat {
+		return
+	}
+
+	prev := 0
+	if i := p.src.tokenBefore(at); i >= 0 {
+		prev = p.src.tokens[i].Line
+	}
+
+	for ; p.next < len(p.src.comments); p.next++ {
+		c := p.src.comments[p.next]
+		if !c.pos().before(at) {
+			break
+		}
+
+		if c.trailing && p.code && p.newlines > 0 {
+			p.out.WriteString(" " + c.Text)
+		} else {
+			if !first && c.Line > prev+1 {
+				p.newlines = 2
+			}
+			p.write(c.Text)
+			p.line()
+			first = false
+		}
+		p.code = false
+		prev = max(prev, c.Line)
+	}
+
+	if !first && !closing && at.line > prev+1 {
+		p.newlines = 2
+	}
+}
+
+// hasComments reports whether there are comments left to print between
+// from and to.
+func (p *printer) hasComments(from, to pos) bool {
+	if p.flat {
+		return false
+	}
+	for _, c := range p.src.comments[p.next:] {
+		if !c.pos().before(to) {
+			return false
+		}
+		if from.before(c.pos()) {
+			return true
+		}
+	}
+	return false
+}
+
+// measure returns a printer for measuring code printed at the current
+// column.
+func (p *printer) measure() *printer {
+	return &printer{src: p.src, column: p.currentColumn(), flat: true}
+}
+
+// fits reports whether n items printed by item between open and close
+// fit on the current line. Only the first line of an item that spans
+// several lines counts.
+func (p *printer) fits(open, close string, n int, item func(*printer, int)) bool {
+	if p.flat {
+		return true
+	}
+
+	column := p.currentColumn() + len(open) + len(close)
+	for i := range n {
+		q := p.measure()
+		item(q, i)
+
+		s := q.out.String()
+		if end := strings.IndexByte(s, '\n'); end >= 0 {
+			return column+end <= width
+		}
+		column += len(s)
+		if i < n-1 {
+			column += len(", ")
+		}
+	}
+	return column <= width
+}
+
+// list prints n items separated by commas between open and close, whose
+// tokens are at from and to in the source. The items go on one line if
+// they fit and no comment is among them, and one per line otherwise.
+// Padded lists have spaces inside their delimiters when on one line.
+func (p *printer) list(open, close string, from, to pos, n int, start func(int) pos, item func(*printer, int), padded bool) {
+	broken := p.hasComments(from, to)
+	if n == 0 && !broken {
+		p.write(open + close)
+		return
+	}
+
+	if padded {
+		open, close = open+" ", " "+close
+	}
+	if !broken && p.fits(open, close, n, item) {
+		p.write(open)
+		for i := range n {
+			if i > 0 {
+				p.write(", ")
+			}
+			item(p, i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.write(strings.TrimSpace(open))
+	p.indent++
+	p.line()
+	for i := range n {
+		p.comments(start(i), i == 0, false)
+		item(p, i)
+		if i < n-1 {
+			p.write(",")
+		}
+		p.line()
+	}
+	p.comments(to, n == 0, true)
+	p.indent--
+	p.write(strings.TrimSpace(close))
+}
+
+// statements prints stmts one per line. Semicolons that can be left out
+// are left out after the last statement of a block.
+func (p *printer) statements(stmts []ast.Statement, block bool) {
+	for i, stmt := range stmts {
+		p.comments(posOf(statementToken(stmt)), i == 0, false)
+
+		var next ast.Statement
+		if i < len(stmts)-1 {
+			next = stmts[i+1]
+		}
+		p.statement(stmt)
+		if semicolon(stmt, next, block) {
+			p.write(";")
+		}
+		p.line()
+	}
+}
+
+// semicolon reports whether stmt, followed by next in a program or block,
+// ends with a semicolon. An expression statement needs one when the next
+// statement would otherwise continue it, as in `f()` followed by
+// `(a + b)`, and has one otherwise unless it is the last statement of a
+// block or ends with a block itself.
+func semicolon(stmt, next ast.Statement, block bool) bool {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement, *ast.ImportStatement:
+		return true
+	case *ast.ExportStatement:
+		return semicolon(stmt.Statement, next, block)
+	case *ast.ExpressionStatement:
+		if next, ok := next.(*ast.ExpressionStatement); ok {
+			switch next.Token.Type {
+			case token.LPAREN, token.LBRACKET, token.MINUS:
+				return true
+			}
+		}
+
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression, *ast.TryExpression:
+			return false
+		}
+		return next != nil || !block
+	}
+	return false
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	case *ast.FunctionStatement:
+		return stmt.Token
+	case *ast.ImportStatement:
+		return stmt.Token
+	case *ast.ExportStatement:
+		return stmt.Token
+	case *ast.StructStatement:
+		return stmt.Token
+	case *ast.EnumStatement:
+		return stmt.Token
+	case *ast.ClassStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write(stmt.Token.Literal + " ")
+		if stmt.Pattern != nil {
+			p.pattern(stmt.Pattern)
+		} else {
+			p.write(stmt.Name.Value)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value)
+
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+
+	case *ast.FunctionStatement:
+		p.write("fn " + stmt.Name.Value)
+		p.parameters("(", ")", stmt.Function.Parameters)
+		p.write(" ")
+		p.block(stmt.Function.Body)
+
+	case *ast.ImportStatement:
+		p.importStatement(stmt)
+
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(stmt.Statement)
+
+	case *ast.StructStatement:
+		p.write("struct " + stmt.Name.Value + " ")
+		open := p.src.openBrace(posOf(stmt.Name.Token))
+		p.list("{", "}", open, p.src.closes[open], len(stmt.Fields),
+			func(i int) pos { return posOf(stmt.Fields[i].Token) },
+			func(p *printer, i int) { p.write(stmt.Fields[i].Value) },
+			true)
+
+	case *ast.EnumStatement:
+		p.write("enum " + stmt.Name.Value + " ")
+		open := p.src.openBrace(posOf(stmt.Name.Token))
+		p.list("{", "}", open, p.src.closes[open], len(stmt.Variants),
+			func(i int) pos { return posOf(stmt.Variants[i].Name.Token) },
+			func(p *printer, i int) { p.variant(stmt.Variants[i]) },
+			true)
+
+	case *ast.ClassStatement:
+		p.class(stmt)
+	}
+}
+
+func (p *printer) importStatement(stmt *ast.ImportStatement) {
+	p.write("import ")
+	if stmt.Names != nil {
+		p.write("{ ")
+		for i, name := range stmt.Names {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(name.Name.Value)
+			if name.Alias != nil {
+				p.write(" as " + name.Alias.Value)
+			}
+		}
+		p.write(" } from ")
+	}
+	p.write(`"` + stmt.Path.Value + `"`)
+	if stmt.Alias != nil {
+		p.write(" as " + stmt.Alias.Value)
+	}
+}
+
+func (p *printer) variant(v *ast.EnumVariant) {
+	p.write(v.Name.Value)
+	if v.Fields == nil {
+		return
+	}
+
+	p.write("(")
+	for i, field := range v.Fields {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(field.Value)
+	}
+	p.write(")")
+}
+
+func (p *printer) class(stmt *ast.ClassStatement) {
+	p.write("class " + stmt.Name.Value)
+	if stmt.Superclass != nil {
+		p.write(" extends ")
+		p.expression(stmt.Superclass)
+	}
+	p.write(" ")
+
+	open := p.src.openBrace(posOf(stmt.Name.Token))
+	close := p.src.closes[open]
+	if len(stmt.Methods) == 0 && !p.hasComments(open, close) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.line()
+	for i, method := range stmt.Methods {
+		p.comments(posOf(method.Token), i == 0, false)
+		p.write(method.Name)
+		p.parameters("(", ")", method.Parameters)
+		p.write(" ")
+		p.block(method.Body)
+		p.line()
+	}
+	p.comments(close, len(stmt.Methods) == 0, true)
+	p.indent--
+	p.write("}")
+}
+
+// block prints a block in braces, with its statements on lines of their
+// own.
+func (p *printer) block(block *ast.BlockStatement) {
+	open := posOf(block.Token)
+	close := p.src.closes[open]
+	if len(block.Statements) == 0 && !p.hasComments(open, close) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.line()
+	p.statements(block.Statements, true)
+	p.comments(close, len(block.Statements) == 0, true)
+	p.indent--
+	p.write("}")
+}
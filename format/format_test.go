@@ -0,0 +1,184 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func format(t *testing.T, input string) string {
+	t.Helper()
+	return Program(parse(t, input), input)
+}
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Spacing and semicolons.
+		{"let   x=1", "let x = 1;\n"},
+		{"const c = 1; x=c;print(x)", "const c = 1;\nx = c;\nprint(x);\n"},
+		{"return a+b", "return a + b;\n"},
+		{"", ""},
+		// Parentheses.
+		{"((a + b) * c)", "(a + b) * c;\n"},
+		{"(a * b) + c", "a * b + c;\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c);\na - b - c;\n"},
+		{"-(a + b) * -c", "-(a + b) * -c;\n"},
+		{"(-a).b; (a + b)(c); (a)(b)", "(-a).b;\n(a + b)(c);\na(b);\n"},
+		{"a + (b = 1)", "a + (b = 1);\n"},
+		{"a = b = 1", "a = b = 1;\n"},
+		{"(|x| x)(1); f(|x| x + 1)", "(|x| x)(1);\nf(|x| x + 1);\n"},
+		{"(a + |x| x) + 1", "(a + |x| x) + 1;\n"},
+		{"|x| ({a: x})", "|x| ({a: x});\n"},
+		{"f(...(a + b), ...xs)", "f(...(a + b), ...xs);\n"},
+		// Blocks.
+		{"fn add(a,b){a+b}", "fn add(a, b) {\n  a + b\n}\n"},
+		{"let f = fn(x) { let y = x; y }", "let f = fn(x) {\n  let y = x;\n  y\n};\n"},
+		{"if (x) { 1 } else { 2 }; 3", "if (x) {\n  1\n} else {\n  2\n}\n3;\n"},
+		{"if (x) { 1 }; (f)(2)", "if (x) {\n  1\n};\nf(2);\n"},
+		{"f(); -1", "f();\n-1;\n"},
+		{"fn f() {}", "fn f() {}\n"},
+		{"|a, b = 1, ...rest| { a }", "|a, b = 1, ...rest| {\n  a\n};\n"},
+		{"try { f() } catch { 1 } finally { 2 }", "try {\n  f()\n} catch {\n  1\n} finally {\n  2\n}\n"},
+		// Declarations.
+		{"struct Point{x,y}", "struct Point { x, y }\n"},
+		{"enum Option { Some(value), None }", "enum Option { Some(value), None }\n"},
+		{"class A extends B { init(x) { super.init(x) } }", "class A extends B {\n  init(x) {\n    super.init(x)\n  }\n}\n"},
+		{`import "lib" as lib`, "import \"lib\" as lib;\n"},
+		{`import {a,b as c} from "lib"`, "import { a, b as c } from \"lib\";\n"},
+		{"export let x = 1; export fn f() { x }", "export let x = 1;\nexport fn f() {\n  x\n}\n"},
+		{"p with {x: 3}", "p with { x: 3 };\n"},
+		// Patterns.
+		{`let {name, age: years, "k": v = 0, ...rest} = p`, "let {name, age: years, \"k\": v = 0, ...rest} = p;\n"},
+		{"let [a, [b], ...rest] = xs", "let [a, [b], ...rest] = xs;\n"},
+		{
+			`match (x) { -1 => "neg", 1..=9 => "digit", "s" => 0, Some(v) if v > 0 => v, Shape.Circle => 1, _ => { 2 } }`,
+			"match (x) {\n  -1 => \"neg\",\n  1..=9 => \"digit\",\n  \"s\" => 0,\n  Some(v) if v > 0 => v,\n  Shape.Circle => 1,\n  _ => {\n    2\n  }\n}\n",
+		},
+		// Blank lines.
+		{"a\n\n\n\nb\nc", "a;\n\nb;\nc;\n"},
+		{"fn f() {\n\n  a\n\n}", "fn f() {\n  a\n}\n"},
+		// Long lists.
+		{
+			"let long = someFunction(argumentNumberOne, argumentNumberTwo, argumentNumberThree)",
+			"let long = someFunction(\n  argumentNumberOne,\n  argumentNumberTwo,\n  argumentNumberThree\n);\n",
+		},
+		{
+			`let h = {"name": "Ada", "language": "Saphire", "year": 1843, "tags": ["math", "computing"]}`,
+			"let h = {\n  \"name\": \"Ada\",\n  \"language\": \"Saphire\",\n  \"year\": 1843,\n  \"tags\": [\"math\", \"computing\"]\n};\n",
+		},
+		{
+			"xs.map(fn(x) { x * 2 }).filter(|x| x > somethingRatherLong).reduce(|a, b| a + b, 0)",
+			"xs.map(fn(x) {\n  x * 2\n}).filter(|x| x > somethingRatherLong).reduce(|a, b| a + b, 0);\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := format(t, tt.input); got != tt.expected {
+			t.Errorf("wrong format for %q.\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestProgramKeepsComments(t *testing.T) {
+	input := `// leading
+let x = 1 + // inside an expression
+  2
+fn f() { // after a brace
+  // own line
+
+
+  let a = 1 // trailing
+  // before the closing brace
+}
+fn g() {
+  // the only comment
+}
+let h = {a: 1, // one
+  // between pairs
+  b: 2}
+// at the end`
+
+	expected := `// leading
+let x = 1 + 2; // inside an expression
+fn f() { // after a brace
+  // own line
+
+  let a = 1; // trailing
+  // before the closing brace
+}
+fn g() {
+  // the only comment
+}
+let h = {
+  a: 1, // one
+  // between pairs
+  b: 2
+};
+// at the end
+`
+
+	if got := format(t, input); got != expected {
+		t.Errorf("wrong format.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+// TestProgramRoundTrip checks that formatted programs parse to the same
+// AST and are left alone when formatted again.
+func TestProgramRoundTrip(t *testing.T) {
+	inputs := []string{
+		`let nilakanthaTerm = fn(n) { (-1) ** (n+1) * 4 / ((2*n) * (2*n+1) * (2*n+2)) }
+let nilakanthaPi = fn(n, i) { if (i <= n) { nilakanthaTerm(i) + nilakanthaPi(n, i+1) } else { 0 } }
+print(3 + nilakanthaPi(10, 1))`,
+		`class Account { init(b) { self.balance = b } deposit(n) { self.balance = self.balance + n; self } }
+class Savings extends Account { init(b) { super.init(b); self.rate = 0.1 } }
+let s = Savings(100).deposit(10) // chained
+print(s.balance)`,
+		`enum Result { Ok(value), Err(error) }
+let safeDiv = |a, b| if (b == 0) { Err("division by zero") } else { Ok(a / b) }
+match (safeDiv(1, 0)) { Ok(v) => v, Err(e) => throw e }`,
+		`let xs = [1, 2, 3]; let [first, ...rest] = xs; let {a, b: {c}} = {"a": 1, "b": {"c": 2}}
+try { throw {"code": 1} } catch ({code}) { code } finally { print("done") }
+const config = freeze({"port": 80, "host": "localhost", "debug": false, "workers": 4, "timeout": 30})`,
+		`let tag = fn(x) { match (x) { 1 => {"one": true}, _ => {} } }
+let wrap = |x| {x: x}`,
+		`f(
+  1, // one
+  [2, 3], // two
+  {a: fn() { 4 }}
+)
+-1
+if (x) { 1 }
+[1]`,
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		formatted := Program(program, input)
+
+		reparsed := parse(t, formatted)
+		if reparsed.String() != program.String() {
+			t.Errorf("formatting changed the program.\ninput:\n%s\nformatted:\n%s", input, formatted)
+			continue
+		}
+
+		if again := Program(reparsed, formatted); again != formatted {
+			t.Errorf("formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", formatted, again)
+		}
+	}
+}
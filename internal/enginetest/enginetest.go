@@ -0,0 +1,1916 @@
+// Package enginetest is a suite of tests shared by the engines that run
+// Saphire programs: the tree-walking interpreter and the bytecode VM. Both
+// must give every program the same result.
+package enginetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+)
+
+// Engine runs parsed programs. Engines are configured with the options of
+// the interpreter, whose builtins, limits and I/O they share.
+type Engine interface {
+	Eval(ctx context.Context, program *ast.Program, env *object.Environment) object.Object
+	EvalFile(ctx context.Context, path string, program *ast.Program, env *object.Environment) object.Object
+	RegisterMethod(typ object.ObjectType, name string, fn object.BuiltinFunction)
+	RegisterNamespace(name string, members map[string]object.Object)
+}
+
+// maxTraceFrames is the number of innermost frames engines keep in error
+// traces.
+const maxTraceFrames = 10
+
+type suite struct {
+	newEngine func(opts ...interpreter.Option) Engine
+}
+
+// Run runs the suite on the engines returned by newEngine, each test in a
+// subtest of t.
+func Run(t *testing.T, newEngine func(opts ...interpreter.Option) Engine) {
+	s := &suite{newEngine: newEngine}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"EvalNumberExpression", s.evalNumberExpression},
+		{"EvalBooleanExpression", s.evalBooleanExpression},
+		{"BangOperator", s.bangOperator},
+		{"IfElseExpressions", s.ifElseExpressions},
+		{"ReturnStatements", s.returnStatements},
+		{"ErrorHandling", s.errorHandling},
+		{"LetStatements", s.letStatements},
+		{"FunctionApplication", s.functionApplication},
+		{"Closures", s.closures},
+		{"StringLiteral", s.stringLiteral},
+		{"StringConcatenation", s.stringConcatenation},
+		{"BuiltinFunctions", s.builtinFunctions},
+		{"ArrayLiterals", s.arrayLiterals},
+		{"ArrayIndexExpressions", s.arrayIndexExpressions},
+		{"HashLiterals", s.hashLiterals},
+		{"HashIndexExpressions", s.hashIndexExpressions},
+		{"PrintBuiltin", s.printBuiltin},
+		{"InputBuiltin", s.inputBuiltin},
+		{"Limits", s.limits},
+		{"EvalCancellation", s.evalCancellation},
+		{"RecursionDepthError", s.recursionDepthError},
+		{"ErrorTrace", s.errorTrace},
+		{"TailCalls", s.tailCalls},
+		{"FunctionArity", s.functionArity},
+		{"DefaultVariadicAndNamedArguments", s.defaultVariadicAndNamedArguments},
+		{"NamedFunctionsAndLambdas", s.namedFunctionsAndLambdas},
+		{"TraceUsesFunctionNames", s.traceUsesFunctionNames},
+		{"Destructuring", s.destructuring},
+		{"MatchExpressions", s.matchExpressions},
+		{"NoMatchErrorCause", s.noMatchErrorCause},
+		{"TryCatchFinally", s.tryCatchFinally},
+		{"FinallyRunsOnce", s.finallyRunsOnce},
+		{"LimitErrorsAreNotCatchable", s.limitErrorsAreNotCatchable},
+		{"Modules", s.modules},
+		{"ModulesAreEvaluatedOnce", s.modulesAreEvaluatedOnce},
+		{"MemberAccessAndMethods", s.memberAccessAndMethods},
+		{"RegisterMethod", s.registerMethod},
+		{"Structs", s.structs},
+		{"Enums", s.enums},
+		{"Assignment", s.assignment},
+		{"SelfReferentialContainers", s.selfReferentialContainers},
+		{"Classes", s.classes},
+		{"ConstAndFreeze", s.constAndFreeze},
+		{"BlockScoping", s.blockScoping},
+		{"ResolvedLookups", s.resolvedLookups},
+		{"StaticChecks", s.staticChecks},
+		{"ShadowWarnings", s.shadowWarnings},
+		{"Upvalues", s.upvalues},
+		{"Optimizations", s.optimizations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func (s *suite) evalNumberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"2 ** 2", 4},
+		{"5 ** 2 + 10", 35},
+	}
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		testNumberObject(t, evaluated, float64(float64(tt.expected)))
+	}
+}
+
+// eval runs input on a new engine with the default options.
+func (s *suite) eval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return s.newEngine().Eval(context.Background(), program, env)
+}
+
+// output runs input on a new engine and returns what it prints.
+func (s *suite) output(input string) string {
+	var stdout bytes.Buffer
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	s.newEngine(interpreter.WithStdout(&stdout)).Eval(context.Background(), program, object.NewEnvironment())
+	return stdout.String()
+}
+
+func testNumberObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Number)
+	if !ok {
+		t.Errorf("object is not Number. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func (s *suite) evalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func (s *suite) bangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func (s *suite) ifElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		num, ok := tt.expected.(int)
+		if ok {
+			testNumberObject(t, evaluated, float64(num))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != interpreter.NIL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func (s *suite) returnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+			if (10 > 1) {
+			if (10 > 1) {
+			return 10;
+			}
+			return 1;
+			}`,
+			10},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		testNumberObject(t, evaluated, float64(tt.expected))
+	}
+}
+
+func (s *suite) errorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: NUMBER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: NUMBER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`
+	if (10 > 1) {
+		if (10 > 1) {
+			return true + false;
+		}
+
+		return 1;
+	}
+`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`{"name": "Saphire"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+	}
+
+	for _, tt := range tests {
+		result := s.eval(tt.input)
+
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", result, result)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func (s *suite) letStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testNumberObject(t, s.eval(tt.input), float64(tt.expected))
+	}
+}
+
+func (s *suite) functionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let identity = fn(x) { return x; }; identity(5) + 1;", 6},
+	}
+
+	for _, tt := range tests {
+		testNumberObject(t, s.eval(tt.input), float64(tt.expected))
+	}
+
+	// Bodies without a value return nil.
+	for _, input := range []string{"let f = fn() {}; f()", "let f = fn() { let y = 1 }; f()", "let f = |x| { const y = x }; f(1)"} {
+		testNullObject(t, s.eval(input))
+	}
+}
+
+func (s *suite) closures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+fn(y) { x + y };
+};
+let addTwo = newAdder(2);
+addTwo(2);`
+	testNumberObject(t, s.eval(input), 4)
+}
+
+func (s *suite) stringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := s.eval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func (s *suite) stringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := s.eval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func (s *suite) builtinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got NUMBER"},
+		{`len("one", "two")`, "function `len` expects 1 argument, got 2"},
+		{`len()`, "function `len` expects 1 argument, got 0"},
+		{`push([])`, "function `push` expects 2 arguments, got 1"},
+		{`input(1, 2)`, "function `input` expects at most 1 argument, got 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testNumberObject(t, evaluated, float64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func (s *suite) arrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := s.eval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testNumberObject(t, result.Elements[0], 1)
+	testNumberObject(t, result.Elements[1], 4)
+	testNumberObject(t, result.Elements[2], 6)
+}
+
+func (s *suite) arrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"let i = 0; [1][i];",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[2];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+			6,
+		},
+		{
+			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		num, ok := tt.expected.(int)
+		if ok {
+			testNumberObject(t, evaluated, float64(num))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func (s *suite) hashLiterals(t *testing.T) {
+	input := `let two = "two";
+{
+"one": 10 - 9,
+two: 1 + 1,
+"thr" + "ee": 6 / 2,
+4: 4,
+true: 5,
+false: 6
+}`
+
+	evaluated := s.eval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Number{Value: 4}).HashKey():       4,
+		interpreter.TRUE.HashKey():                 5,
+		interpreter.FALSE.HashKey():                6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testNumberObject(t, pair.Value, float64(expectedValue))
+	}
+}
+
+func (s *suite) hashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`{"foo": 5}["foo"]`,
+			5,
+		},
+		{
+			`{"foo": 5}["bar"]`,
+			nil,
+		},
+		{
+			`let key = "foo"; {"foo": 5}[key]`,
+			5,
+		},
+		{
+			`{}["foo"]`,
+			nil,
+		},
+		{
+			`{5: 5}[5]`,
+			5,
+		},
+		{
+			`{true: 5}[true]`,
+			5,
+		},
+		{
+			`{false: 5}[false]`,
+			5,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		num, ok := tt.expected.(int)
+		if ok {
+			testNumberObject(t, evaluated, float64(num))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func (s *suite) printBuiltin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	program := parser.New(lexer.New(`print("hello", 1 + 2); eprint("oops")`)).ParseProgram()
+	in := s.newEngine(interpreter.WithStdout(&stdout), interpreter.WithStderr(&stderr))
+
+	result := in.Eval(context.Background(), program, object.NewEnvironment())
+	testNullObject(t, result)
+
+	if got := stdout.String(); got != "hello\n3.00\n" {
+		t.Errorf("stdout has wrong content. got=%q", got)
+	}
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr has wrong content. got=%q", got)
+	}
+}
+
+func (s *suite) inputBuiltin(t *testing.T) {
+	var stdout bytes.Buffer
+
+	program := parser.New(lexer.New(`let a = input("name: "); let b = input(); let c = input(); [a, b, c]`)).ParseProgram()
+	in := s.newEngine(interpreter.WithStdout(&stdout), interpreter.WithStdin(strings.NewReader("saphire\nlast")))
+
+	result, ok := in.Eval(context.Background(), program, object.NewEnvironment()).(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T", result)
+	}
+
+	if got := result.Inspect(); got != "[saphire, last, nil]" {
+		t.Errorf("input returned wrong values. got=%q", got)
+	}
+	if got := stdout.String(); got != "name: " {
+		t.Errorf("prompt not written to stdout. got=%q", got)
+	}
+}
+
+func (s *suite) limits(t *testing.T) {
+	fib := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40);`
+
+	tests := []struct {
+		input  string
+		limits interpreter.Limits
+		limit  string
+	}{
+		{fib, interpreter.Limits{MaxSteps: 1000}, "steps"},
+		{fib, interpreter.Limits{Timeout: 10 * time.Millisecond}, "timeout"},
+		{`let grow = fn(xs) { grow(push(xs, xs)) }; grow([]);`, interpreter.Limits{MaxAllocations: 100}, "allocations"},
+		{`"ab".repeat(100000)`, interpreter.Limits{MaxAllocations: 100}, "allocations"},
+		{`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; double("ab", 20);`, interpreter.Limits{MaxAllocations: 100}, "allocations"},
+		{`let down = fn(n) { 1 + down(n + 1) }; down(0);`, interpreter.Limits{MaxDepth: 50}, "depth"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := s.newEngine(interpreter.WithLimits(tt.limits)).Eval(context.Background(), program, object.NewEnvironment())
+
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.limit, result, result)
+			continue
+		}
+
+		var limitErr *interpreter.LimitError
+		if !errors.As(errObj.Cause, &limitErr) || !errors.Is(errObj.Cause, interpreter.ErrLimitExceeded) {
+			t.Errorf("error cause is not a LimitError. got=%T(%+v)", errObj.Cause, errObj.Cause)
+			continue
+		}
+		if limitErr.Limit != tt.limit {
+			t.Errorf("wrong limit exceeded. expected=%q, got=%q", tt.limit, limitErr.Limit)
+		}
+	}
+}
+
+func (s *suite) evalCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New(`1 + 1`)).ParseProgram()
+	result := s.newEngine().Eval(ctx, program, object.NewEnvironment())
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+	if !errors.Is(errObj.Cause, context.Canceled) || errors.Is(errObj.Cause, interpreter.ErrLimitExceeded) {
+		t.Errorf("wrong error cause. got=%v", errObj.Cause)
+	}
+}
+
+func (s *suite) recursionDepthError(t *testing.T) {
+	input := `
+let down = fn(n) {
+  1 + down(n + 1)
+};
+down(0);`
+
+	result := s.eval(input)
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+
+	expectedMessage := fmt.Sprintf("maximum recursion depth exceeded (%d) calling `down`", interpreter.DefaultMaxDepth)
+	if errObj.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%q, got=%q", expectedMessage, errObj.Message)
+	}
+
+	if len(errObj.Trace) != maxTraceFrames+1 {
+		t.Fatalf("wrong number of trace lines. got=%d", len(errObj.Trace))
+	}
+	if errObj.Trace[0] != "at down (line 3)" {
+		t.Errorf("wrong innermost frame. got=%q", errObj.Trace[0])
+	}
+	expectedHidden := fmt.Sprintf("... %d more frames", interpreter.DefaultMaxDepth-maxTraceFrames)
+	if errObj.Trace[maxTraceFrames] != expectedHidden {
+		t.Errorf("wrong trace summary. expected=%q, got=%q", expectedHidden, errObj.Trace[maxTraceFrames])
+	}
+}
+
+func (s *suite) errorTrace(t *testing.T) {
+	input := `
+let inner = fn(x) { x + true };
+let outer = fn(x) {
+  let y = inner(x);
+  y
+};
+outer(1);`
+
+	result := s.eval(input)
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+
+	expected := []string{"at inner (line 4)", "at outer (line 7)"}
+	if strings.Join(errObj.Trace, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong trace. expected=%q, got=%q", expected, errObj.Trace)
+	}
+}
+
+func (s *suite) tailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{`
+let count = fn(n, acc) {
+  if (n == 0) { acc } else { count(n - 1, acc + 1) }
+};
+count(1000000, 0);`, 1000000},
+		{`
+let count = fn(n, acc) {
+  if (n == 0) { return acc; }
+  return count(n - 1, acc + 2);
+};
+count(100000, 0);`, 200000},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+if (isEven(100001)) { 1 } else { 0 };`, 0},
+		{`
+let last = fn(xs) { if (len(xs) == 1) { first(xs) } else { last(rest(xs)) } };
+last([1, 2, 3, 4]);`, 4},
+	}
+
+	for _, tt := range tests {
+		testNumberObject(t, s.eval(tt.input), tt.expected)
+	}
+}
+
+func (s *suite) functionArity(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let f = fn(x, y) { x + y }; f(1);", "function `f` expects 2 arguments, got 1"},
+		{"let f = fn(x) { x }; f(1, 2);", "function `f` expects 1 argument, got 2"},
+		{"let f = fn() { 1 }; f(1);", "function `f` expects 0 arguments, got 1"},
+		{"fn(x) { x }();", "function `<anonymous>` expects 1 argument, got 0"},
+		{"let g = fn(x) { x }; let f = fn() { g() }; f();", "function `g` expects 1 argument, got 0"},
+		{`"abc".upper(1);`, "function `str.upper` expects 0 arguments, got 1"},
+		{"[1].push();", "function `arr.push` expects 1 argument, got 0"},
+		{"[1].push(2, 3);", "function `arr.push` expects 1 argument, got 2"},
+		{"arr.push([1]);", "function `arr.push` expects 2 arguments, got 1"},
+		{"[1].map();", "function `arr.map` expects 1 argument, got 0"},
+		{"[1].map(fn(x) { len(x, x) });", "function `len` expects 1 argument, got 2"},
+	}
+
+	for _, tt := range tests {
+		result := s.eval(tt.input)
+
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, result, result)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+		if !errors.Is(errObj.Cause, interpreter.ErrArity) {
+			t.Errorf("error cause is not interpreter.ErrArity. got=%v", errObj.Cause)
+		}
+	}
+}
+
+func (s *suite) defaultVariadicAndNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x, eps = 0.5) { x + eps }; f(1);", 1.5},
+		{"let f = fn(x, eps = 0.5) { x + eps }; f(1, 2);", 3.0},
+		{"let f = fn(x, y = x * 2) { x + y }; f(3);", 9.0},
+		{"let f = fn(x, eps = 0.5, steps = 10) { x + eps * steps }; f(1, steps: 2);", 2.0},
+		{"let f = fn(x, eps = 0.5) { x - eps }; f(eps: 1, x: 5);", 4.0},
+		{"let f = fn(first, ...rest) { len(rest) }; f(1, 2, 3);", 2.0},
+		{"let f = fn(first, ...rest) { len(rest) }; f(1);", 0.0},
+		{"let f = fn(...all) { all }; f(1, 2);", "[1.00, 2.00]"},
+		{"let add = fn(x, y) { x + y }; let args = [1, 2]; add(...args);", 3.0},
+		{"let f = fn(...all) { all }; f(0, ...[1, 2], 3);", "[0.00, 1.00, 2.00, 3.00]"},
+		{"let xs = [2, 3]; [1, ...xs, 4];", "[1.00, 2.00, 3.00, 4.00]"},
+		{"len(...[[1, 2]]);", 2.0},
+		{"let f = fn(x) { x }; f(1, 2);", "function `f` expects 1 argument, got 2"},
+		{"let f = fn(x, y = 1) { x }; f();", "function `f` expects 1 to 2 arguments, got 0"},
+		{"let f = fn(x = 1, y = 2) { x }; f(1, 2, 3);", "function `f` expects at most 2 arguments, got 3"},
+		{"let f = fn(x, ...rest) { x }; f();", "function `f` expects at least 1 argument, got 0"},
+		{"let f = fn(x, y = 1) { x }; f(y: 2);", "function `f` missing argument for parameter `x`"},
+		{"let f = fn(x) { x }; f(z: 1);", "function `f` has no parameter `z`"},
+		{"let f = fn(x, y = 1) { x }; f(1, x: 2);", "function `f` got multiple values for parameter `x`"},
+		{"let f = fn(...rest) { rest }; f(rest: 1);", "function `f` has no parameter `rest`"},
+		{"let f = fn(x) { x }; f(...1);", "cannot spread NUMBER, expected ARRAY"},
+		{"len(x: 1);", "function `len` does not accept named arguments"},
+		{"...[1];", "spread is only allowed in call arguments and array literals"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func (s *suite) namedFunctionsAndLambdas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5);", 120.0},
+		{"fn outer() { fn helper(x) { x * 2 } helper(21) } outer();", 42.0},
+		{"let double = |x| x * 2; double(4);", 8.0},
+		{"let add = |a, b| a + b; add(1, 2);", 3.0},
+		{"let answer = || 42; answer();", 42.0},
+		{"let apply = fn(f, x) { f(x) }; apply(|x| { let y = x + 1; y * y }, 2);", 9.0},
+		{"let scale = |x, by = 10| x * by; scale(2);", 20.0},
+		{"fn fact(n) { n }; fact;", "fn fact(n) {\nn\n}"},
+		{"let id = fn(x) { x }; id;", "fn id(x) {\nx\n}"},
+		{"|x| x;", "fn(x) {\nx\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func (s *suite) traceUsesFunctionNames(t *testing.T) {
+	input := `
+fn fail(x) { x + true }
+let handlers = [fail];
+let y = handlers[0](1);`
+
+	errObj, ok := s.eval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if len(errObj.Trace) != 1 || errObj.Trace[0] != "at fail (line 4)" {
+		t.Errorf("wrong trace. got=%q", errObj.Trace)
+	}
+}
+
+func (s *suite) destructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a + b;", 3.0},
+		{"let [a, ...rest] = [1, 2, 3]; rest;", "[2.00, 3.00]"},
+		{"let [a, ...rest] = [1]; rest;", "[]"},
+		{"let [a, b = a * 10] = [2]; b;", 20.0},
+		{"let [[a, b], [c]] = [[1, 2], [3]]; a + b + c;", 6.0},
+		{`let {name, age: years} = {"name": "Ann", "age": 30}; years;`, 30.0},
+		{`let {name, age: years} = {"name": "Ann", "age": 30}; name;`, "Ann"},
+		{`let {"first name": first} = {"first name": "Ann"}; first;`, "Ann"},
+		{`let {x, y = 0} = {"x": 1}; x + y;`, 1.0},
+		{`let {x, ...others} = {"x": 1, "y": 2}; others["y"];`, 2.0},
+		{`let {point: [x, y], tags: {main}} = {"point": [1, 2], "tags": {"main": 3}}; x + y + main;`, 6.0},
+		{"let pair = fn() { [1, 2] }; let [q, r] = pair(); q - r;", -1.0},
+		{"let f = fn([a, b]) { a * b }; f([3, 4]);", 12.0},
+		{`let f = fn({w, h = 1}, scale = 2) { w * h * scale }; f({"w": 3});`, 6.0},
+		{"let f = |[k, v]| k + v; f([1, 2]);", 3.0},
+		{"let [a, b] = [1]; a;", "array pattern [a, b] expects 2 elements, got 1"},
+		{"let [a, b] = [1, 2, 3]; a;", "array pattern [a, b] expects 2 elements, got 3"},
+		{"let [a, b = 0] = []; a;", "array pattern [a, b = 0] expects 1 to 2 elements, got 0"},
+		{"let [a, b, ...c] = [1]; a;", "array pattern [a, b, ...c] expects at least 2 elements, got 1"},
+		{"let [a] = 1; a;", "cannot destructure NUMBER with array pattern [a]"},
+		{`let {name} = [1]; name;`, "cannot destructure ARRAY with hash pattern {name}"},
+		{`let {name} = {"nmae": 1}; name;`, `hash pattern {name} missing key "name"`},
+		{"let f = fn([a, b]) { a }; f([1]);", "array pattern [a, b] expects 2 elements, got 1"},
+		{"let f = fn([a, b]) { a }; f();", "function `f` expects 1 argument, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) matchExpressions(t *testing.T) {
+	classify := `let classify = fn(x) {
+	match (x) {
+		0 => "zero",
+		-1 => "minus one",
+		1..10 => "small",
+		10..=100 => "medium",
+		"hi" => "greeting",
+		true => "yes",
+		[] => "empty",
+		[a, b] => "pair",
+		[first, ...rest] if len(rest) > 2 => "long",
+		{kind: "circle", r} => "circle",
+		n if n == 500 => { let big = "big"; big },
+		_ => "other"
+	}
+};`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"classify(0)", "zero"},
+		{"classify(-1)", "minus one"},
+		{"classify(9.5)", "small"},
+		{"classify(10)", "medium"},
+		{"classify(100)", "medium"},
+		{"classify(500)", "big"},
+		{`classify("hi")`, "greeting"},
+		{`classify("ho")`, "other"},
+		{"classify(true)", "yes"},
+		{"classify(false)", "other"},
+		{"classify([])", "empty"},
+		{"classify([1, 2])", "pair"},
+		{"classify([1, 2, 3])", "other"},
+		{"classify([1, 2, 3, 4])", "long"},
+		{`classify({"kind": "circle", "r": 1})`, "circle"},
+		{`classify({"kind": "square"})`, "other"},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", 6.0},
+		{`match ({"x": 1}) { {x, y = 10} => x + y }`, 11.0},
+		{"match (5) { n if n > 10 => 1, n => n * 2 }", 10.0},
+		{"let n = 1; match (2) { n => n }; n;", 1.0},
+		{"let count = fn(n) { match (n) { 0 => 0, _ => count(n - 1) } }; count(20000);", 0.0},
+		{`let h = match (1) { 1 => {"k": 2}, _ => {} }; h["k"]`, 2.0},
+		{`let f = |x| {"k": x}; f(3)["k"]`, 3.0},
+		{"match (5) { 1 => 1, 2 => 2 }", "no match arm matches 5.00"},
+		{"match (5) { n if n + true => 1 }", "type mismatch: NUMBER + BOOLEAN"},
+		{"let [0, x] = [1, 2]; x;", "1.00 does not match pattern 0"},
+	}
+
+	for _, tt := range tests {
+		input := tt.input
+		if strings.HasPrefix(input, "classify") {
+			input = classify + input
+		}
+		evaluated := s.eval(input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+				}
+			default:
+				t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	// Arms without a value yield nil.
+	for _, input := range []string{
+		"print(match (1) { 1 => { let y = 2 } })",
+		"let x = match (1) { _ => { let q = 1 } }; print(x)",
+		"print(match (1) { _ => {} })",
+		"print(if (true) { let y = 1 })",
+	} {
+		if got := s.output(input); got != "nil\n" {
+			t.Errorf("wrong output for %q. got=%q", input, got)
+		}
+	}
+}
+
+func (s *suite) noMatchErrorCause(t *testing.T) {
+	errObj, ok := s.eval("match (1) { 2 => 2 }").(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if !errors.Is(errObj.Cause, interpreter.ErrNoMatch) {
+		t.Errorf("wrong error cause. got=%v", errObj.Cause)
+	}
+}
+
+func (s *suite) tryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1.0},
+		{`try { throw "bad" } catch (e) { 2 }`, 2.0},
+		{`try { throw "bad" } catch (e) { e["message"] }`, "bad"},
+		{`try { throw "bad" } catch (e) { e["kind"] }`, "Error"},
+		{`try { throw 42 } catch (e) { e["value"] }`, 42.0},
+		{`try { throw {"kind": "ParseError", "message": "empty"} } catch ({kind, message}) { kind + ": " + message }`, "ParseError: empty"},
+		{"try { len(1, 2) } catch (e) { e[\"kind\"] }", "ArityError"},
+		{"try { len(1) } catch (e) { e[\"message\"] }", "argument to `len` not supported, got NUMBER"},
+		{"try { match (1) { 2 => 2 } } catch (e) { e[\"kind\"] }", "MatchError"},
+		{"try { 1 + true } catch (e) { e[\"kind\"] }", "RuntimeError"},
+		{"try { try { 1 + true } catch (e) { throw e } } catch (e) { e[\"kind\"] }", "RuntimeError"},
+		{"try { try { len(1, 2) } catch (e) { throw e } } catch (e) { e[\"kind\"] }", "ArityError"},
+		{"try { try { throw 42 } catch (e) { throw e } } catch (e) { e[\"value\"] }", 42.0},
+		{"try { try { try { throw 42 } catch (e) { throw e } } catch (e) { throw e } } catch (e) { e[\"value\"] }", 42.0},
+		{"let f = fn() { throw \"deep\" }; let g = fn() { let r = f(); r }; try { try { g() } catch (e) { throw e } } catch (e) { len(e[\"trace\"]) }", 2.0},
+		{"try { throw \"x\" } catch (_) { 3 }", 3.0},
+		{"try { throw \"x\" } catch { 4 }", 4.0},
+		{"let f = fn() { throw \"deep\" }; let g = fn() { let r = f(); r }; try { g() } catch (e) { len(e[\"trace\"]) }", 2.0},
+		{"let f = fn() { return len(1, 2) }; try { f() } catch (e) { 5 }", 5.0},
+		{"let f = fn() { try { return len(1, 2) } catch (e) { 6 } }; f()", 6.0},
+		{"let f = fn() { try { 1 } finally { throw \"from finally\" } }; try { f() } catch (e) { e[\"message\"] }", "from finally"},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", 1.0},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2.0},
+		{"let f = fn() { try { throw \"a\" } catch (e) { return 7 } 8 }; f()", 7.0},
+		{"try { throw \"a\" } finally { 1 }", "a"},
+		{"throw \"uncaught\"", "uncaught"},
+		{"try { throw \"a\" } catch ([x]) { x }", "cannot destructure HASH with array pattern [x]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+				}
+			default:
+				t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	// A caught error thrown again is the same error.
+	errObj, ok := s.eval("try { len(1, 2) } catch (e) { throw e }").(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for a rethrown error")
+	}
+	if errObj.Message != "function `len` expects 1 argument, got 2" || !errors.Is(errObj.Cause, interpreter.ErrArity) || errObj.Value != nil {
+		t.Errorf("rethrown error changed. got=%+v", errObj)
+	}
+
+	// Blocks without a value yield nil.
+	for _, input := range []string{
+		"print(try { let y = 1 } catch (e) { 1 })",
+		"print(try { throw 1 } catch (e) { let z = 1 })",
+		"print(try { } finally { let z = 1 })",
+	} {
+		if got := s.output(input); got != "nil\n" {
+			t.Errorf("wrong output for %q. got=%q", input, got)
+		}
+	}
+}
+
+func (s *suite) finallyRunsOnce(t *testing.T) {
+	var out bytes.Buffer
+	input := `
+let f = fn(x) {
+	try { if (x) { throw "bad" } "ok" } catch (e) { print("caught " + e["message"]) } finally { print("finally") }
+};
+f(false);
+f(true);`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	s.newEngine(interpreter.WithStdout(&out)).Eval(context.Background(), program, object.NewEnvironment())
+
+	expected := "finally\ncaught bad\nfinally\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func (s *suite) limitErrorsAreNotCatchable(t *testing.T) {
+	input := `
+let loop = fn(n) { loop(n + 1) };
+try { loop(0) } catch (e) { "caught" } finally { "finally" }`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	in := s.newEngine(interpreter.WithLimits(interpreter.Limits{MaxSteps: 1000}))
+
+	errObj, ok := in.Eval(context.Background(), program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if !errors.Is(errObj.Cause, interpreter.ErrLimitExceeded) {
+		t.Errorf("wrong error cause. got=%v", errObj.Cause)
+	}
+}
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func evalFile(in Engine, path string) object.Object {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	program := parser.New(lexer.New(string(src))).ParseProgram()
+	return in.EvalFile(context.Background(), path, program, object.NewEnvironment())
+}
+
+func (s *suite) modules(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/geometry.sp": `
+import "./consts.sp" as consts;
+export let pi = consts["pi"];
+export fn area(r) { pi * r * r }
+let secret = 1;
+print("loading geometry");`,
+		"lib/consts.sp":     `export let [pi, e] = [3, 2];`,
+		"vendor/strings.sp": `export fn shout(s) { s + "!" }`,
+		"a.sp":              `import "b.sp" as b;`,
+		"b.sp":              `import "c" as c;`,
+		"c.sp":              `import "a.sp" as a;`,
+		"broken.sp":         `let x = ;`,
+		"failing.sp":        `export let x = 1 + true;`,
+		"config.sp":         `export const config = freeze({"port": 80});`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/geometry.sp" as geo; geo["area"](2);`, 12.0},
+		{`import { area, pi as PI } from "lib/geometry"; area(1) + PI;`, 6.0},
+		{`import "lib/geometry.sp" as geo; geo;`, "<module geometry>"},
+		{`import "lib/geometry.sp" as geo; geo["secret"];`, "module geometry does not export `secret`"},
+		{`import { secret } from "lib/geometry.sp"; secret;`, "module geometry does not export `secret`"},
+		{`import { e } from "lib/consts.sp"; e;`, 2.0},
+		{`import { shout } from "strings.sp"; shout("hi");`, "hi!"},
+		{`import "./strings.sp" as s;`, `module "./strings.sp" not found`},
+		{`import "missing.sp" as m;`, `module "missing.sp" not found`},
+		{`import "a.sp" as a;`, "import cycle: a.sp -> b.sp -> c.sp -> a.sp"},
+		{`import "broken.sp" as b;`, `cannot import "broken.sp": no unary parse function for ; found`},
+		{`import "failing.sp" as f;`, "type mismatch: NUMBER + BOOLEAN"},
+		{`let f = fn() { import "lib/consts.sp" as c; c }; f();`, "import is only allowed at the top level"},
+		{`let f = fn() { export let x = 1; x }; f();`, "export is only allowed at the top level"},
+		{`export let x = 5; x;`, 5.0},
+		{`import { config } from "config.sp"; config.port;`, 80.0},
+		{`import { config } from "config.sp"; config.port = 1;`, "cannot modify frozen HASH"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		in := s.newEngine(interpreter.WithStdout(&out), interpreter.WithModulePath(filepath.Join(dir, "vendor")))
+
+		main := filepath.Join(dir, "main.sp")
+		if err := os.WriteFile(main, []byte(tt.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		evaluated := evalFile(in, main)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) modulesAreEvaluatedOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.sp": `print("loaded"); export let n = 1;`,
+		"user.sp":    `import { n } from "counter.sp"; export let m = n + 1;`,
+		"main.sp": `
+import { n } from "counter.sp";
+import { m } from "user.sp";
+import "counter.sp" as counter;
+n + m;`,
+	})
+
+	var out bytes.Buffer
+	in := s.newEngine(interpreter.WithStdout(&out))
+
+	testNumberObject(t, evalFile(in, filepath.Join(dir, "main.sp")), 3)
+	testNumberObject(t, evalFile(in, filepath.Join(dir, "main.sp")), 3)
+
+	if out.String() != "loaded\n" {
+		t.Errorf("module evaluated more than once. output=%q", out.String())
+	}
+}
+
+func (s *suite) memberAccessAndMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "Ada", "age": 36}; person.age`, 36.0},
+		{`let p = {"pos": {"x": 1, "y": 2}}; p.pos.x + p.pos.y`, 3.0},
+		{`let h = {"len": 7}; h.len`, 7.0},
+		{`let h = {"a": 1, "b": 2}; h.len()`, 2.0},
+		{"math.sqrt(16)", 4.0},
+		{"math.max(1, 5, 3) - math.min(4, 2)", 3.0},
+		{"math.floor(math.pi)", 3.0},
+		{"let sqrt = math.sqrt; sqrt(9)", 3.0},
+		{`str.upper("abc")`, "ABC"},
+		{`"a,b,c".split(",").join("-")`, "a-b-c"},
+		{`" hi ".trim().len()`, 2.0},
+		{`"ab".repeat(3)`, "ababab"},
+		{`"ab".repeat(1.5)`, "argument to `str.repeat` must be a non-negative integer, got 1.50"},
+		{`str.repeat("ab", 1e300)`, "`str.repeat` result is longer than 268435456 bytes"},
+		{`"ab".repeat(1e19)`, "`str.repeat` result is longer than 268435456 bytes"},
+		{`"".repeat(1e300)`, ""},
+		{"[1, 2, 3].map(fn(x) { x * 2 }).reduce(fn(acc, x) { acc + x }, 0)", 12.0},
+		{"[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 }).len()", 2.0},
+		{"arr.first(arr.reverse([1, 2, 3]))", 3.0},
+		{"[1, 2, 3].push(4).last()", 4.0},
+		{`{"b": 2, "a": 1}.keys().join(",")`, "a,b"},
+		{`if ([1, 2].contains(2)) { 1 } else { 0 }`, 1.0},
+		{"(5).abs()", "NUMBER has no member `abs`"},
+		{`let h = {"a": 1}; h.b`, "HASH has no member `b`"},
+		{"math.cube(2)", "module math does not export `cube`"},
+		{"[1].map(fn(x) { x + true })", "type mismatch: NUMBER + BOOLEAN"},
+		{`"abc".upper(1)`, "function `str.upper` expects 0 arguments, got 1"},
+		{"missing.x", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+				}
+			default:
+				t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func (s *suite) registerMethod(t *testing.T) {
+	in := s.newEngine()
+	in.RegisterMethod(object.NUMBER_OBJ, "double", func(args ...object.Object) object.Object {
+		return &object.Number{Value: args[0].(*object.Number).Value * 2}
+	})
+	in.RegisterNamespace("consts", map[string]object.Object{
+		"answer": &object.Number{Value: 42},
+	})
+
+	p := parser.New(lexer.New("let n = 10; n.double() + consts.answer"))
+	program := p.ParseProgram()
+
+	testNumberObject(t, in.Eval(context.Background(), program, object.NewEnvironment()), 62)
+}
+
+func (s *suite) structs(t *testing.T) {
+	point := "struct Point { x, y }\n"
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let p = Point(1, 2); p.x + p.y", 3.0},
+		{"let p = Point(y: 2, x: 1); p.x", 1.0},
+		{"let p = Point(1, y: 5); p.y", 5.0},
+		{"let p = Point(1, 2); let q = p with { x: 3 }; p.x * 10 + q.x", 13.0},
+		{"let p = Point(1, 2); (p with { x: p.x + 1, y: 0 }).x", 2.0},
+		{"Point(1, 2)", "Point { x: 1.00, y: 2.00 }"},
+		{"Point", "<struct Point>"},
+		{"Point(1, 2) == Point(1, 2)", "true"},
+		{"Point(1, 2) != Point(2, 1)", "true"},
+		{"struct Other { x, y }; Point(1, 2) == Other(1, 2)", "false"},
+		{"Point(Point(0, 0), 1) == Point(Point(0, 0), 1)", "true"},
+		{"match (Point(1, 2)) { p if p == Point(1, 2) => p.y, _ => 0 }", 2.0},
+		{"let p = Point(1, 2); p.z", "struct Point has no field `z`"},
+		{"let p = Point(1, 2); p with { z: 1 }", "struct Point has no field `z`"},
+		{"Point(1)", "function `Point` expects 2 arguments, got 1"},
+		{"Point(1, 2, 3)", "function `Point` expects 2 arguments, got 3"},
+		{"Point(1, z: 2)", "struct Point has no field `z`"},
+		{"Point(1, x: 2)", "struct Point got multiple values for field `x`"},
+		{"let h = {}; h with { x: 1 }", "with expects STRUCT, got HASH"},
+		{"Point(1, 2) + 1", "type mismatch: STRUCT + NUMBER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(point + tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) enums(t *testing.T) {
+	shapes := `enum Shape { Circle(r), Rect(w, h), Empty }
+let area = fn(s) {
+	match (s) {
+		Circle(r) => 3 * r * r,
+		Shape.Rect(w, h) if w == h => w * w,
+		Rect(w, h) => w * h,
+		Shape.Empty => 0
+	}
+};
+`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"area(Circle(2))", 12.0},
+		{"area(Shape.Rect(2, 3))", 6.0},
+		{"area(Rect(h: 4, w: 4))", 16.0},
+		{"area(Empty)", 0.0},
+		{"area(Shape.Empty)", 0.0},
+		{"Rect(2, 3).h", 3.0},
+		{"Circle(2)", "Circle(2.00)"},
+		{"Empty", "Empty"},
+		{"Shape", "<enum Shape>"},
+		{"Shape.Circle", "<variant Shape.Circle>"},
+		{"Circle(1) == Circle(1)", "true"},
+		{"Circle(1) == Circle(2)", "false"},
+		{"Empty == Shape.Empty", "true"},
+		{"enum Other { Circle(r) }; Circle(1) == Shape.Circle(1)", "false"},
+		{"match (Circle(1)) { Shape.Circle => 1, _ => 0 }", 1.0},
+		{"match ([Circle(1), Empty]) { [Circle(a), Empty()] => a }", 1.0},
+		{"let [Circle(r)] = [Circle(5)]; r", 5.0},
+		{"area(1)", "no match arm matches 1.00"},
+		{"match (Circle(1)) { Circle(a, b) => 1 }", "variant pattern Circle(a, b) expects 1 field, got 2"},
+		{"match (Circle(1)) { Square(s) => 1 }", "identifier not found: Square"},
+		{"let n = 1; match (Circle(1)) { n(s) => 1 }", "n is not an enum variant, got NUMBER"},
+		{"Shape.Square", "enum Shape has no variant `Square`"},
+		{"Circle(1).x", "variant Circle has no field `x`"},
+		{"Circle()", "function `Circle` expects 1 argument, got 0"},
+		{"Circle(q: 1)", "variant Circle has no field `q`"},
+		{"Empty(1)", "not a function: ENUM"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(shapes + tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) assignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = x + 1; x", 2.0},
+		{"let x = 1; let y = 2; x = y = 5; x + y", 10.0},
+		{"let x = 1; let f = fn() { x = 10 }; f(); x", 10.0},
+		{"let x = 1; let f = fn(x) { x = 10 }; f(2); x", 1.0},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }(); counter(); counter()", 2.0},
+		{"let xs = [1, 2, 3]; xs[1] = 20; xs[1] + xs[2]", 23.0},
+		{"let xs = [1]; let ys = xs; ys[0] = 5; xs[0]", 5.0},
+		{`let h = {"a": 1}; h["b"] = 2; h.c = 3; h["a"] + h.b + h["c"]`, 6.0},
+		{`let h = {"a": 1}; h.a = 5; len(h) * 10 + h.a`, 15.0},
+		{"y = 1", "cannot assign to undefined variable `y`"},
+		{"let xs = [1]; xs[1] = 2", "index 1.00 out of range for array of length 1"},
+		{"let xs = [1]; xs[0.5] = 2", "index 0.50 out of range for array of length 1"},
+		{`let xs = [1]; xs["a"] = 2`, "array index must be NUMBER, got STRING"},
+		{`let s = "ab"; s[0] = "c"`, "index assignment not supported: STRING"},
+		{"let h = {}; h[fn() { 1 }] = 2", "unusable as hash key: FUNCTION"},
+		{"struct P { x }; let p = P(1); p.x = 2", "cannot assign to field `x` of struct P, use with to update it"},
+		{"let n = 1; n.x = 2", "cannot assign to member `x` of NUMBER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func (s *suite) selfReferentialContainers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let h = {}; h.self = h; h", "{self: {...}}"},
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{"let a = [1]; let h = {}; h.a = a; a[0] = h; [a, h]", "[[{a: [...]}], {a: [{...}]}]"},
+		{"let b = [1]; [b, b]", "[[1.00], [1.00]]"},
+		{"class Node { init() { self.next = self } }; Node()", "Node { next: Node {...} }"},
+		{"struct Box { item }; let a = [1]; let b = Box(a); a[0] = b; b", "Box { item: [Box {...}] }"},
+		{"let a = [1]; a[0] = a; a == a", "true"},
+		{"let h = {}; h.self = h; [h == h.self, h == {}]", "[true, false]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func (s *suite) classes(t *testing.T) {
+	accounts := `class Account {
+	init(balance, owner = "ada") {
+		self.balance = balance;
+		self.owner = owner;
+	}
+	deposit(x) { self.balance = self.balance + x; self }
+	total() { self.balance }
+}
+class Savings extends Account {
+	init(balance, rate) {
+		super.init(balance);
+		self.rate = rate;
+	}
+	deposit(x) { super.deposit(x + 1) }
+	interest() { self.total() * self.rate }
+}
+class Empty {}
+`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = Account(10); a.deposit(5).deposit(5); a.balance", 20.0},
+		{"let a = Account(10); let d = a.deposit; d(1); a.total()", 11.0},
+		{"let s = Savings(100, 0.5); s.deposit(9); s.balance", 110.0},
+		{"let s = Savings(100, 0.5); s.interest()", 50.0},
+		{"let a = Account(owner: \"bob\", balance: 1); a.owner", "bob"},
+		{"let a = Account(1); a.double = fn(x) { x * 2 }; a.double(4)", 8.0},
+		{"let a = Account(1); a.total = fn() { 7 }; a.total()", 7.0},
+		{"let a = Account(1); let b = Account(1); a == b", "false"},
+		{"let a = Account(1); a == a", "true"},
+		{"Account(1, \"bob\")", "Account { balance: 1.00, owner: bob }"},
+		{"Savings", "<class Savings>"},
+		{"Empty()", "Empty {}"},
+		{"let e = Empty(); e.x = 1; e.x", 1.0},
+		{"let a = Account(1); a.missing", "Account has no member `missing`"},
+		{"Account()", "function `Account.init` expects 1 to 2 arguments, got 0"},
+		{"Empty(1)", "function `Empty` expects 0 arguments, got 1"},
+		{"class Broken extends Empty { f() { super.g() } }; Broken().f()", "superclass Empty has no method `g`"},
+		{"let x = 1; class Bad extends x {}", "class Bad cannot extend NUMBER, expected CLASS"},
+		{"let a = Account(1); self", "identifier not found: self"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(accounts + tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) constAndFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const x = 1; x", 1.0},
+		{"const [a, {b}] = [1, {\"b\": 2}]; a + b", 3.0},
+		{"const x = 1; let f = fn() { let x = 2; x }; f() + x", 3.0},
+		{"const x = 1; let f = fn(x) { x = 5; x }; f(0)", 5.0},
+		{"let x = 1; const y = x; x = 2; x + y", 3.0},
+		{"const x = 1; x = 2", "cannot assign to constant `x`"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "cannot assign to constant `x`"},
+		{"const [a, b] = [1, 2]; b = 3", "cannot assign to constant `b`"},
+		{"const x = 1; let x = 2", "cannot redeclare constant `x`"},
+		{"const x = 1; const x = 2", "cannot redeclare constant `x`"},
+		{"const f = 1; fn f() { 2 }", "cannot redeclare constant `f`"},
+		{"const Point = 1; struct Point { x }", "cannot redeclare constant `Point`"},
+		{"const Ok = 1; enum Result { Ok(v) }", "cannot redeclare constant `Ok`"},
+		{"const A = 1; class A {}", "cannot redeclare constant `A`"},
+		{"let x = 1; let x = 2; x", 2.0},
+		{"const xs = [1]; let ys = push(xs, 2); ys[1] = 3; ys[1]", 3.0},
+		{"let xs = freeze([1, [2]]); xs[0] = 5", "cannot modify frozen ARRAY"},
+		{"let xs = freeze([1, [2]]); xs[1][0] = 5", "cannot modify frozen ARRAY"},
+		{`let h = freeze({"db": {"port": 1}}); h.db.port = 2`, "cannot modify frozen HASH"},
+		{`let h = freeze({"a": 1}); h["b"] = 2`, "cannot modify frozen HASH"},
+		{"class A { init() { self.x = [1] } }; let a = freeze(A()); a.x = 2", "cannot modify frozen A instance"},
+		{"class A { init() { self.x = [1] } }; let a = freeze(A()); a.x[0] = 2", "cannot modify frozen ARRAY"},
+		{"struct P { xs }; let p = freeze(P([1])); p.xs[0] = 2", "cannot modify frozen ARRAY"},
+		{"let xs = [1]; xs[0] = xs; freeze(xs); frozen(xs)", "true"},
+		{"frozen([1])", "false"},
+		{"frozen(1)", "true"},
+		{`let h = freeze({"a": 1}); let g = h; g.a`, 1.0},
+		{"freeze()", "function `freeze` expects 1 argument, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+				}
+			default:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func (s *suite) blockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; if (true) { let x = 2; }; x", 1.0},
+		{"let x = 1; if (false) { 0 } else { let x = 2; }; x", 1.0},
+		{"let x = 1; let y = if (true) { let x = 2; x * 10 }; x + y", 21.0},
+		{"let x = 1; if (true) { x = 2; }; x", 2.0},
+		{"let x = 1; if (true) { let x = 5; x = 3; }; x", 1.0},
+		{"if (true) { let leaked = 1; }; leaked", "identifier not found: leaked"},
+		{"if (false) { 0 } else { let leaked = 1; }; leaked", "identifier not found: leaked"},
+		{"try { let leaked = 1; } catch { 0 }; leaked", "identifier not found: leaked"},
+		{"try { throw 1 } catch (e) { let leaked = e; }; leaked", "identifier not found: leaked"},
+		{"try { 0 } finally { let leaked = 1; }; leaked", "identifier not found: leaked"},
+		{"match (1) { n => { let leaked = n; } }; leaked", "identifier not found: leaked"},
+		{"let x = 1; let f = fn() { let x = 2; x }; f() * 10 + x", 21.0},
+		{"const x = 1; if (true) { let x = 2; x }", 2.0},
+		{"const x = 1; if (true) { const x = 2; x }", 2.0},
+		{"if (true) { let x = 1; let x = 2; x }", 2.0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { let m = n - 1; f(m) } }; f(5000)", 0.0},
+		{"if (true) { import \"m.sp\" as m; }", "import is only allowed at the top level"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func (s *suite) resolvedLookups(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; if (true) { let y = x; let x = 2; y * 10 + x }", 12.0},
+		{"let x = 1; if (true) { let x = x + 1; x }", 2.0},
+		{"let f = fn() { let a = fn() { b() }; let b = fn() { 7 }; a() }; f()", 7.0},
+		{"let b = fn() { 1 }; let f = fn() { let a = fn() { b() }; let r = a(); let b = fn() { 2 }; r * 10 + a() }; f()", 12.0},
+		{"let f = fn(n, acc) { if (n == 0) { acc } else { let m = n - 1; f(m, acc + n) } }; f(100, 0)", 5050.0},
+		{"let add = fn(a) { fn(b) { fn(c) { a + b + c } } }; add(1)(2)(3)", 6.0},
+		{"let f = fn([a, b], {c}, ...rest) { a + b + c + len(rest) }; f([1, 2], {\"c\": 3}, 0, 0)", 8.0},
+		{"let f = fn(x) { match (x) { [h, ...t] if h > 0 => h + len(t), n => 0 } }; f([5, 1, 1])", 7.0},
+		{"let f = fn() { try { throw 4 } catch (e) { let d = e[\"value\"] * 2; d } }; f()", 8.0},
+		{"class A { init(x) { self.x = x } get() { self.x } } class B extends A { get() { super.get() * 2 } }; B(21).get()", 42.0},
+		{"let f = fn() { let x = 1; let g = fn() { x = x + 1; x }; g(); g() }; f()", 3.0},
+		{"let f = fn() { undefined_name }; f()", "identifier not found: undefined_name"},
+	}
+
+	for _, tt := range tests {
+		evaluated := s.eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testNumberObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func (s *suite) staticChecks(t *testing.T) {
+	input := `let f = fn() {
+	let unused = 1;
+	missing + 1
+};
+print("ran");
+other`
+
+	var stdout, stderr bytes.Buffer
+	in := s.newEngine(interpreter.WithStdout(&stdout), interpreter.WithStderr(&stderr), interpreter.WithStaticChecks())
+
+	p := parser.New(lexer.New(input))
+	evaluated := in.Eval(context.Background(), p.ParseProgram(), object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := "line 3: undefined variable `missing`; line 6: undefined variable `other`"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("program ran despite errors. got=%q", stdout.String())
+	}
+
+	p = parser.New(lexer.New("let f = fn() { let unused = 1; 0 };\nprint(f())"))
+	in.Eval(context.Background(), p.ParseProgram(), object.NewEnvironment())
+
+	if got := stderr.String(); got != "warning: line 1: unused variable `unused`\n" {
+		t.Errorf("wrong warnings. got=%q", got)
+	}
+	if got := stdout.String(); got != "0.00\n" {
+		t.Errorf("program with warnings did not run. got=%q", got)
+	}
+}
+
+func (s *suite) shadowWarnings(t *testing.T) {
+	input := `let x = 1;
+let f = fn(n) {
+	let x = n;
+	let y = n;
+	if (n > 0) { f(n - 1) } else { x }
+};
+if (true) { let [x, z] = [1, 2]; let x = 3; }
+let x = 2;
+f(3);`
+
+	var stderr bytes.Buffer
+	in := s.newEngine(interpreter.WithStderr(&stderr), interpreter.WithShadowWarnings())
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	in.Eval(context.Background(), program, object.NewEnvironment())
+
+	expected := "warning: line 7: `x` shadows a variable of an enclosing scope\n" +
+		"warning: line 3: `x` shadows a variable of an enclosing scope\n"
+	if stderr.String() != expected {
+		t.Errorf("wrong warnings. expected=%q, got=%q", expected, stderr.String())
+	}
+
+	stderr.Reset()
+	in = s.newEngine(interpreter.WithStderr(&stderr))
+	in.Eval(context.Background(), program, object.NewEnvironment())
+
+	if stderr.Len() != 0 {
+		t.Errorf("warnings reported without interpreter.WithShadowWarnings. got=%q", stderr.String())
+	}
+}
+
+func (s *suite) upvalues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"let pair = fn() { let n = 0; [fn() { n = n + 1 }, fn() { n }] }; let [inc, get] = pair(); inc(); inc(); get()", 2},
+		{"let f = fn() { let n = 1; let g = fn() { n }; n = 5; g() }; f()", 5},
+		{"let a = fn(x) { fn(y) { fn(z) { x = x + 1; x + y + z } } }; let c = a(1)(2); c(3) + c(3)", 15},
+		{"let f = fn(n) { if (n > 0) { let k = n; fn() { k } } else { fn() { 0 } } }; f(3)() + f(0)()", 3},
+		{"let f = fn() { let x = 1; try { x = 2; throw x } catch (e) { x = x + e[\"value\"] }; x }; f()", 4},
+	}
+
+	for _, tt := range tests {
+		testNumberObject(t, s.eval(tt.input), tt.expected)
+	}
+}
+
+// optimizedPrograms exercise every rewrite of the optimizer, including the
+// cases it must leave alone.
+var optimizedPrograms = []string{
+	"4 / 24 + (2 * 3) * (2 * 3 + 1)",
+	`"con" + "cat" + "enation"`,
+	"let n = 3; (2 * n) * (2 * n + 1)",
+	"[1 < 2, 2 <= 2, 3 > 4, 4 >= 5, 1 == 1, 1 != 1, !true, !0, -(-2)]",
+	"[true == true, true == false, 1 == true, 2 ** 3 % 3]",
+	`"a" - "b"`,
+	`"a" == "a"`,
+	"1 + true",
+	"-true",
+	"if (true) { 1 } else { 2 }",
+	"if (false) { 1 } else { 2 }",
+	"if (false) { 1 }",
+	"let x = 1; if (true) { x = x + 1; x * 10 }",
+	"let x = 1; if (true) { let x = 2; x }; x",
+	"let f = fn() { if (true) { return 1 }; 2 }; f()",
+	"let f = fn() { return 1; throw \"unreachable\" }; f()",
+	"let f = fn() { throw \"boom\"; 1 }; try { f() } catch (e) { e.message }",
+	"fn double(x) { x * 2 }; double(21) + double(0.5)",
+	"const double = fn(x) { x * 2 }; double(21) + double(0.5)",
+	"const sq = fn(x) { x * x }; let n = 7; sq(n) + sq(2)",
+	"const sub = fn(a, b) { return a - b }; let a = 1; let b = 10; sub(b, a)",
+	`const greet = fn(name) { "hi " + name }; greet("bo")`,
+	"const at = fn(xs, i) { xs[i] }; let xs = [1, 2]; [at(xs, 1), at([3], 0)]",
+	"const double = fn(x) { x * 2 }; double(missing)",
+	`const double = fn(x) { x * 2 }; double("a")`,
+	"let inc = fn(x) { x + 1 }; inc = fn(x) { x - 1 }; inc(1)",
+	"let inc = fn(x) { x + 1 }; let apply = fn(inc) { inc(1) }; apply(fn(x) { x * 10 })",
+	"let f = fn() { later(1) }; let later = fn(x) { x * 3 }; f()",
+	"let z = 0; 1 / (0 * -1)",
+}
+
+func (s *suite) optimizations(t *testing.T) {
+	for _, input := range optimizedPrograms {
+		expected := s.eval(input)
+
+		program := parser.New(lexer.New(input)).ParseProgram()
+		got := s.newEngine(interpreter.WithOptimizations()).Eval(context.Background(), program, object.NewEnvironment())
+
+		if got.Type() != expected.Type() || got.Inspect() != expected.Inspect() {
+			t.Errorf("optimized %q evaluated differently.\nwant=%s\ngot=%s", input, expected.Inspect(), got.Inspect())
+		}
+	}
+
+	// 0 * -1 folds to the constant -0, which must not be taken for 0.
+	var stdout bytes.Buffer
+	program := parser.New(lexer.New("print(0); print(1 / (0 * -1))")).ParseProgram()
+	s.newEngine(interpreter.WithOptimizations(), interpreter.WithStdout(&stdout)).Eval(context.Background(), program, object.NewEnvironment())
+	if got := stdout.String(); got != "0.00\n-Inf\n" {
+		t.Errorf("wrong output for -0. got=%q", got)
+	}
+}
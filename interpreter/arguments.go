@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// namedArg is a call argument passed by parameter name.
+type namedArg struct {
+	name  string
+	value object.Object
+}
+
+// evalArguments evaluates the arguments of a call. Spread arrays are
+// expanded into positional arguments, and named arguments, which the parser
+// only accepts after the positional ones, are returned separately.
+func (in *Interpreter) evalArguments(exps []ast.Expression, env *object.Environment) ([]object.Object, []namedArg, object.Object) {
+	positional := exps
+	for i, e := range exps {
+		if _, ok := e.(*ast.NamedArgument); ok {
+			positional = exps[:i]
+			break
+		}
+	}
+
+	args := in.evalExpressions(positional, env)
+	if len(args) == 1 && isError(args[0]) {
+		return nil, nil, args[0]
+	}
+
+	var named []namedArg
+	for _, e := range exps[len(positional):] {
+		arg := e.(*ast.NamedArgument)
+
+		value := in.eval(arg.Value, env)
+		if isError(value) {
+			return nil, nil, value
+		}
+
+		named = append(named, namedArg{name: arg.Name.Value, value: value})
+	}
+
+	return args, named, nil
+}
+
+// bindArguments creates the environment for a call of fn named name.
+// Positional arguments fill the parameters in order and any surplus is
+// collected by the variadic parameter. Named arguments then fill parameters
+// by name. Parameters left without a value take their default, which is
+// evaluated in the new environment so it can refer to earlier parameters,
+// and pattern parameters destructure their value.
+func (in *Interpreter) bindArguments(fn *object.Function, args []object.Object, named []namedArg, name string) (*object.Environment, *object.Error) {
+	params := fn.Parameters
+
+	var variadic *ast.Parameter
+	if len(params) > 0 && params[len(params)-1].Variadic {
+		variadic = params[len(params)-1]
+		params = params[:len(params)-1]
+	}
+
+	required := 0
+	for _, param := range params {
+		if param.Default == nil {
+			required++
+		}
+	}
+
+	maxArgs := len(params)
+	if variadic != nil {
+		maxArgs = -1
+	}
+	if err := checkArgCount(name, len(args)+len(named), required, maxArgs); err != nil {
+		return nil, err
+	}
+
+	values := make([]object.Object, len(params))
+	copy(values, args)
+
+	for _, arg := range named {
+		idx := -1
+		for i, param := range params {
+			if param.Name != nil && param.Name.Value == arg.name {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			return nil, newError("function `%s` has no parameter `%s`", name, arg.name)
+		}
+		if values[idx] != nil {
+			return nil, newError("function `%s` got multiple values for parameter `%s`", name, arg.name)
+		}
+		values[idx] = arg.value
+	}
+
+	env := object.NewScopedEnvironment(fn.Env, fn.Body.Scope)
+
+	for i, param := range params {
+		value := values[i]
+		if value == nil {
+			if param.Default == nil {
+				return nil, newError("function `%s` missing argument for parameter `%s`", name, param)
+			}
+
+			value = in.eval(param.Default, env)
+			if errObj, ok := value.(*object.Error); ok {
+				return nil, errObj
+			}
+		}
+
+		if param.Pattern != nil {
+			if err := in.bindPattern(param.Pattern, value, env); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		env.Set(param.Name.Value, value)
+	}
+
+	if variadic != nil {
+		rest := make([]object.Object, 0)
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+
+		if err := in.alloc(len(rest) + 1); err != nil {
+			return nil, err
+		}
+		env.Set(variadic.Name.Value, &object.Array{Elements: rest})
+	}
+
+	return env, nil
+}
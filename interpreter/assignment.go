@@ -0,0 +1,136 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// evalAssignExpression evaluates the target's object and index before the
+// value, then stores the value and returns it. Variables, elements and
+// fields are all assigned with this one expression, which class methods
+// need to update their fields; const and freeze opt out of it.
+func (in *Interpreter) evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		value := in.eval(ae.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		if env.IsConst(target.Value) {
+			return newError("cannot assign to constant `%s`", target.Value)
+		}
+		if !env.Assign(target.Value, value) {
+			return newError("cannot assign to undefined variable `%s`", target.Value)
+		}
+		return value
+	case *ast.IndexExpression:
+		left := in.eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := in.eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		value := in.eval(ae.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		if err := in.assignIndex(left, index, value); err != nil {
+			return err
+		}
+		return value
+	case *ast.MemberExpression:
+		obj := in.eval(target.Object, env)
+		if isError(obj) {
+			return obj
+		}
+
+		value := in.eval(ae.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		if err := in.assignMember(obj, target.Property.Value, value); err != nil {
+			return err
+		}
+		return value
+	default:
+		return newError("invalid assignment target %s", ae.Target)
+	}
+}
+
+func (in *Interpreter) assignIndex(left, index, value object.Object) *object.Error {
+	switch left := left.(type) {
+	case *object.Array:
+		if left.Frozen {
+			return newFrozenError(left)
+		}
+
+		number, ok := index.(*object.Number)
+		if !ok {
+			return newError("array index must be NUMBER, got %s", index.Type())
+		}
+
+		i := int(number.Value)
+		if float64(i) != number.Value || i < 0 || i >= len(left.Elements) {
+			return newError("index %s out of range for array of length %d", number.Inspect(), len(left.Elements))
+		}
+
+		left.Elements[i] = value
+		return nil
+	case *object.Hash:
+		return in.setHashPair(left, index, value)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func (in *Interpreter) assignMember(obj object.Object, name string, value object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Instance:
+		if obj.Frozen {
+			return newFrozenError(obj)
+		}
+
+		if _, ok := obj.Fields[name]; !ok {
+			if err := in.alloc(1); err != nil {
+				return err
+			}
+		}
+
+		obj.Set(name, value)
+		return nil
+	case *object.Hash:
+		return in.setHashPair(obj, &object.String{Value: name}, value)
+	case *object.Struct:
+		return newError("cannot assign to field `%s` of struct %s, use with to update it", name, obj.StructType.Name)
+	default:
+		return newError("cannot assign to member `%s` of %s", name, obj.Type())
+	}
+}
+
+func (in *Interpreter) setHashPair(hash *object.Hash, key, value object.Object) *object.Error {
+	if hash.Frozen {
+		return newFrozenError(hash)
+	}
+
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", key.Type())
+	}
+
+	hashKey := hashable.HashKey()
+	if _, ok := hash.Pairs[hashKey]; !ok {
+		if err := in.alloc(1); err != nil {
+			return err
+		}
+	}
+
+	hash.Pairs[hashKey] = object.HashPair{Key: key, Value: value}
+	return nil
+}
@@ -1,110 +1,231 @@
 package interpreter
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/darwin1224/saphire/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   &object.Builtin{Fn: lenBuiltin},
-	"first": &object.Builtin{Fn: firstBuiltin},
-	"last":  &object.Builtin{Fn: lastBuiltin},
-	"rest":  &object.Builtin{Fn: restBuiltin},
-	"push":  &object.Builtin{Fn: pushBuiltin},
-	"print": &object.Builtin{Fn: printBuiltin},
+// ErrArity is the Cause of errors reporting a call with the wrong number of
+// arguments.
+var ErrArity = errors.New("wrong number of arguments")
+
+func (in *Interpreter) newBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"len":    lenFunction("len"),
+		"first":  firstFunction("first"),
+		"last":   lastFunction("last"),
+		"rest":   restFunction("rest"),
+		"push":   pushFunction("push"),
+		"print":  &object.Builtin{Name: "print", Fn: in.printBuiltin},
+		"eprint": &object.Builtin{Name: "eprint", Fn: in.eprintBuiltin},
+		"input":  &object.Builtin{Name: "input", Fn: in.inputBuiltin},
+		"freeze": &object.Builtin{Name: "freeze", Fn: freezeBuiltin},
+		"frozen": &object.Builtin{Name: "frozen", Fn: frozenBuiltin},
+	}
+}
+
+// CheckArity returns an error unless the function name was called with at
+// least min and at most max arguments. A negative max allows any number of
+// arguments above min. Builtins registered by host programs should use it
+// to report arity errors the same way as the language does.
+func CheckArity(name string, args []object.Object, min, max int) *object.Error {
+	return checkArgCount(name, len(args), min, max)
 }
 
-func lenBuiltin(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments, got=%d, want=1", len(args))
+func checkArgCount(name string, got, min, max int) *object.Error {
+	if got >= min && (max < 0 || got <= max) {
+		return nil
 	}
 
-	switch arg := args[0].(type) {
-	case *object.String:
-		return &object.Number{Value: float64(len(arg.Value))}
-	case *object.Array:
-		return &object.Number{Value: float64(len(arg.Elements))}
-	case *object.Hash:
-		return &object.Number{Value: float64(len(arg.Pairs))}
+	var want string
+	switch {
+	case max < 0:
+		want = "at least " + pluralize(min, "argument")
+	case min == max:
+		want = pluralize(min, "argument")
+	case min == 0:
+		want = "at most " + pluralize(max, "argument")
 	default:
-		return newError("argument to `len` not supported, got %s", args[0].Type())
+		want = fmt.Sprintf("%d to %d arguments", min, max)
 	}
+
+	err := newError("function `%s` expects %s, got %d", name, want, got)
+	err.Cause = &arityError{name: name, got: got, min: min, max: max}
+	return err
 }
 
-func firstBuiltin(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1", len(args))
-	}
-	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
-	}
+// arityError is the Cause of the errors of checkArgCount, which records the
+// check that failed.
+type arityError struct {
+	name          string
+	got, min, max int
+}
 
-	arr := args[0].(*object.Array)
-	if len(arr.Elements) > 0 {
-		return arr.Elements[0]
-	}
+func (e *arityError) Error() string { return ErrArity.Error() }
 
-	return NIL
-}
+func (e *arityError) Is(target error) bool { return target == ErrArity }
 
-func lastBuiltin(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1", len(args))
-	}
-	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+// uncountReceiver returns result, the result of calling method with its
+// receiver followed by args, with an arity error raised by method itself
+// reported as if the receiver were not an argument.
+func uncountReceiver(result, method object.Object, args int) object.Object {
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result
 	}
 
-	arr := args[0].(*object.Array)
-	length := len(arr.Elements)
-	if length > 0 {
-		return arr.Elements[length-1]
+	var arity *arityError
+	builtin, ok := method.(*object.Builtin)
+	if !ok || !errors.As(errObj.Cause, &arity) || arity.name != builtin.Name || arity.got != args+1 {
+		return result
 	}
 
-	return NIL
+	min, max := arity.min-1, arity.max
+	if max > 0 {
+		max--
+	}
+	err := checkArgCount(arity.name, args, min, max)
+	err.Trace = errObj.Trace
+	return err
 }
 
-func restBuiltin(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1", len(args))
-	}
-	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
 	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
 
-	arr := args[0].(*object.Array)
-	length := len(arr.Elements)
-	if length > 0 {
-		newElements := make([]object.Object, length-1, length-1)
-		copy(newElements, arr.Elements[1:length])
-		return &object.Array{Elements: newElements}
-	}
+func lenFunction(name string) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+
+		switch arg := args[0].(type) {
+		case *object.String:
+			return &object.Number{Value: float64(len(arg.Value))}
+		case *object.Array:
+			return &object.Number{Value: float64(len(arg.Elements))}
+		case *object.Hash:
+			return &object.Number{Value: float64(len(arg.Pairs))}
+		default:
+			return newError("argument to `%s` not supported, got %s", name, args[0].Type())
+		}
+	}}
+}
 
-	return NIL
+func firstFunction(name string) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+		if args[0].Type() != object.ARRAY_OBJ {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
+
+		arr := args[0].(*object.Array)
+		if len(arr.Elements) > 0 {
+			return arr.Elements[0]
+		}
+
+		return NIL
+	}}
 }
 
-func pushBuiltin(args ...object.Object) object.Object {
-	if len(args) != 2 {
-		return newError("wrong number of arguments. got=%d, want=2", len(args))
-	}
-	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-	}
+func lastFunction(name string) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+		if args[0].Type() != object.ARRAY_OBJ {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
+
+		arr := args[0].(*object.Array)
+		length := len(arr.Elements)
+		if length > 0 {
+			return arr.Elements[length-1]
+		}
+
+		return NIL
+	}}
+}
+
+func restFunction(name string) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+		if args[0].Type() != object.ARRAY_OBJ {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
+
+		arr := args[0].(*object.Array)
+		length := len(arr.Elements)
+		if length > 0 {
+			newElements := make([]object.Object, length-1, length-1)
+			copy(newElements, arr.Elements[1:length])
+			return &object.Array{Elements: newElements}
+		}
+
+		return NIL
+	}}
+}
 
-	arr := args[0].(*object.Array)
-	length := len(arr.Elements)
+func pushFunction(name string) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 2, 2); err != nil {
+			return err
+		}
+		if args[0].Type() != object.ARRAY_OBJ {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
 
-	newElements := make([]object.Object, length+1, length+1)
-	copy(newElements, arr.Elements)
-	newElements[length] = args[1]
+		arr := args[0].(*object.Array)
+		length := len(arr.Elements)
 
-	return &object.Array{Elements: newElements}
+		newElements := make([]object.Object, length+1, length+1)
+		copy(newElements, arr.Elements)
+		newElements[length] = args[1]
+
+		return &object.Array{Elements: newElements}
+	}}
 }
 
-func printBuiltin(args ...object.Object) object.Object {
+func (in *Interpreter) printBuiltin(args ...object.Object) object.Object {
 	for _, arg := range args {
-		fmt.Println(arg.Inspect())
+		fmt.Fprintln(in.stdout, arg.Inspect())
 	}
 	return NIL
 }
+
+func (in *Interpreter) eprintBuiltin(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(in.stderr, arg.Inspect())
+	}
+	return NIL
+}
+
+func (in *Interpreter) inputBuiltin(args ...object.Object) object.Object {
+	if err := CheckArity("input", args, 0, 1); err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		if args[0].Type() != object.STRING_OBJ {
+			return newError("argument to `input` must be STRING, got %s", args[0].Type())
+		}
+		io.WriteString(in.stdout, args[0].(*object.String).Value)
+	}
+
+	line, err := in.stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return NIL
+	}
+
+	return &object.String{Value: strings.TrimRight(line, "\r\n")}
+}
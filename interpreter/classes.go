@@ -0,0 +1,126 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/resolver"
+)
+
+func (in *Interpreter) evalClassStatement(cs *ast.ClassStatement, env *object.Environment) object.Object {
+	if err := checkRedeclare(env, cs.Name.Value); err != nil {
+		return err
+	}
+
+	class := &object.Class{Name: cs.Name.Value, Methods: make(map[string]object.Object)}
+
+	if cs.Superclass != nil {
+		superclass := in.eval(cs.Superclass, env)
+		if isError(superclass) {
+			return superclass
+		}
+
+		sc, ok := superclass.(*object.Class)
+		if !ok {
+			return newError("class %s cannot extend %s, expected CLASS", class.Name, superclass.Type())
+		}
+		class.Superclass = sc
+	}
+
+	for _, method := range cs.Methods {
+		class.Methods[method.Name] = &object.Function{
+			Name:       class.Name + "." + method.Name,
+			Parameters: method.Parameters,
+			Body:       method.Body,
+			Env:        env,
+		}
+	}
+
+	if err := in.alloc(len(class.Methods) + 1); err != nil {
+		return err
+	}
+
+	env.Set(class.Name, class)
+	return nil
+}
+
+// instantiate creates an instance of class and initializes it with the
+// `init` method, which receives the arguments of the call.
+func (in *Interpreter) instantiate(class *object.Class, args []object.Object, named []namedArg, call frame) object.Object {
+	if err := in.alloc(1); err != nil {
+		return err
+	}
+	instance := object.NewInstance(class)
+
+	init, owner, ok := class.FindMethod("init")
+	if !ok {
+		if err := checkArgCount(class.Name, len(args)+len(named), 0, 0); err != nil {
+			return err
+		}
+		return instance
+	}
+
+	bound, err := in.bindInstanceMethod(instance, init, owner)
+	if err != nil {
+		return err
+	}
+
+	if result := in.applyFunction(bound, args, named, call); isError(result) {
+		return result
+	}
+
+	return instance
+}
+
+// bindInstanceMethod returns method with `self` bound to instance and, if
+// owner, the class defining the method, extends another, `super` bound to
+// the superclass.
+func (in *Interpreter) bindInstanceMethod(instance *object.Instance, method object.Object, owner *object.Class) (*object.Function, *object.Error) {
+	fn, ok := method.(*object.Function)
+	if !ok {
+		return nil, newError("cannot bind method of class %s, got %s", owner.Name, method.Type())
+	}
+
+	if err := in.alloc(2); err != nil {
+		return nil, err
+	}
+
+	env := object.NewScopedEnvironment(fn.Env, resolver.MethodScope(owner.Superclass != nil))
+	env.Set("self", instance)
+	if owner.Superclass != nil {
+		env.Set("super", &object.Super{Self: instance, Class: owner.Superclass})
+	}
+
+	return &object.Function{Name: fn.Name, Parameters: fn.Parameters, Body: fn.Body, Env: env}, nil
+}
+
+// evalInstanceMember returns the field name of instance or, if it has no
+// such field, the method name of its class bound to it.
+func (in *Interpreter) evalInstanceMember(instance *object.Instance, name string) (object.Object, bool) {
+	if value, ok := instance.Fields[name]; ok {
+		return value, true
+	}
+
+	method, owner, ok := instance.Class.FindMethod(name)
+	if !ok {
+		return nil, false
+	}
+
+	bound, err := in.bindInstanceMethod(instance, method, owner)
+	if err != nil {
+		return err, true
+	}
+	return bound, true
+}
+
+func (in *Interpreter) evalSuperMember(super *object.Super, name string) object.Object {
+	method, owner, ok := super.Class.FindMethod(name)
+	if !ok {
+		return newError("superclass %s has no method `%s`", super.Class.Name, name)
+	}
+
+	bound, err := in.bindInstanceMethod(super.Self, method, owner)
+	if err != nil {
+		return err
+	}
+	return bound
+}
@@ -0,0 +1,138 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/token"
+)
+
+func (in *Interpreter) evalLetStatement(ls *ast.LetStatement, env *object.Environment) object.Object {
+	var names []string
+	if ls.Pattern != nil {
+		names = patternNames(ls.Pattern, names)
+	} else {
+		names = append(names, ls.Name.Value)
+	}
+
+	if err := checkRedeclare(env, names...); err != nil {
+		return err
+	}
+	in.warnShadowing(ls, env, names)
+
+	val := in.eval(ls.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if ls.Pattern != nil {
+		if err := in.bindPattern(ls.Pattern, val, env); err != nil {
+			return err
+		}
+	} else {
+		// Functions take the name of the binding they are defined in, so that
+		// Inspect and traces can refer to them.
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			if _, ok := ls.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = ls.Name.Value
+			}
+		}
+
+		env.Set(ls.Name.Value, val)
+	}
+
+	if ls.Token.Type == token.CONST {
+		for _, name := range names {
+			value, _ := env.Get(name)
+			env.SetConst(name, value)
+		}
+	}
+
+	return nil
+}
+
+// checkRedeclare reports an error if one of names is a constant declared
+// in env itself. Constants of enclosing environments may be shadowed.
+func checkRedeclare(env *object.Environment, names ...string) *object.Error {
+	for _, name := range names {
+		if env.Has(name) && env.IsConst(name) {
+			return newError("cannot redeclare constant `%s`", name)
+		}
+	}
+	return nil
+}
+
+// freezeBuiltin makes arrays, hashes and instances immutable, along with
+// every value they contain, and returns its argument.
+func freezeBuiltin(args ...object.Object) object.Object {
+	if err := CheckArity("freeze", args, 1, 1); err != nil {
+		return err
+	}
+
+	freeze(args[0])
+	return args[0]
+}
+
+func frozenBuiltin(args ...object.Object) object.Object {
+	if err := CheckArity("frozen", args, 1, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return boolToBooleanObject(arg.Frozen)
+	case *object.Hash:
+		return boolToBooleanObject(arg.Frozen)
+	case *object.Instance:
+		return boolToBooleanObject(arg.Frozen)
+	default:
+		// Other values cannot be modified anyway.
+		return TRUE
+	}
+}
+
+// freeze marks obj and the values it contains as frozen. Values already
+// frozen are skipped, which also ends the walk on cyclic values.
+func freeze(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, el := range obj.Elements {
+			freeze(el)
+		}
+	case *object.Hash:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Pairs {
+			freeze(pair.Key)
+			freeze(pair.Value)
+		}
+	case *object.Instance:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, value := range obj.Fields {
+			freeze(value)
+		}
+	case *object.Struct:
+		for _, value := range obj.Values {
+			freeze(value)
+		}
+	case *object.Enum:
+		for _, value := range obj.Values {
+			freeze(value)
+		}
+	}
+}
+
+func newFrozenError(obj object.Object) *object.Error {
+	if instance, ok := obj.(*object.Instance); ok {
+		return newError("cannot modify frozen %s instance", instance.Class.Name)
+	}
+	return newError("cannot modify frozen %s", obj.Type())
+}
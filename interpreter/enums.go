@@ -0,0 +1,115 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// evalEnumStatement binds the enum and each of its variants, so that both
+// `Circle(1)` and `Shape.Circle(1)` construct a circle.
+func (in *Interpreter) evalEnumStatement(es *ast.EnumStatement, env *object.Environment) object.Object {
+	names := []string{es.Name.Value}
+	for _, v := range es.Variants {
+		names = append(names, v.Name.Value)
+	}
+	if err := checkRedeclare(env, names...); err != nil {
+		return err
+	}
+
+	et := &object.EnumType{Name: es.Name.Value}
+
+	for _, v := range es.Variants {
+		variant := &object.Variant{EnumType: et, Name: v.Name.Value}
+		for _, field := range v.Fields {
+			variant.Fields = append(variant.Fields, field.Value)
+		}
+		et.Variants = append(et.Variants, variant)
+	}
+
+	if err := in.alloc(len(et.Variants) + 1); err != nil {
+		return err
+	}
+
+	env.Set(et.Name, et)
+	for _, variant := range et.Variants {
+		env.Set(variant.Name, variantObject(variant))
+	}
+
+	return nil
+}
+
+// variantObject returns the constructor of a variant with fields, or the
+// value of a variant without.
+func variantObject(variant *object.Variant) object.Object {
+	if len(variant.Fields) == 0 {
+		return &object.Enum{Variant: variant}
+	}
+	return variant
+}
+
+func (in *Interpreter) evalEnumMember(et *object.EnumType, name string) object.Object {
+	variant, ok := et.Variant(name)
+	if !ok {
+		return newError("enum %s has no variant `%s`", et.Name, name)
+	}
+
+	return variantObject(variant)
+}
+
+// constructVariant creates a value of variant. Every field must be given a
+// value, either by position or by name.
+func (in *Interpreter) constructVariant(variant *object.Variant, args []object.Object, named []namedArg) object.Object {
+	values, err := in.fieldValues("variant", variant.Name, variant.Fields, args, named)
+	if err != nil {
+		return err
+	}
+
+	return &object.Enum{Variant: variant, Values: values}
+}
+
+// bindVariantPattern matches value against a variant and destructures its
+// fields into the argument patterns.
+func (in *Interpreter) bindVariantPattern(pattern *ast.VariantPattern, value object.Object, env *object.Environment) *object.Error {
+	variant, err := in.resolveVariant(pattern, env)
+	if err != nil {
+		return err
+	}
+
+	if pattern.Arguments != nil && len(pattern.Arguments) != len(variant.Fields) {
+		return newError("variant pattern %s expects %s, got %d", pattern, pluralize(len(variant.Fields), "field"), len(pattern.Arguments))
+	}
+
+	enum, ok := value.(*object.Enum)
+	if !ok || enum.Variant != variant {
+		return newMatchError("%s does not match pattern %s", value.Inspect(), pattern)
+	}
+
+	for i, arg := range pattern.Arguments {
+		if err := in.bindPattern(arg, enum.Values[i], env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveVariant looks up the variant named by pattern in env.
+func (in *Interpreter) resolveVariant(pattern *ast.VariantPattern, env *object.Environment) (*object.Variant, *object.Error) {
+	var obj object.Object
+	if pattern.Enum != nil {
+		obj = in.evalMemberExpression(&ast.MemberExpression{Token: pattern.Token, Object: pattern.Enum, Property: pattern.Name}, env)
+	} else {
+		obj = in.evalIdentifier(pattern.Name, env)
+	}
+
+	switch obj := obj.(type) {
+	case *object.Error:
+		return nil, obj
+	case *object.Variant:
+		return obj, nil
+	case *object.Enum:
+		return obj.Variant, nil
+	default:
+		return nil, newError("%s is not an enum variant, got %s", pattern.Name, obj.Type())
+	}
+}
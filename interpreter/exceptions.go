@@ -0,0 +1,155 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// ErrThrown is the Cause of errors raised with `throw`.
+var ErrThrown = errors.New("thrown")
+
+// newThrownError wraps a thrown value. Strings become the message as is,
+// and a thrown hash may provide its own "message" and "kind". Throwing the
+// hash a catch block received raises the caught error again unchanged.
+func newThrownError(val object.Object) *object.Error {
+	message := val.Inspect()
+
+	switch val := val.(type) {
+	case *object.String:
+		message = val.Value
+	case *object.Hash:
+		if val.Error != nil {
+			return val.Error
+		}
+		if m, ok := hashString(val, "message"); ok {
+			message = m
+		}
+	}
+
+	return &object.Error{Message: message, Cause: ErrThrown, Value: val}
+}
+
+// evalTryExpression evaluates the try block and, if it fails with a
+// catchable error, the catch block. The finally block runs afterwards and
+// its result is discarded unless it returns or fails itself. Each block has
+// its own scope.
+func (in *Interpreter) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := in.resolveTailCall(in.eval(te.Block, object.NewScopedEnvironment(env, te.Block.Scope)))
+
+	if errObj, ok := result.(*object.Error); ok && isCatchable(errObj) && te.Catch != nil {
+		catchEnv := object.NewScopedEnvironment(env, te.Catch.Scope)
+
+		value, err := in.errorValue(errObj)
+		if err == nil && te.Param != nil {
+			err = in.bindPattern(te.Param, value, catchEnv)
+		}
+
+		if err != nil {
+			result = err
+		} else {
+			result = in.resolveTailCall(in.eval(te.Catch, catchEnv))
+		}
+	}
+
+	if errObj, ok := result.(*object.Error); ok && !isCatchable(errObj) {
+		return result
+	}
+
+	if te.Finally != nil {
+		final := in.resolveTailCall(in.eval(te.Finally, object.NewScopedEnvironment(env, te.Finally.Scope)))
+		if rt := final.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return final
+		}
+	}
+
+	return result
+}
+
+// resolveTailCall applies a call returned from a try, catch or finally
+// block. Such a call is not in tail position, since its errors must be
+// caught and the finally block must run after it.
+func (in *Interpreter) resolveTailCall(obj object.Object) object.Object {
+	rv, ok := obj.(*object.ReturnValue)
+	if !ok {
+		return obj
+	}
+
+	tc, ok := rv.Value.(*tailCall)
+	if !ok {
+		return obj
+	}
+
+	result := in.applyFunction(tc.fn, tc.args, tc.named, tc.call)
+	if isError(result) {
+		return result
+	}
+	return &object.ReturnValue{Value: result}
+}
+
+// isCatchable reports whether err may be handled by a catch block. Errors
+// from exceeded limits and cancellation always end the evaluation.
+func isCatchable(err *object.Error) bool {
+	return !errors.Is(err.Cause, ErrLimitExceeded) &&
+		!errors.Is(err.Cause, context.Canceled) &&
+		!errors.Is(err.Cause, context.DeadlineExceeded)
+}
+
+// errorValue returns the hash a catch block receives for err, with the
+// fields "message", "kind", "trace" and "value", the thrown value or nil.
+func (in *Interpreter) errorValue(err *object.Error) (object.Object, *object.Error) {
+	trace := err.Trace
+	if trace == nil {
+		trace = in.trace()
+	}
+
+	if allocErr := in.alloc(len(trace) + 5); allocErr != nil {
+		return nil, allocErr
+	}
+
+	return ErrorValue(err, trace), nil
+}
+
+// errorKind classifies err for catch blocks. Thrown values are of kind
+// "Error" unless a thrown hash names its own kind.
+func errorKind(err *object.Error) string {
+	switch {
+	case errors.Is(err.Cause, ErrThrown):
+		if hash, ok := err.Value.(*object.Hash); ok {
+			if kind, ok := hashString(hash, "kind"); ok {
+				return kind
+			}
+		}
+		return "Error"
+	case errors.Is(err.Cause, ErrArity):
+		return "ArityError"
+	case errors.Is(err.Cause, ErrNoMatch):
+		return "MatchError"
+	default:
+		return "RuntimeError"
+	}
+}
+
+func newHash(fields map[string]object.Object) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair, len(fields))
+	for name, value := range fields {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func hashString(hash *object.Hash, name string) (string, bool) {
+	pair, ok := hash.Pairs[(&object.String{Value: name}).HashKey()]
+	if !ok {
+		return "", false
+	}
+
+	str, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
@@ -1,8 +1,12 @@
 package interpreter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"math"
+	"os"
 
 	"github.com/darwin1224/saphire/ast"
 	"github.com/darwin1224/saphire/object"
@@ -14,107 +18,273 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Interpreter evaluates Saphire programs. It owns the builtin functions and
+// the I/O streams they use, so independent interpreters never share state.
+type Interpreter struct {
+	stdout io.Writer
+	stderr io.Writer
+	stdin  *bufio.Reader
+
+	builtins   map[string]*object.Builtin
+	namespaces map[string]*object.Module
+	methods    map[object.ObjectType]map[string]object.Object
+
+	warnShadow bool
+	warned     map[shadowing]bool
+
+	staticChecks bool
+	optimize     bool
+
+	modulePath []string
+	modules    map[string]*module
+	module     *module
+
+	limits Limits
+	active int
+	run    run
+}
+
+// Option configures an Interpreter created with New.
+type Option func(*Interpreter)
+
+// WithStdout sets the writer used by `print`. Defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) { in.stdout = w }
+}
+
+// WithStderr sets the writer used by `eprint`. Defaults to os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) { in.stderr = w }
+}
+
+// WithStdin sets the reader used by `input`. Defaults to os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) { in.stdin = bufio.NewReader(r) }
+}
+
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		stdin:   bufio.NewReader(os.Stdin),
+		modules: make(map[string]*module),
+	}
+
+	for _, opt := range opts {
+		opt(in)
+	}
+
+	in.builtins = in.newBuiltins()
+	in.namespaces = in.newNamespaces()
+	in.methods = in.newMethods()
+
+	return in
+}
+
+// RegisterBuiltin makes fn callable as name from scripts evaluated by this
+// interpreter. Registering an existing name replaces the previous builtin.
+func (in *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	in.builtins[name] = &object.Builtin{Name: name, Fn: fn}
+}
+
+// Builtin returns the builtin registered as name.
+func (in *Interpreter) Builtin(name string) (*object.Builtin, bool) {
+	builtin, ok := in.builtins[name]
+	return builtin, ok
+}
+
+// Eval evaluates node in env. Evaluation stops with an *object.Error when ctx
+// is done or when one of the interpreter's Limits is exceeded.
+func (in *Interpreter) Eval(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	defer in.begin(ctx)()
+	return in.eval(node, env)
+}
+
+// Apply calls fn, a Saphire function or builtin, with args under the same
+// rules as Eval.
+func (in *Interpreter) Apply(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	defer in.begin(ctx)()
+	return in.applyFunction(fn, args, nil, frame{name: "<host>"})
+}
+
+// Eval evaluates node with an interpreter using the default configuration.
+func Eval(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(ctx, node, env)
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
+	return in.evalNode(node, env, false)
+}
+
+// evalNode evaluates node. When tail is set, node is in tail position of a
+// function body and calls are returned as a *tailCall instead of being
+// applied, so that applyFunction can run them without growing the Go stack.
+func (in *Interpreter) evalNode(node ast.Node, env *object.Environment, tail bool) object.Object {
+	if err := in.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return in.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return in.evalNode(node.Expression, env, tail)
 	case *ast.UnaryExpression:
-		right := Eval(node.Right, env)
+		right := in.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
 		return evalUnaryExpression(node.Operator, right)
 	case *ast.BinaryExpression:
-		left := Eval(node.Left, env)
+		left := in.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := in.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalBinaryExpression(node.Operator, left, right)
+		result := evalBinaryExpression(node.Operator, left, right)
+		if err := in.allocResult(result); err != nil {
+			return err
+		}
+
+		return result
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		return in.evalLetStatement(node, env)
+	case *ast.FunctionStatement:
+		if err := checkRedeclare(env, node.Name.Value); err != nil {
+			return err
+		}
+
+		val := in.eval(node.Function, env)
 		if isError(val) {
 			return val
 		}
 
 		env.Set(node.Name.Value, val)
+	case *ast.ImportStatement:
+		return in.evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return in.evalExportStatement(node, env)
+	case *ast.StructStatement:
+		return in.evalStructStatement(node, env)
+	case *ast.EnumStatement:
+		return in.evalEnumStatement(node, env)
+	case *ast.ClassStatement:
+		return in.evalClassStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return in.evalIfExpression(node, env, tail)
+	case *ast.MatchExpression:
+		return in.evalMatchExpression(node, env, tail)
+	case *ast.ThrowExpression:
+		val := in.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		return newThrownError(val)
+	case *ast.TryExpression:
+		return in.evalTryExpression(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return in.evalBlockStatement(node, env, tail)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		// A returned call always ends the enclosing function, so it is a
+		// tail call wherever the return statement appears.
+		val := in.evalNode(node.ReturnValue, env, len(in.run.frames) > 0)
 		if isError(val) {
 			return val
 		}
 
 		return &object.ReturnValue{Value: val}
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return in.evalIdentifier(node, env)
 	case *ast.NumberLiteral:
 		return &object.Number{Value: node.Value}
 	case *ast.Boolean:
 		return boolToBooleanObject(node.Value)
 	case *ast.FunctionLiteral:
+		if err := in.alloc(1); err != nil {
+			return err
+		}
+
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Name: node.Name, Parameters: params, Env: env, Body: body}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := in.eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, named, err := in.evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+
+		if tail {
+			return &tailCall{fn: function, args: args, named: named, call: callFrame(node)}
 		}
 
-		return applyFunction(function, args)
+		return in.applyFunction(function, args, named, callFrame(node))
+	case *ast.SpreadExpression:
+		return newError("spread is only allowed in call arguments and array literals")
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
-		elems := evalExpressions(node.Elements, env)
+		elems := in.evalExpressions(node.Elements, env)
 		if len(elems) == 1 && isError(elems[0]) {
 			return elems[0]
 		}
 
+		if err := in.alloc(len(elems) + 1); err != nil {
+			return err
+		}
+
 		return &object.Array{Elements: elems}
+	case *ast.MemberExpression:
+		return in.evalMemberExpression(node, env)
+	case *ast.WithExpression:
+		return in.evalWithExpression(node, env)
+	case *ast.AssignExpression:
+		return in.evalAssignExpression(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := in.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		index := in.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return in.evalHashLiteral(node, env)
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if err := in.resolve(program, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = in.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
+			if tc, ok := result.Value.(*tailCall); ok {
+				return in.applyFunction(tc.fn, tc.args, tc.named, tc.call)
+			}
 			return result.Value
 		case *object.Error:
 			return result
@@ -124,11 +294,11 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
 	var result object.Object
 
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	for i, statement := range block.Statements {
+		result = in.evalNode(statement, env, tail && i == len(block.Statements)-1)
 
 		if result != nil {
 			rt := result.Type()
@@ -138,6 +308,10 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 		}
 	}
 
+	// A block that is empty or ends in a declaration has no value.
+	if result == nil {
+		return NIL
+	}
 	return result
 }
 
@@ -181,9 +355,9 @@ func evalBinaryExpression(operator string, left, right object.Object) object.Obj
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringBinaryExpression(operator, left, right)
 	case operator == "==":
-		return boolToBooleanObject(left == right)
+		return boolToBooleanObject(isEqual(left, right))
 	case operator == "!=":
-		return boolToBooleanObject(left != right)
+		return boolToBooleanObject(!isEqual(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -232,42 +406,73 @@ func evalStringBinaryExpression(operator string, left, right object.Object) obje
 
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
+	if len(leftVal) > maxStringLength-len(rightVal) {
+		return newError("string concatenation result is longer than %d bytes", maxStringLength)
+	}
 	return &object.String{Value: leftVal + rightVal}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
+	condition := in.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return in.evalNode(ie.Consequence, object.NewScopedEnvironment(env, ie.Consequence.Scope), tail)
 	}
 	if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return in.evalNode(ie.Alternative, object.NewScopedEnvironment(env, ie.Alternative.Scope), tail)
 	}
 
 	return NIL
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (in *Interpreter) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	// Local variables are read from the slot they were resolved to. A slot
+	// that is not bound yet, because the declaration has not run, falls back
+	// to a lookup by name, which finds the binding of an enclosing scope.
+	if node.Local != nil {
+		if val, ok := env.GetAt(*node.Local); ok {
+			return val
+		}
+	}
+
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := in.builtins[node.Value]; ok {
 		return builtin
 	}
 
+	if namespace, ok := in.namespaces[node.Value]; ok {
+		return namespace
+	}
+
 	return newError("identifier not found: %s", node.Value)
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (in *Interpreter) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			evaluated := in.eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return []object.Object{newError("cannot spread %s, expected ARRAY", evaluated.Type())}
+			}
+
+			result = append(result, array.Elements...)
+			continue
+		}
+
+		evaluated := in.eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -283,6 +488,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -299,11 +506,15 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[int64(idx)]
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (in *Interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	if err := in.alloc(len(node.Pairs) + 1); err != nil {
+		return err
+	}
+
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := in.eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
@@ -313,7 +524,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := in.eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -341,6 +552,18 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+func evalModuleIndexExpression(module, index object.Object) object.Object {
+	moduleObject := module.(*object.Module)
+	name := index.(*object.String).Value
+
+	value, ok := moduleObject.Exports[name]
+	if !ok {
+		return newError("module %s does not export `%s`", moduleObject.Name, name)
+	}
+
+	return value
+}
+
 func boolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -372,32 +595,83 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object, named []namedArg, call frame) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if fn.Name != "" {
+			call.name = fn.Name
+		}
+		if max := in.maxDepth(); max > 0 && len(in.run.frames) >= max {
+			return in.recursionError(call, max)
+		}
+		if err := in.alloc(1); err != nil {
+			return err
+		}
+
+		in.run.frames = append(in.run.frames, call)
+		defer func() { in.run.frames = in.run.frames[:len(in.run.frames)-1] }()
+
+		for {
+			extendedEnv, err := in.bindArguments(fn, args, named, in.run.frames[len(in.run.frames)-1].name)
+			if err != nil {
+				err.Trace = in.trace()
+				return err
+			}
+
+			evaluated := unwrapReturnValue(in.evalNode(fn.Body, extendedEnv, true))
+
+			tc, ok := evaluated.(*tailCall)
+			if !ok {
+				if errObj, ok := evaluated.(*object.Error); ok && errObj.Trace == nil {
+					errObj.Trace = in.trace()
+				}
+				return evaluated
+			}
+
+			next, ok := tc.fn.(*object.Function)
+			if !ok {
+				return in.applyFunction(tc.fn, tc.args, tc.named, tc.call)
+			}
+			if err := in.alloc(1); err != nil {
+				return err
+			}
+
+			// The tail call replaces the current frame instead of nesting.
+			fn, args, named = next, tc.args, tc.named
+			if fn.Name != "" {
+				tc.call.name = fn.Name
+			}
+			in.run.frames[len(in.run.frames)-1] = tc.call
+		}
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if len(named) > 0 {
+			return newError("function `%s` does not accept named arguments", fn.Name)
+		}
+
+		result := fn.Fn(args...)
+		if err := in.allocResult(result); err != nil {
+			return err
+		}
+		return result
+	case *object.StructType:
+		return in.constructStruct(fn, args, named)
+	case *object.Variant:
+		return in.constructVariant(fn, args, named)
+	case *object.Class:
+		return in.instantiate(fn, args, named, call)
+	case object.Callable:
+		if len(named) > 0 {
+			return newError("function `%s` does not accept named arguments", call.name)
+		}
+		return fn.Call(args)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
-
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
-	}
-
-	return env
-}
-
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue
+		return returnValue.Value
 	}
 	return obj
 }
@@ -1,275 +1,38 @@
-package interpreter
+package interpreter_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/internal/enginetest"
+	"github.com/darwin1224/saphire/interpreter"
 	"github.com/darwin1224/saphire/lexer"
 	"github.com/darwin1224/saphire/object"
 	"github.com/darwin1224/saphire/parser"
 )
 
-func TestEvalNumberExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"5", 5},
-		{"10", 10},
-		{"-5", -5},
-		{"-10", -10},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-		{"2 ** 2", 4},
-		{"5 ** 2 + 10", 35},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testNumberObject(t, evaluated, float64(float64(tt.expected)))
-	}
-}
-
-func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
-
-	return Eval(program, env)
-}
-
-func testNumberObject(t *testing.T, obj object.Object, expected float64) bool {
-	result, ok := obj.(*object.Number)
-	if !ok {
-		t.Errorf("object is not Number. got=%T (%+v)", obj, obj)
-		return false
-	}
-	if result.Value != expected {
-		t.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
-		return false
-	}
-	return true
-}
-
-func TestEvalBooleanExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected)
-	}
-}
-
-func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
-	result, ok := obj.(*object.Boolean)
-	if !ok {
-		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
-		return false
-	}
-	if result.Value != expected {
-		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
-		return false
-	}
-	return true
-}
-
-func TestBangOperator(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"!true", false},
-		{"!false", true},
-		{"!5", false},
-		{"!!true", true},
-		{"!!false", false},
-		{"!!5", true},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected)
-	}
-}
-
-func TestIfElseExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10 }", nil},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		num, ok := tt.expected.(int)
-		if ok {
-			testNumberObject(t, evaluated, float64(num))
-		} else {
-			testNullObject(t, evaluated)
-		}
-	}
+// engine runs programs on the interpreter for the tests shared with
+// package vm.
+type engine struct {
+	*interpreter.Interpreter
 }
-func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NIL {
-		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
-		return false
-	}
-	return true
-}
-
-func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{`
-			if (10 > 1) {
-			if (10 > 1) {
-			return 10;
-			}
-			return 1;
-			}`,
-			10},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testNumberObject(t, evaluated, float64(tt.expected))
-	}
-}
-
-func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
-	}{
-		{
-			"5 + true;",
-			"type mismatch: NUMBER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: NUMBER + BOOLEAN",
-		},
-		{
-			"-true",
-			"unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`
-	if (10 > 1) {
-		if (10 > 1) {
-			return true + false;
-		}
-
-		return 1;
-	}
-`,
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"foobar",
-			"identifier not found: foobar",
-		},
-		{
-			`"Hello" - "World"`,
-			"unknown operator: STRING - STRING",
-		},
-		{
-			`{"name": "Saphire"}[fn(x) { x }];`,
-			"unusable as hash key: FUNCTION",
-		},
-	}
-
-	for _, tt := range tests {
-		result := testEval(tt.input)
-
-		errObj, ok := result.(*object.Error)
-		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)", result, result)
-			continue
-		}
 
-		if errObj.Message != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
-		}
-	}
+func (e engine) Eval(ctx context.Context, program *ast.Program, env *object.Environment) object.Object {
+	return e.Interpreter.Eval(ctx, program, env)
 }
 
-func TestLetStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
-	}
-
-	for _, tt := range tests {
-		testNumberObject(t, testEval(tt.input), float64(tt.expected))
-	}
+func TestEngine(t *testing.T) {
+	enginetest.Run(t, func(opts ...interpreter.Option) enginetest.Engine {
+		return engine{interpreter.New(opts...)}
+	})
 }
 
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
-	result := testEval(input)
+	program := parser.New(lexer.New(input)).ParseProgram()
+	result := interpreter.New().Eval(context.Background(), program, object.NewEnvironment())
 	fn, ok := result.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not Function. got=%T (%+v)", result, result)
@@ -289,253 +52,3 @@ func TestFunctionObject(t *testing.T) {
 		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
 	}
 }
-
-func TestFunctionApplication(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
-	}
-
-	for _, tt := range tests {
-		testNumberObject(t, testEval(tt.input), float64(tt.expected))
-	}
-}
-
-func TestClosures(t *testing.T) {
-	input := `
-let newAdder = fn(x) {
-fn(y) { x + y };
-};
-let addTwo = newAdder(2);
-addTwo(2);`
-	testNumberObject(t, testEval(input), 4)
-}
-
-func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
-}
-
-func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
-}
-
-func TestBuiltinFunctions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got NUMBER"},
-		{`len("one", "two")`, "wrong number of arguments, got=2, want=1"},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-
-		switch expected := tt.expected.(type) {
-		case int:
-			testNumberObject(t, evaluated, float64(expected))
-		case string:
-			errObj, ok := evaluated.(*object.Error)
-			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)",
-					evaluated, evaluated)
-				continue
-			}
-			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q",
-					expected, errObj.Message)
-			}
-		}
-	}
-}
-
-func TestArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
-
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
-	}
-
-	testNumberObject(t, result.Elements[0], 1)
-	testNumberObject(t, result.Elements[1], 4)
-	testNumberObject(t, result.Elements[2], 6)
-}
-
-func TestArrayIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
-		{
-			"[1, 2, 3][1]",
-			2,
-		},
-		{
-			"[1, 2, 3][2]",
-			3,
-		},
-		{
-			"let i = 0; [1][i];",
-			1,
-		},
-		{
-			"[1, 2, 3][1 + 1];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[2];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
-			6,
-		},
-		{
-			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
-			2,
-		},
-		{
-			"[1, 2, 3][3]",
-			nil,
-		},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		num, ok := tt.expected.(int)
-		if ok {
-			testNumberObject(t, evaluated, float64(num))
-		} else {
-			testNullObject(t, evaluated)
-		}
-	}
-}
-
-func TestHashLiterals(t *testing.T) {
-	input := `let two = "two";
-{
-"one": 10 - 9,
-two: 1 + 1,
-"thr" + "ee": 6 / 2,
-4: 4,
-true: 5,
-false: 6
-}`
-
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Hash)
-	if !ok {
-		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Number{Value: 4}).HashKey():       4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
-	}
-
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
-	}
-
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
-		if !ok {
-			t.Errorf("no pair for given key in Pairs")
-		}
-
-		testNumberObject(t, pair.Value, float64(expectedValue))
-	}
-}
-
-func TestHashIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			`{"foo": 5}["foo"]`,
-			5,
-		},
-		{
-			`{"foo": 5}["bar"]`,
-			nil,
-		},
-		{
-			`let key = "foo"; {"foo": 5}[key]`,
-			5,
-		},
-		{
-			`{}["foo"]`,
-			nil,
-		},
-		{
-			`{5: 5}[5]`,
-			5,
-		},
-		{
-			`{true: 5}[true]`,
-			5,
-		},
-		{
-			`{false: 5}[false]`,
-			5,
-		},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		num, ok := tt.expected.(int)
-		if ok {
-			testNumberObject(t, evaluated, float64(num))
-		} else {
-			testNullObject(t, evaluated)
-		}
-	}
-}
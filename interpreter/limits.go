@@ -0,0 +1,175 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/darwin1224/saphire/object"
+)
+
+// ErrLimitExceeded matches every *LimitError with errors.Is.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bounds the resources a single call to Eval or Apply may use. A zero
+// field means the resource is unlimited.
+type Limits struct {
+	// MaxSteps bounds the number of AST nodes evaluated.
+	MaxSteps int64
+	// Timeout bounds the wall-clock duration of the evaluation.
+	Timeout time.Duration
+	// MaxAllocations bounds the number of values allocated for strings,
+	// array and hash elements, functions and call environments. Strings
+	// returned by builtins count one value per KiB.
+	MaxAllocations int64
+	// MaxDepth bounds the number of nested function calls. Zero uses
+	// DefaultMaxDepth and a negative value disables the limit.
+	MaxDepth int
+}
+
+// WithLimits sets the resource limits applied to each evaluation.
+func WithLimits(limits Limits) Option {
+	return func(in *Interpreter) { in.limits = limits }
+}
+
+// Limits returns the limits set with WithLimits.
+func (in *Interpreter) Limits() Limits {
+	return in.limits
+}
+
+// DefaultMaxDepth is the call depth limit used when Limits.MaxDepth is zero.
+// It keeps runaway recursion from overflowing the Go stack.
+const DefaultMaxDepth = 10000
+
+// LimitError reports which limit an evaluation exceeded. It is carried as
+// the Cause of the *object.Error the evaluation returns.
+type LimitError struct {
+	// Limit is one of "steps", "timeout", "allocations" or "depth".
+	Limit string
+	// Max is the configured value of the exceeded limit.
+	Max any
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (max %v)", e.Limit, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func (e *LimitError) Unwrap() error {
+	if e.Limit == "timeout" {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// run holds the bookkeeping of the evaluation in progress.
+type run struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	parent context.Context
+
+	steps  int64
+	allocs int64
+	frames []frame
+}
+
+// begin starts tracking an evaluation and returns the function ending it.
+// Nested calls, such as a host builtin calling back into Saphire, share the
+// limits of the outermost evaluation.
+func (in *Interpreter) begin(ctx context.Context) func() {
+	in.active++
+	if in.active > 1 {
+		return func() { in.active-- }
+	}
+
+	in.run = run{ctx: ctx, parent: ctx}
+	if in.limits.Timeout > 0 {
+		in.run.ctx, in.run.cancel = context.WithTimeout(ctx, in.limits.Timeout)
+	}
+
+	return func() {
+		in.active--
+		if in.run.cancel != nil {
+			in.run.cancel()
+		}
+		in.run = run{}
+	}
+}
+
+// step accounts for the evaluation of one node and reports whether the
+// evaluation must stop.
+func (in *Interpreter) step() *object.Error {
+	in.run.steps++
+	if max := in.limits.MaxSteps; max > 0 && in.run.steps > max {
+		return newLimitError("steps", max)
+	}
+
+	if in.run.ctx == nil {
+		return nil
+	}
+
+	select {
+	case <-in.run.ctx.Done():
+		if in.run.parent.Err() == nil {
+			return newLimitError("timeout", in.limits.Timeout)
+		}
+		err := in.run.parent.Err()
+		return &object.Error{Message: "evaluation stopped: " + err.Error(), Cause: err}
+	default:
+		return nil
+	}
+}
+
+// alloc accounts for n newly allocated values.
+func (in *Interpreter) alloc(n int) *object.Error {
+	in.run.allocs += int64(n)
+	if max := in.limits.MaxAllocations; max > 0 && in.run.allocs > max {
+		return newLimitError("allocations", max)
+	}
+	return nil
+}
+
+// allocResult accounts for the values allocated by a builtin call.
+func (in *Interpreter) allocResult(obj object.Object) *object.Error {
+	return in.alloc(ResultAllocations(obj))
+}
+
+// stringChunk is the number of bytes of a string returned by a builtin
+// that count as one allocation.
+const stringChunk = 1024
+
+// maxStringLength bounds the length of strings built by concatenation and
+// builtins such as `str.repeat`, which would otherwise allocate before their
+// result can be accounted for.
+const maxStringLength = 1 << 28
+
+// ResultAllocations returns the number of allocations charged for obj when
+// a builtin or an operator returns it. Strings count one more allocation per KiB, so that
+// a long string uses up MaxAllocations like an array of its chunks.
+func ResultAllocations(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.String:
+		return 1 + len(obj.Value)/stringChunk
+	case *object.Array:
+		return len(obj.Elements) + 1
+	case *object.Hash:
+		return len(obj.Pairs) + 1
+	}
+	return 0
+}
+
+func (in *Interpreter) maxDepth() int {
+	if in.limits.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return in.limits.MaxDepth
+}
+
+func newLimitError(limit string, max any) *object.Error {
+	err := &LimitError{Limit: limit, Max: max}
+	return &object.Error{Message: err.Error(), Cause: err}
+}
@@ -0,0 +1,282 @@
+package interpreter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+)
+
+// ModuleExt is the extension added to import paths that have none.
+const ModuleExt = ".sp"
+
+// WithModulePath sets the directories searched, in order, for imports that
+// are not found next to the importing file.
+func WithModulePath(dirs ...string) Option {
+	return func(in *Interpreter) { in.modulePath = dirs }
+}
+
+// ModulePath returns the directories set with WithModulePath.
+func (in *Interpreter) ModulePath() []string {
+	return in.modulePath
+}
+
+// module is a source file loaded by the interpreter. Modules are evaluated
+// once and cached by absolute path.
+type module struct {
+	path     string
+	env      *object.Environment
+	object   *object.Module
+	importer *module
+	loading  bool
+}
+
+// EvalFile evaluates program, read from the file at path, in env. Imports in
+// program resolve relative to the file, and the file can be told apart from
+// the modules it imports, directly or through a cycle.
+func (in *Interpreter) EvalFile(ctx context.Context, path string, program *ast.Program, env *object.Environment) object.Object {
+	defer in.begin(ctx)()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return newError("cannot evaluate %q: %s", path, err)
+	}
+
+	m := in.newModule(abs, env)
+	result := in.evalModule(m, program)
+	if isError(result) {
+		delete(in.modules, abs)
+	}
+
+	return result
+}
+
+func (in *Interpreter) newModule(path string, env *object.Environment) *module {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	m := &module{
+		path:     path,
+		env:      env,
+		object:   &object.Module{Name: name, Path: path, Exports: make(map[string]object.Object)},
+		importer: in.module,
+		loading:  true,
+	}
+	in.modules[path] = m
+
+	return m
+}
+
+func (in *Interpreter) evalModule(m *module, program *ast.Program) object.Object {
+	prev := in.module
+	in.module = m
+	defer func() {
+		in.module = prev
+		m.loading = false
+	}()
+
+	return in.eval(program, m.env)
+}
+
+func (in *Interpreter) evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.Outer() != nil {
+		return newError("import is only allowed at the top level")
+	}
+
+	mod, err := in.importModule(is.Path.Value)
+	if err != nil {
+		return err
+	}
+
+	if is.Alias != nil {
+		env.Set(is.Alias.Value, mod)
+	}
+
+	for _, name := range is.Names {
+		value, ok := mod.Exports[name.Name.Value]
+		if !ok {
+			return newError("module %s does not export `%s`", mod.Name, name.Name.Value)
+		}
+
+		bound := name.Name
+		if name.Alias != nil {
+			bound = name.Alias
+		}
+		env.Set(bound.Value, value)
+	}
+
+	return nil
+}
+
+// evalExportStatement evaluates a declaration and records the names it binds
+// as exports of the module being evaluated. Outside of a module, such as in
+// a program run from source, export has no effect beyond the declaration.
+func (in *Interpreter) evalExportStatement(es *ast.ExportStatement, env *object.Environment) object.Object {
+	if env.Outer() != nil {
+		return newError("export is only allowed at the top level")
+	}
+
+	if result := in.eval(es.Statement, env); isError(result) {
+		return result
+	}
+
+	if in.module == nil || in.module.env != env {
+		return nil
+	}
+
+	var names []string
+	switch stmt := es.Statement.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			names = patternNames(stmt.Pattern, names)
+		} else {
+			names = append(names, stmt.Name.Value)
+		}
+	case *ast.FunctionStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.StructStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.ClassStatement:
+		names = append(names, stmt.Name.Value)
+	case *ast.EnumStatement:
+		names = append(names, stmt.Name.Value)
+		for _, variant := range stmt.Variants {
+			names = append(names, variant.Name.Value)
+		}
+	}
+
+	for _, name := range names {
+		value, _ := env.Get(name)
+		in.module.object.Exports[name] = value
+	}
+
+	return nil
+}
+
+// importModule returns the module for the import path name, loading and
+// evaluating it on first use.
+func (in *Interpreter) importModule(name string) (*object.Module, *object.Error) {
+	path, err := in.resolveModule(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := in.modules[path]; ok {
+		if m.loading {
+			return nil, in.importCycleError(m)
+		}
+		return m.object, nil
+	}
+
+	src, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, newError("cannot import %q: %s", name, readErr)
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, newError("cannot import %q: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	m := in.newModule(path, object.NewEnvironment())
+
+	if result := in.evalModule(m, program); isError(result) {
+		// A module that failed to load is not cached, so that a later
+		// import reports the failure again instead of a partial module.
+		delete(in.modules, path)
+		return nil, result.(*object.Error)
+	}
+
+	return m.object, nil
+}
+
+// resolveModule finds the file for the import path name. Programs that are
+// not run from a file import relative to the working directory.
+func (in *Interpreter) resolveModule(name string) (string, *object.Error) {
+	dir := "."
+	if in.module != nil {
+		dir = filepath.Dir(in.module.path)
+	}
+	return FindModule(name, dir, in.modulePath)
+}
+
+// FindModule finds the file for the import path name in a file of the
+// directory dir. Paths starting with ./ or ../ are relative to dir only;
+// other relative paths are looked up in dir and then in each directory of
+// modulePath.
+func FindModule(name, dir string, modulePath []string) (string, *object.Error) {
+	file := name
+	if filepath.Ext(file) == "" {
+		file += ModuleExt
+	}
+
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file), nil
+	}
+
+	dirs := []string{dir}
+	if !strings.HasPrefix(file, "./") && !strings.HasPrefix(file, "../") {
+		dirs = append(dirs, modulePath...)
+	}
+
+	for _, dir := range dirs {
+		candidate, err := filepath.Abs(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	return "", newError("module %q not found", name)
+}
+
+func (in *Interpreter) importCycleError(target *module) *object.Error {
+	chain := []string{filepath.Base(target.path)}
+	for m := in.module; m != nil; m = m.importer {
+		chain = append(chain, filepath.Base(m.path))
+		if m == target {
+			break
+		}
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return newError("import cycle: %s", strings.Join(chain, " -> "))
+}
+
+// patternNames appends the names bound by pattern to names.
+func patternNames(pattern ast.Pattern, names []string) []string {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		names = append(names, pattern.Value)
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			names = patternNames(el.Pattern, names)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			names = patternNames(pair.Value.Pattern, names)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+	case *ast.VariantPattern:
+		for _, arg := range pattern.Arguments {
+			names = patternNames(arg, names)
+		}
+	}
+	return names
+}
@@ -0,0 +1,487 @@
+package interpreter
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// newNamespaces returns the builtin namespaces, such as `math` and `str`.
+func (in *Interpreter) newNamespaces() map[string]*object.Module {
+	return map[string]*object.Module{
+		"math": newNamespace("math", map[string]object.Object{
+			"pi":    &object.Number{Value: math.Pi},
+			"e":     &object.Number{Value: math.E},
+			"sqrt":  mathFunction("sqrt", math.Sqrt),
+			"abs":   mathFunction("abs", math.Abs),
+			"floor": mathFunction("floor", math.Floor),
+			"ceil":  mathFunction("ceil", math.Ceil),
+			"round": mathFunction("round", math.Round),
+			"log":   mathFunction("log", math.Log),
+			"exp":   mathFunction("exp", math.Exp),
+			"sin":   mathFunction("sin", math.Sin),
+			"cos":   mathFunction("cos", math.Cos),
+			"tan":   mathFunction("tan", math.Tan),
+			"min":   &object.Builtin{Name: "math.min", Fn: mathMin},
+			"max":   &object.Builtin{Name: "math.max", Fn: mathMax},
+		}),
+		"str": newNamespace("str", map[string]object.Object{
+			"len":      lenFunction("str.len"),
+			"upper":    stringFunction("upper", strings.ToUpper),
+			"lower":    stringFunction("lower", strings.ToLower),
+			"trim":     stringFunction("trim", strings.TrimSpace),
+			"split":    &object.Builtin{Name: "str.split", Fn: strSplit},
+			"contains": &object.Builtin{Name: "str.contains", Fn: strContains},
+			"replace":  &object.Builtin{Name: "str.replace", Fn: strReplace},
+			"repeat":   &object.Builtin{Name: "str.repeat", Fn: strRepeat},
+		}),
+		"arr": newNamespace("arr", map[string]object.Object{
+			"len":      lenFunction("arr.len"),
+			"first":    firstFunction("arr.first"),
+			"last":     lastFunction("arr.last"),
+			"rest":     restFunction("arr.rest"),
+			"push":     pushFunction("arr.push"),
+			"reverse":  &object.Builtin{Name: "arr.reverse", Fn: arrReverse},
+			"contains": &object.Builtin{Name: "arr.contains", Fn: arrContains},
+			"join":     &object.Builtin{Name: "arr.join", Fn: arrJoin},
+			"map":      &object.Builtin{Name: "arr.map", Fn: in.arrMap},
+			"filter":   &object.Builtin{Name: "arr.filter", Fn: in.arrFilter},
+			"reduce":   &object.Builtin{Name: "arr.reduce", Fn: in.arrReduce},
+		}),
+		"hash": newNamespace("hash", map[string]object.Object{
+			"len":    lenFunction("hash.len"),
+			"keys":   &object.Builtin{Name: "hash.keys", Fn: hashKeys},
+			"values": &object.Builtin{Name: "hash.values", Fn: hashValues},
+			"has":    &object.Builtin{Name: "hash.has", Fn: hashHas},
+		}),
+	}
+}
+
+// newMethods returns the methods of each type. The functions of the `str`,
+// `arr` and `hash` namespaces are methods of strings, arrays and hashes, so
+// that `xs.map(f)` calls `arr.map(xs, f)`.
+func (in *Interpreter) newMethods() map[object.ObjectType]map[string]object.Object {
+	methods := make(map[object.ObjectType]map[string]object.Object)
+
+	for typ, namespace := range map[object.ObjectType]string{
+		object.STRING_OBJ: "str",
+		object.ARRAY_OBJ:  "arr",
+		object.HASH_OBJ:   "hash",
+	} {
+		methods[typ] = make(map[string]object.Object)
+		for name, fn := range in.namespaces[namespace].Exports {
+			methods[typ][name] = fn
+		}
+	}
+
+	return methods
+}
+
+// RegisterMethod makes fn callable as a method of values of type typ, as in
+// `value.name(args)`. fn receives the value as its first argument.
+func (in *Interpreter) RegisterMethod(typ object.ObjectType, name string, fn object.BuiltinFunction) {
+	if in.methods[typ] == nil {
+		in.methods[typ] = make(map[string]object.Object)
+	}
+	in.methods[typ][name] = &object.Builtin{Name: name, Fn: fn}
+}
+
+// RegisterNamespace makes members accessible as `name.member` from scripts
+// evaluated by this interpreter.
+func (in *Interpreter) RegisterNamespace(name string, members map[string]object.Object) {
+	in.namespaces[name] = newNamespace(name, members)
+}
+
+// Namespace returns the builtin namespace registered as name.
+func (in *Interpreter) Namespace(name string) (*object.Module, bool) {
+	namespace, ok := in.namespaces[name]
+	return namespace, ok
+}
+
+func newNamespace(name string, members map[string]object.Object) *object.Module {
+	return &object.Module{Name: name, Exports: members}
+}
+
+// evalMemberExpression looks up a hash key, a struct, enum or instance
+// field, an enum variant, a class method, a module export or a method of
+// the object's type. Keys and fields take precedence over methods.
+func (in *Interpreter) evalMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := in.eval(node.Object, env)
+	if isError(obj) {
+		return obj
+	}
+
+	name := node.Property.Value
+
+	switch obj := obj.(type) {
+	case *object.Module:
+		return evalModuleIndexExpression(obj, &object.String{Value: name})
+	case *object.Hash:
+		if pair, ok := obj.Pairs[(&object.String{Value: name}).HashKey()]; ok {
+			return pair.Value
+		}
+	case *object.Struct:
+		if value, ok := obj.Get(name); ok {
+			return value
+		}
+	case *object.Enum:
+		if value, ok := obj.Get(name); ok {
+			return value
+		}
+	case *object.EnumType:
+		return in.evalEnumMember(obj, name)
+	case *object.Instance:
+		if value, ok := in.evalInstanceMember(obj, name); ok {
+			return value
+		}
+	case *object.Super:
+		return in.evalSuperMember(obj, name)
+	}
+
+	method, ok := in.methods[obj.Type()][name]
+	if !ok {
+		switch obj := obj.(type) {
+		case *object.Struct:
+			return newFieldError("struct", obj.StructType.Name, name)
+		case *object.Enum:
+			return newFieldError("variant", obj.Variant.Name, name)
+		case *object.Instance:
+			return newError("%s has no member `%s`", obj.Class.Name, name)
+		}
+		return newError("%s has no member `%s`", obj.Type(), name)
+	}
+
+	if err := in.alloc(1); err != nil {
+		return err
+	}
+
+	return in.bindMethod(obj, name, method)
+}
+
+// bindMethod returns method with its receiver bound as the first argument.
+func (in *Interpreter) bindMethod(receiver object.Object, name string, method object.Object) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		result := in.applyFunction(method, append([]object.Object{receiver}, args...), nil, frame{name: name})
+		return uncountReceiver(result, method, len(args))
+	}}
+}
+
+func mathFunction(name string, fn func(float64) float64) *object.Builtin {
+	name = "math." + name
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+		if args[0].Type() != object.NUMBER_OBJ {
+			return newError("argument to `%s` must be NUMBER, got %s", name, args[0].Type())
+		}
+
+		return &object.Number{Value: fn(args[0].(*object.Number).Value)}
+	}}
+}
+
+func mathMin(args ...object.Object) object.Object {
+	return mathFold("math.min", args, math.Min)
+}
+
+func mathMax(args ...object.Object) object.Object {
+	return mathFold("math.max", args, math.Max)
+}
+
+func mathFold(name string, args []object.Object, fn func(a, b float64) float64) object.Object {
+	if err := CheckArity(name, args, 1, -1); err != nil {
+		return err
+	}
+
+	var result float64
+	for i, arg := range args {
+		number, ok := arg.(*object.Number)
+		if !ok {
+			return newError("argument to `%s` must be NUMBER, got %s", name, arg.Type())
+		}
+
+		if i == 0 {
+			result = number.Value
+		} else {
+			result = fn(result, number.Value)
+		}
+	}
+
+	return &object.Number{Value: result}
+}
+
+func stringFunction(name string, fn func(string) string) *object.Builtin {
+	name = "str." + name
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if err := CheckArity(name, args, 1, 1); err != nil {
+			return err
+		}
+		if args[0].Type() != object.STRING_OBJ {
+			return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+
+		return &object.String{Value: fn(args[0].(*object.String).Value)}
+	}}
+}
+
+// stringArgs checks that args are n strings and returns their values.
+func stringArgs(name string, args []object.Object, n int) ([]string, *object.Error) {
+	if err := CheckArity(name, args, n, n); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, n)
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		values[i] = str.Value
+	}
+
+	return values, nil
+}
+
+func strSplit(args ...object.Object) object.Object {
+	values, err := stringArgs("str.split", args, 2)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(values[0], values[1])
+	elements := make([]object.Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &object.String{Value: part}
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func strContains(args ...object.Object) object.Object {
+	values, err := stringArgs("str.contains", args, 2)
+	if err != nil {
+		return err
+	}
+
+	return boolToBooleanObject(strings.Contains(values[0], values[1]))
+}
+
+func strReplace(args ...object.Object) object.Object {
+	values, err := stringArgs("str.replace", args, 3)
+	if err != nil {
+		return err
+	}
+
+	return &object.String{Value: strings.ReplaceAll(values[0], values[1], values[2])}
+}
+
+func strRepeat(args ...object.Object) object.Object {
+	if err := CheckArity("str.repeat", args, 2, 2); err != nil {
+		return err
+	}
+
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `str.repeat` must be STRING, got %s", args[0].Type())
+	}
+	count, ok := args[1].(*object.Number)
+	if !ok || count.Value < 0 || count.Value != math.Trunc(count.Value) {
+		return newError("argument to `str.repeat` must be a non-negative integer, got %s", args[1].Inspect())
+	}
+	if str.Value == "" {
+		return &object.String{Value: ""}
+	}
+	if count.Value > float64(maxStringLength/len(str.Value)) {
+		return newError("`str.repeat` result is longer than %d bytes", maxStringLength)
+	}
+
+	return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+// arrayArg checks that the first of args is an array and returns it.
+func arrayArg(name string, args []object.Object, min, max int) (*object.Array, *object.Error) {
+	if err := CheckArity(name, args, min, max); err != nil {
+		return nil, err
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	return arr, nil
+}
+
+func arrReverse(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.reverse", args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	length := len(arr.Elements)
+	elements := make([]object.Object, length)
+	for i, el := range arr.Elements {
+		elements[length-1-i] = el
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func arrContains(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.contains", args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range arr.Elements {
+		if isEqual(el, args[1]) {
+			return TRUE
+		}
+	}
+
+	return FALSE
+}
+
+func arrJoin(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.join", args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	sep, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `arr.join` must be STRING, got %s", args[1].Type())
+	}
+
+	parts := make([]string, len(arr.Elements))
+	for i, el := range arr.Elements {
+		parts[i] = el.Inspect()
+	}
+
+	return &object.String{Value: strings.Join(parts, sep.Value)}
+}
+
+func (in *Interpreter) arrMap(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.map", args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		result := in.applyFunction(args[1], []object.Object{el}, nil, frame{name: "<anonymous>"})
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (in *Interpreter) arrFilter(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.filter", args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, 0)
+	for _, el := range arr.Elements {
+		keep := in.applyFunction(args[1], []object.Object{el}, nil, frame{name: "<anonymous>"})
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			elements = append(elements, el)
+		}
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (in *Interpreter) arrReduce(args ...object.Object) object.Object {
+	arr, err := arrayArg("arr.reduce", args, 3, 3)
+	if err != nil {
+		return err
+	}
+
+	acc := args[2]
+	for _, el := range arr.Elements {
+		acc = in.applyFunction(args[1], []object.Object{acc, el}, nil, frame{name: "<anonymous>"})
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+// hashArg checks that the first of args is a hash and returns it.
+func hashArg(name string, args []object.Object, n int) (*object.Hash, *object.Error) {
+	if err := CheckArity(name, args, n, n); err != nil {
+		return nil, err
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	return hash, nil
+}
+
+func hashKeys(args ...object.Object) object.Object {
+	hash, err := hashArg("hash.keys", args, 1)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]object.Object, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		keys = append(keys, pair.Key)
+	}
+	sortByInspect(keys)
+
+	return &object.Array{Elements: keys}
+}
+
+func hashValues(args ...object.Object) object.Object {
+	hash, err := hashArg("hash.values", args, 1)
+	if err != nil {
+		return err
+	}
+
+	keys := hashKeys(hash).(*object.Array).Elements
+	values := make([]object.Object, len(keys))
+	for i, key := range keys {
+		values[i] = hash.Pairs[key.(object.Hashable).HashKey()].Value
+	}
+
+	return &object.Array{Elements: values}
+}
+
+func hashHas(args ...object.Object) object.Object {
+	hash, err := hashArg("hash.has", args, 2)
+	if err != nil {
+		return err
+	}
+
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, found := hash.Pairs[key.HashKey()]
+	return boolToBooleanObject(found)
+}
+
+// sortByInspect sorts objects by their printed form, giving hash keys a
+// stable order.
+func sortByInspect(objects []object.Object) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Inspect() < objects[j].Inspect()
+	})
+}
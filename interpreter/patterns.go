@@ -0,0 +1,283 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// ErrNoMatch is the Cause of errors reporting a value that does not have
+// the shape of the pattern it is bound to.
+var ErrNoMatch = errors.New("value does not match pattern")
+
+// bindPattern destructures value into pattern, binding the names it
+// contains in env. Defaults are evaluated in env, so they can refer to
+// names bound earlier in the same pattern.
+func (in *Interpreter) bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+		return nil
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.LiteralPattern:
+		return in.matchLiteralPattern(pattern, value, env)
+	case *ast.RangePattern:
+		return in.matchRangePattern(pattern, value, env)
+	case *ast.ArrayPattern:
+		return in.bindArrayPattern(pattern, value, env)
+	case *ast.HashPattern:
+		return in.bindHashPattern(pattern, value, env)
+	case *ast.VariantPattern:
+		return in.bindVariantPattern(pattern, value, env)
+	default:
+		return newError("unknown pattern: %s", pattern)
+	}
+}
+
+func (in *Interpreter) bindArrayPattern(pattern *ast.ArrayPattern, value object.Object, env *object.Environment) *object.Error {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return newMatchError("cannot destructure %s with array pattern %s", value.Type(), pattern)
+	}
+
+	required := 0
+	for i, el := range pattern.Elements {
+		if el.Default == nil {
+			required = i + 1
+		}
+	}
+
+	got := len(array.Elements)
+	if got < required || (pattern.Rest == nil && got > len(pattern.Elements)) {
+		var want string
+		switch {
+		case pattern.Rest != nil:
+			want = "at least " + pluralize(required, "element")
+		case required == len(pattern.Elements):
+			want = pluralize(required, "element")
+		default:
+			want = fmt.Sprintf("%d to %d elements", required, len(pattern.Elements))
+		}
+
+		return newMatchError("array pattern %s expects %s, got %d", pattern, want, got)
+	}
+
+	for i, el := range pattern.Elements {
+		var elem object.Object
+		if i < got {
+			elem = array.Elements[i]
+		}
+
+		if err := in.bindElement(el, elem, env); err != nil {
+			return err
+		}
+	}
+
+	if pattern.Rest != nil {
+		rest := make([]object.Object, 0)
+		if got > len(pattern.Elements) {
+			rest = append(rest, array.Elements[len(pattern.Elements):]...)
+		}
+
+		if err := in.alloc(len(rest) + 1); err != nil {
+			return err
+		}
+		env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	return nil
+}
+
+func (in *Interpreter) bindHashPattern(pattern *ast.HashPattern, value object.Object, env *object.Environment) *object.Error {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return newMatchError("cannot destructure %s with hash pattern %s", value.Type(), pattern)
+	}
+
+	used := make(map[object.HashKey]bool, len(pattern.Pairs))
+
+	for _, pair := range pattern.Pairs {
+		key := (&object.String{Value: pair.Key}).HashKey()
+		used[key] = true
+
+		var elem object.Object
+		if found, ok := hash.Pairs[key]; ok {
+			elem = found.Value
+		} else if pair.Value.Default == nil {
+			return newMatchError("hash pattern %s missing key %q", pattern, pair.Key)
+		}
+
+		if err := in.bindElement(pair.Value, elem, env); err != nil {
+			return err
+		}
+	}
+
+	if pattern.Rest != nil {
+		rest := make(map[object.HashKey]object.HashPair)
+		for key, pair := range hash.Pairs {
+			if !used[key] {
+				rest[key] = pair
+			}
+		}
+
+		if err := in.alloc(len(rest) + 1); err != nil {
+			return err
+		}
+		env.Set(pattern.Rest.Value, &object.Hash{Pairs: rest})
+	}
+
+	return nil
+}
+
+// bindElement binds value, or the element's default when value is nil, to
+// the element's pattern.
+func (in *Interpreter) bindElement(el *ast.PatternElement, value object.Object, env *object.Environment) *object.Error {
+	if value == nil {
+		value = in.eval(el.Default, env)
+		if errObj, ok := value.(*object.Error); ok {
+			return errObj
+		}
+	}
+
+	return in.bindPattern(el.Pattern, value, env)
+}
+
+func (in *Interpreter) matchLiteralPattern(pattern *ast.LiteralPattern, value object.Object, env *object.Environment) *object.Error {
+	literal := in.eval(pattern.Value, env)
+	if errObj, ok := literal.(*object.Error); ok {
+		return errObj
+	}
+
+	if !isEqual(value, literal) {
+		return newMatchError("%s does not match pattern %s", value.Inspect(), pattern)
+	}
+	return nil
+}
+
+func (in *Interpreter) matchRangePattern(pattern *ast.RangePattern, value object.Object, env *object.Environment) *object.Error {
+	number, ok := value.(*object.Number)
+	if !ok {
+		return newMatchError("%s does not match range pattern %s", value.Type(), pattern)
+	}
+
+	low := in.eval(pattern.Low, env)
+	if errObj, ok := low.(*object.Error); ok {
+		return errObj
+	}
+	high := in.eval(pattern.High, env)
+	if errObj, ok := high.(*object.Error); ok {
+		return errObj
+	}
+
+	v := number.Value
+	lowVal, highVal := low.(*object.Number).Value, high.(*object.Number).Value
+	if v < lowVal || v > highVal || (v == highVal && !pattern.Inclusive) {
+		return newMatchError("%s does not match range pattern %s", value.Inspect(), pattern)
+	}
+	return nil
+}
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches the subject and whose guard, if any, is truthy. Each arm binds its
+// names in its own environment.
+func (in *Interpreter) evalMatchExpression(me *ast.MatchExpression, env *object.Environment, tail bool) object.Object {
+	subject := in.eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewScopedEnvironment(env, arm.Body.Scope)
+
+		if err := in.bindPattern(arm.Pattern, subject, armEnv); err != nil {
+			if errors.Is(err.Cause, ErrNoMatch) {
+				continue
+			}
+			return err
+		}
+
+		if arm.Guard != nil {
+			guard := in.eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return in.evalNode(arm.Body, armEnv, tail)
+	}
+
+	return newMatchError("no match arm matches %s", subject.Inspect())
+}
+
+func newMatchError(format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Cause = ErrNoMatch
+	return err
+}
+
+// isEqual reports whether a and b are equal numbers, strings or booleans,
+// structs or enum values of the same type with equal fields, or the same
+// object.
+func isEqual(a, b object.Object) bool {
+	return isEqualWithin(a, b, nil)
+}
+
+// comparison is a pair of structs or enum values being compared.
+type comparison struct{ a, b object.Object }
+
+// isEqualWithin is isEqual for fields of the comparisons in seen. Only
+// structs and enum values are compared field by field, and a pair met again
+// within itself is taken to be equal, so comparing values that contain
+// themselves ends.
+func isEqualWithin(a, b object.Object, seen map[comparison]bool) bool {
+	switch a.(type) {
+	case *object.Struct, *object.Enum:
+		pair := comparison{a, b}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = make(map[comparison]bool)
+		}
+		seen[pair] = true
+	}
+
+	switch a := a.(type) {
+	case *object.Number:
+		b, ok := b.(*object.Number)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Struct:
+		b, ok := b.(*object.Struct)
+		if !ok || a.StructType != b.StructType {
+			return false
+		}
+		for i := range a.Values {
+			if !isEqualWithin(a.Values[i], b.Values[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *object.Enum:
+		b, ok := b.(*object.Enum)
+		if !ok || a.Variant != b.Variant {
+			return false
+		}
+		for i := range a.Values {
+			if !isEqualWithin(a.Values[i], b.Values[i], seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,98 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/optimizer"
+	"github.com/darwin1224/saphire/resolver"
+)
+
+// WithStaticChecks makes the interpreter check each program before running
+// it. Undefined variables are reported as an error and the program does not
+// run; unused local variables are reported as warnings on its stderr
+// writer.
+func WithStaticChecks() Option {
+	return func(in *Interpreter) { in.staticChecks = true }
+}
+
+// WithOptimizations makes the interpreter optimize each program before
+// running it. See the optimizer package for what changes.
+func WithOptimizations() Option {
+	return func(in *Interpreter) { in.optimize = true }
+}
+
+// Check resolves program as if it were run in env and returns the problems
+// found, without running it.
+func (in *Interpreter) Check(program *ast.Program, env *object.Environment) []resolver.Diagnostic {
+	return resolver.Resolve(program, in.definer(env)).Diagnostics
+}
+
+// resolve binds the identifiers of program to slots before it runs, so
+// that evalIdentifier can find local variables without looking them up by
+// name.
+func (in *Interpreter) resolve(program *ast.Program, env *object.Environment) *object.Error {
+	in.Optimize(program)
+	return in.report(resolver.Resolve(program, in.definer(env)))
+}
+
+// Verify runs the checks enabled with WithStaticChecks on program, for
+// engines that run programs without the interpreter.
+func (in *Interpreter) Verify(program *ast.Program, env *object.Environment) *object.Error {
+	if !in.staticChecks {
+		return nil
+	}
+	return in.report(resolver.Resolve(program, in.definer(env)))
+}
+
+// Optimize optimizes program in place when WithOptimizations is set, for
+// engines that run programs without the interpreter.
+func (in *Interpreter) Optimize(program *ast.Program) {
+	if in.optimize {
+		optimizer.Optimize(program)
+	}
+}
+
+// StaticChecks reports whether the checks of WithStaticChecks are enabled.
+// Engines running cached programs still parse and verify their source then.
+func (in *Interpreter) StaticChecks() bool {
+	return in.staticChecks
+}
+
+// Optimizes reports whether programs are optimized with WithOptimizations.
+// Engines caching compiled programs keep the two kinds apart.
+func (in *Interpreter) Optimizes() bool {
+	return in.optimize
+}
+
+// report turns the diagnostics of result into an error, or warnings on
+// stderr, when static checks are enabled.
+func (in *Interpreter) report(result *resolver.Result) *object.Error {
+	if !in.staticChecks {
+		return nil
+	}
+	if errs := result.Errors(); len(errs) > 0 {
+		return newError("%s", strings.Join(errs, "; "))
+	}
+	for _, d := range result.Diagnostics {
+		fmt.Fprintln(in.stderr, d)
+	}
+	return nil
+}
+
+// definer reports whether a name is defined in env or as a builtin or
+// namespace of the interpreter.
+func (in *Interpreter) definer(env *object.Environment) func(string) bool {
+	return func(name string) bool {
+		if _, ok := env.Get(name); ok {
+			return true
+		}
+		if _, ok := in.builtins[name]; ok {
+			return true
+		}
+		_, ok := in.namespaces[name]
+		return ok
+	}
+}
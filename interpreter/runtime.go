@@ -0,0 +1,111 @@
+package interpreter
+
+import "github.com/darwin1224/saphire/object"
+
+// The functions in this file expose the semantics of the language's
+// operations on values, so that other execution engines, such as the
+// bytecode VM, behave exactly like the interpreter.
+
+// BinaryOp applies the binary operator to left and right.
+func BinaryOp(operator string, left, right object.Object) object.Object {
+	return evalBinaryExpression(operator, left, right)
+}
+
+// UnaryOp applies the prefix operator, `!` or `-`, to right.
+func UnaryOp(operator string, right object.Object) object.Object {
+	return evalUnaryExpression(operator, right)
+}
+
+// Index returns left[index].
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// IsEqual reports whether a == b.
+func IsEqual(a, b object.Object) bool {
+	return isEqual(a, b)
+}
+
+// Bool returns the boolean object for b.
+func Bool(b bool) *object.Boolean {
+	return boolToBooleanObject(b)
+}
+
+// CheckArgCount is like CheckArity for a call with got arguments.
+func CheckArgCount(name string, got, min, max int) *object.Error {
+	return checkArgCount(name, got, min, max)
+}
+
+// UncountReceiver returns result, the result of calling the method with its
+// receiver followed by args arguments, with the arity errors of the method
+// counting only the arguments.
+func UncountReceiver(result, method object.Object, args int) object.Object {
+	return uncountReceiver(result, method, args)
+}
+
+// ThrownError returns the error raised by `throw val`.
+func ThrownError(val object.Object) *object.Error {
+	return newThrownError(val)
+}
+
+// IsCatchable reports whether err may be handled by a catch block.
+func IsCatchable(err *object.Error) bool {
+	return isCatchable(err)
+}
+
+// ErrorValue returns the hash a catch block receives for err, using trace
+// if err has none.
+func ErrorValue(err *object.Error, trace []string) *object.Hash {
+	if err.Trace != nil {
+		trace = err.Trace
+	}
+
+	frames := make([]object.Object, len(trace))
+	for i, line := range trace {
+		frames[i] = &object.String{Value: line}
+	}
+
+	var value object.Object = NIL
+	if err.Value != nil {
+		value = err.Value
+	}
+
+	hash := newHash(map[string]object.Object{
+		"message": &object.String{Value: err.Message},
+		"kind":    &object.String{Value: errorKind(err)},
+		"trace":   &object.Array{Elements: frames},
+		"value":   value,
+	})
+	caught := *err
+	caught.Trace = trace
+	hash.Error = &caught
+	return hash
+}
+
+// VariantObject returns the constructor of a variant with fields, or the
+// value of a variant without.
+func VariantObject(variant *object.Variant) object.Object {
+	return variantObject(variant)
+}
+
+// FieldError reports a missing field of the struct or variant name.
+func FieldError(kind, name, field string) *object.Error {
+	return newFieldError(kind, name, field)
+}
+
+// FrozenError reports an attempt to modify the frozen obj.
+func FrozenError(obj object.Object) *object.Error {
+	return newFrozenError(obj)
+}
+
+// Method returns the method name of values of type typ, either one of the
+// builtin methods or one registered with RegisterMethod.
+func (in *Interpreter) Method(typ object.ObjectType, name string) (object.Object, bool) {
+	method, ok := in.methods[typ][name]
+	return method, ok
+}
@@ -0,0 +1,76 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// Scoping rules
+//
+// Every block introduces a scope: function bodies, the branches of `if`,
+// match arms and the blocks of `try`, `catch` and `finally`. A `let` or
+// `const` declaration binds its names in the innermost scope, shadowing
+// bindings of the same name in enclosing scopes until the end of the block.
+// Declaring a name again in the same scope replaces it, unless it is a
+// constant. Assignment, `x = value`, changes the innermost existing binding
+// of the name, so a block can update variables of enclosing scopes.
+
+// WithShadowWarnings makes the interpreter report, on its stderr writer,
+// declarations that shadow a binding of an enclosing scope. Each
+// declaration is reported once.
+func WithShadowWarnings() Option {
+	return func(in *Interpreter) { in.warnShadow = true }
+}
+
+// shadowing identifies a declaration reported by warnShadowing.
+type shadowing struct {
+	module string
+	line   int
+	column int
+	name   string
+}
+
+// warnShadowing reports the names declared by ls in env that shadow
+// bindings of enclosing scopes.
+func (in *Interpreter) warnShadowing(ls *ast.LetStatement, env *object.Environment, names []string) {
+	if !in.warnShadow || env.Outer() == nil {
+		return
+	}
+
+	for _, name := range names {
+		if env.Has(name) {
+			continue
+		}
+		if _, ok := env.Outer().Get(name); !ok {
+			continue
+		}
+
+		module := ""
+		if in.module != nil {
+			module = in.module.path
+		}
+		in.ShadowWarning(module, ls.Token.Line, ls.Token.Column, name)
+	}
+}
+
+// ShadowWarning reports, if shadow warnings are enabled, that the
+// declaration of name at line and column of the module at path shadows a
+// variable of an enclosing scope. Each declaration is reported once.
+func (in *Interpreter) ShadowWarning(path string, line, column int, name string) {
+	if !in.warnShadow {
+		return
+	}
+
+	key := shadowing{module: path, line: line, column: column, name: name}
+	if in.warned[key] {
+		return
+	}
+	if in.warned == nil {
+		in.warned = make(map[shadowing]bool)
+	}
+	in.warned[key] = true
+
+	fmt.Fprintf(in.stderr, "warning: line %d: `%s` shadows a variable of an enclosing scope\n", line, name)
+}
@@ -0,0 +1,112 @@
+package interpreter
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+func (in *Interpreter) evalStructStatement(ss *ast.StructStatement, env *object.Environment) object.Object {
+	if err := checkRedeclare(env, ss.Name.Value); err != nil {
+		return err
+	}
+
+	fields := make([]string, len(ss.Fields))
+	for i, field := range ss.Fields {
+		fields[i] = field.Value
+	}
+
+	if err := in.alloc(1); err != nil {
+		return err
+	}
+
+	env.Set(ss.Name.Value, &object.StructType{Name: ss.Name.Value, Fields: fields})
+	return nil
+}
+
+// constructStruct creates a value of st. Every field must be given a value,
+// either by position or by name.
+func (in *Interpreter) constructStruct(st *object.StructType, args []object.Object, named []namedArg) object.Object {
+	values, err := in.fieldValues("struct", st.Name, st.Fields, args, named)
+	if err != nil {
+		return err
+	}
+
+	return &object.Struct{StructType: st, Values: values}
+}
+
+// fieldValues orders the arguments of a call to the constructor of a struct
+// or variant, called name, by fields.
+func (in *Interpreter) fieldValues(kind, name string, fields []string, args []object.Object, named []namedArg) ([]object.Object, *object.Error) {
+	if err := checkArgCount(name, len(args)+len(named), len(fields), len(fields)); err != nil {
+		return nil, err
+	}
+
+	values := make([]object.Object, len(fields))
+	copy(values, args)
+
+	for _, arg := range named {
+		i := fieldIndex(fields, arg.name)
+		if i < 0 {
+			return nil, newFieldError(kind, name, arg.name)
+		}
+		if values[i] != nil {
+			return nil, newError("%s %s got multiple values for field `%s`", kind, name, arg.name)
+		}
+		values[i] = arg.value
+	}
+
+	if err := in.alloc(len(values) + 1); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// evalWithExpression returns a copy of a struct with the given fields
+// replaced. The original struct is left unchanged.
+func (in *Interpreter) evalWithExpression(we *ast.WithExpression, env *object.Environment) object.Object {
+	left := in.eval(we.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	s, ok := left.(*object.Struct)
+	if !ok {
+		return newError("with expects STRUCT, got %s", left.Type())
+	}
+
+	values := make([]object.Object, len(s.Values))
+	copy(values, s.Values)
+
+	for _, field := range we.Fields {
+		i := s.StructType.FieldIndex(field.Name.Value)
+		if i < 0 {
+			return newFieldError("struct", s.StructType.Name, field.Name.Value)
+		}
+
+		value := in.eval(field.Value, env)
+		if isError(value) {
+			return value
+		}
+		values[i] = value
+	}
+
+	if err := in.alloc(len(values) + 1); err != nil {
+		return err
+	}
+
+	return &object.Struct{StructType: s.StructType, Values: values}
+}
+
+func newFieldError(kind, name, field string) *object.Error {
+	return newError("%s %s has no field `%s`", kind, name, field)
+}
+
+func fieldIndex(fields []string, name string) int {
+	for i, field := range fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
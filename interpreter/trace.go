@@ -0,0 +1,71 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/object"
+)
+
+// maxTraceFrames is the number of innermost frames kept in error traces.
+const maxTraceFrames = 10
+
+// frame is an entry of the Saphire call stack.
+type frame struct {
+	name string
+	line int
+}
+
+func (f frame) String() string {
+	if f.line == 0 {
+		return "at " + f.name
+	}
+	return fmt.Sprintf("at %s (line %d)", f.name, f.line)
+}
+
+func callFrame(call *ast.CallExpression) frame {
+	name := "<anonymous>"
+	switch fn := call.Function.(type) {
+	case *ast.Identifier:
+		name = fn.Value
+	case *ast.MemberExpression:
+		name = fn.Property.Value
+	}
+	return frame{name: name, line: call.Token.Line}
+}
+
+// trace renders the innermost frames of the call stack, most recent first.
+func (in *Interpreter) trace() []string {
+	frames := in.run.frames
+	trace := make([]string, 0, maxTraceFrames+1)
+
+	for i := len(frames) - 1; i >= 0 && len(trace) < maxTraceFrames; i-- {
+		trace = append(trace, frames[i].String())
+	}
+
+	if hidden := len(frames) - maxTraceFrames; hidden > 0 {
+		trace = append(trace, fmt.Sprintf("... %d more frames", hidden))
+	}
+
+	return trace
+}
+
+func (in *Interpreter) recursionError(call frame, max int) *object.Error {
+	err := newLimitError("depth", max)
+	err.Message = fmt.Sprintf("maximum recursion depth exceeded (%d) calling `%s`", max, call.name)
+	err.Trace = in.trace()
+	return err
+}
+
+// tailCall is a call evaluated in tail position. It is returned in place of
+// the call's result and executed by the applyFunction loop of the function
+// it returns from.
+type tailCall struct {
+	fn    object.Object
+	args  []object.Object
+	named []namedArg
+	call  frame
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call to " + tc.call.name }
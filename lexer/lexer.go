@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/darwin1224/saphire/token"
 )
 
@@ -9,15 +11,33 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	column       int
+
+	comments []Comment
+}
+
+// Comment is a `//` comment, which the lexer skips between tokens. Text
+// includes the slashes.
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -33,12 +53,18 @@ func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 	l.skipComments()
 
+	line, column := l.line, l.column
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -103,6 +129,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '|':
+		tok = newToken(token.PIPE, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' && l.peekCharAt(2) == '=' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.RANGE_EQ, Literal: "..="}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.RANGE, Literal: ".."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -110,10 +153,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.NUM
 			tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -121,6 +166,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
@@ -150,19 +196,23 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) skipComments() {
-	if l.ch == '/' && l.peekChar() == '/' {
-		for l.ch != '\n' {
+	for l.ch == '/' && l.peekChar() == '/' {
+		position, line, column := l.position, l.line, l.column
+		for l.ch != '\n' && l.ch != 0 {
 			l.readChar()
 		}
-		l.readChar()
-		l.skipWhitespace()
+		text := strings.TrimRight(l.input[position:l.position], " \t\r")
+		l.comments = append(l.comments, Comment{Text: text, Line: line, Column: column})
 
-		if l.ch == '/' {
-			l.skipComments()
-		}
+		l.skipWhitespace()
 	}
 }
 
+// Comments returns the comments skipped so far, in source order.
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
 func (l *Lexer) readNumber() string {
 	position := l.position
 
@@ -177,14 +227,33 @@ func (l *Lexer) readNumber() string {
 		}
 	}
 
+	if l.ch == 'e' || l.ch == 'E' {
+		sign := l.peekChar() == '+' || l.peekChar() == '-'
+		if isDigit(l.peekChar()) || sign && isDigit(l.peekCharAt(2)) {
+			l.readChar()
+			if sign {
+				l.readChar()
+			}
+			for isDigit(l.ch) {
+				l.readChar()
+			}
+		}
+	}
+
 	return l.input[position:l.position]
 }
 
 func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+	return l.peekCharAt(1)
+}
+
+// peekCharAt returns the character offset positions after the current one.
+func (l *Lexer) peekCharAt(offset int) byte {
+	position := l.position + offset
+	if position >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	return l.input[position]
 }
 
 func newToken(tokenType token.TokenType, ch byte) token.Token {
@@ -291,3 +291,211 @@ func TestNextToken6(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+// comment
+  add(x, "a b")`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"add", 3, 3},
+		{"(", 3, 6},
+		{"x", 3, 7},
+		{",", 3, 8},
+		{"a b", 3, 10},
+		{")", 3, 15},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNextToken7(t *testing.T) {
+	input := `fn(first, ...rest) {}
+f(...args, eps: 1e-9)
+2.5E+3 1e
+`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "first"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "args"},
+		{token.COMMA, ","},
+		{token.IDENT, "eps"},
+		{token.COLON, ":"},
+		{token.NUM, "1e-9"},
+		{token.RPAREN, ")"},
+
+		{token.NUM, "2.5E+3"},
+		{token.NUM, "1"},
+		{token.IDENT, "e"},
+
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken8(t *testing.T) {
+	input := `match (x) { 1..9 => a, 1..=9 => b, _ => c }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.NUM, "1"},
+		{token.RANGE, ".."},
+		{token.NUM, "9"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.NUM, "1"},
+		{token.RANGE_EQ, "..="},
+		{token.NUM, "9"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "b"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "c"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken9(t *testing.T) {
+	input := `xs.map(math.sqrt); [...xs]`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "xs"},
+		{token.DOT, "."},
+		{token.IDENT, "map"},
+		{token.LPAREN, "("},
+		{token.IDENT, "math"},
+		{token.DOT, "."},
+		{token.IDENT, "sqrt"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "xs"},
+		{token.RBRACKET, "]"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+  // indented
+x // at end of input`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.NUM, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expected := []Comment{
+		{"// leading", 1, 1},
+		{"// trailing", 2, 12},
+		{"// indented", 3, 3},
+		{"// at end of input", 4, 3},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d (%v)", len(expected), len(comments), comments)
+	}
+	for i, c := range expected {
+		if comments[i] != c {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, c, comments[i])
+		}
+	}
+}
@@ -1,32 +1,137 @@
 package object
 
+import "github.com/darwin1224/saphire/ast"
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool
+	outer  *Environment
+	scope  *ast.Scope
+	slots  []Object
 }
 
 func NewEnvironment() *Environment {
 	return &Environment{
-		store: make(map[string]Object),
-		outer: nil,
+		store:  make(map[string]Object),
+		consts: make(map[string]bool),
+		outer:  nil,
 	}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.lookup(name); ok {
+			return obj, true
+		}
 	}
-	return obj, ok
+	return nil, false
+}
+
+// GetAt returns the value of the local variable at loc, as resolved from
+// e. It reports false if that slot is not bound yet, in which case the
+// caller should fall back to Get.
+func (e *Environment) GetAt(loc ast.Location) (Object, bool) {
+	env := e
+	for depth := loc.Depth; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	if env == nil || loc.Slot >= len(env.slots) {
+		return nil, false
+	}
+	obj := env.slots[loc.Slot]
+	return obj, obj != nil
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	if e.scope != nil {
+		if i, ok := e.scope.Slot(name); ok {
+			e.slots[i] = val
+			delete(e.consts, name)
+			return val
+		}
+	}
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
+	delete(e.consts, name)
 	return val
 }
 
+// SetConst binds name to val as a constant, which Assign cannot replace.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.Set(name, val)
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	return val
+}
+
+// Has reports whether name is defined in this environment, ignoring the
+// enclosing ones.
+func (e *Environment) Has(name string) bool {
+	_, ok := e.lookup(name)
+	return ok
+}
+
+// IsConst reports whether the innermost definition of name is a constant.
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.lookup(name); ok {
+			return env.consts[name]
+		}
+	}
+	return false
+}
+
+// Assign replaces the value of name in the innermost environment that
+// defines it. It reports false if name is not defined or is a constant.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.lookup(name); ok {
+			if env.consts[name] {
+				return false
+			}
+			env.Set(name, val)
+			return true
+		}
+	}
+	return false
+}
+
+// lookup finds name in this environment only, checking its slots first.
+func (e *Environment) lookup(name string) (Object, bool) {
+	if e.scope != nil {
+		if i, ok := e.scope.Slot(name); ok && e.slots[i] != nil {
+			return e.slots[i], true
+		}
+	}
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
 	return env
 }
+
+// NewScopedEnvironment returns an environment enclosed by outer whose names
+// in scope are stored in slots rather than looked up by name. Names outside
+// scope can still be bound with Set.
+func NewScopedEnvironment(outer *Environment, scope *ast.Scope) *Environment {
+	if scope == nil {
+		return NewEnclosedEnvironment(outer)
+	}
+	return &Environment{
+		outer: outer,
+		scope: scope,
+		slots: make([]Object, len(scope.Names)),
+	}
+}
+
+// Outer returns the enclosing environment, or nil for a global environment.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
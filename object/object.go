@@ -22,6 +22,15 @@ const (
 	BUILTIN_OBJ      ObjectType = "BUILTIN"
 	ARRAY_OBJ        ObjectType = "ARRAY"
 	HASH_OBJ         ObjectType = "HASH"
+	MODULE_OBJ       ObjectType = "MODULE"
+	STRUCT_TYPE_OBJ  ObjectType = "STRUCT_TYPE"
+	STRUCT_OBJ       ObjectType = "STRUCT"
+	ENUM_TYPE_OBJ    ObjectType = "ENUM_TYPE"
+	VARIANT_OBJ      ObjectType = "VARIANT"
+	ENUM_OBJ         ObjectType = "ENUM"
+	CLASS_OBJ        ObjectType = "CLASS"
+	INSTANCE_OBJ     ObjectType = "INSTANCE"
+	SUPER_OBJ        ObjectType = "SUPER"
 )
 
 type Object interface {
@@ -57,13 +66,23 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Cause is the Go error behind Message, if any, such as a
+	// *interpreter.LimitError or a context error.
+	Cause error
+	// Trace lists the innermost function calls active when the error was
+	// raised, most recent first.
+	Trace []string
+	// Value is the value passed to `throw`, or nil for errors raised by the
+	// interpreter or a builtin.
+	Value Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string
+	Parameters []*ast.Parameter
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -78,6 +97,9 @@ func (f *Function) Inspect() string {
 	}
 
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -97,23 +119,36 @@ func (s *String) Inspect() string  { return s.Value }
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFunction
+	Name string
+	Fn   BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// Callable is a function that is neither a Function nor a Builtin, such as
+// a closure of the bytecode VM. Builtins taking functions, like `arr.map`,
+// call it with Call.
+type Callable interface {
+	Object
+	Call(args []Object) Object
+}
+
+// Array is a list of elements. A Frozen array cannot be modified.
 type Array struct {
 	Elements []Object
+	Frozen   bool
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
+func (ao *Array) Inspect() string  { return inspect(ao, make(map[Object]bool)) }
+
+func (ao *Array) inspect(seen map[Object]bool) string {
 	var out bytes.Buffer
 
 	elements := make([]string, 0)
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspect(e, seen))
 	}
 
 	out.WriteString("[")
@@ -123,6 +158,45 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// container is an object holding other objects, which may hold the
+// container itself once arrays, hashes and instances are assigned to.
+type container interface {
+	Object
+	inspect(seen map[Object]bool) string
+}
+
+// inspect returns the Inspect text of obj. Containers already being
+// inspected, which obj contains itself through, are printed as [...] for
+// arrays and {...} for the others instead of recursing forever.
+func inspect(obj Object, seen map[Object]bool) string {
+	c, ok := obj.(container)
+	if !ok {
+		return obj.Inspect()
+	}
+
+	if seen[c] {
+		switch c := c.(type) {
+		case *Array:
+			return "[...]"
+		case *Struct:
+			return c.StructType.Name + " {...}"
+		case *Enum:
+			return c.Variant.Name + "(...)"
+		case *Instance:
+			return c.Class.Name + " {...}"
+		default:
+			return "{...}"
+		}
+	}
+
+	seen[c] = true
+	defer delete(seen, c)
+	return c.inspect(seen)
+}
+
+// Hashable is implemented by the values that can be hash keys. Only
+// booleans, numbers and strings are, so hashing never looks inside a
+// container, which may contain itself.
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -159,18 +233,25 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash maps keys to values. A Frozen hash cannot be modified.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Frozen bool
+	// Error is the error a catch block received this hash for, which
+	// throwing the hash raises again unchanged.
+	Error *Error
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
-func (h *Hash) Inspect() string {
+func (h *Hash) Inspect() string { return inspect(h, make(map[Object]bool)) }
+
+func (h *Hash) inspect(seen map[Object]bool) string {
 	var out bytes.Buffer
 	pairs := make([]string, 0)
 
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, seen)))
 	}
 
 	out.WriteString("{")
@@ -179,3 +260,209 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// Module is the namespace of an imported source file, holding the values
+// the file exports.
+type Module struct {
+	Name    string
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+// StructType is a type declared with `struct`. Calling it constructs a
+// Struct with its Fields, in order.
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "<struct " + st.Name + ">" }
+
+// FieldIndex returns the position of the field name, or -1 if the type has
+// no such field.
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Struct is a value of a StructType. Values holds the value of each field,
+// in the order of the type's Fields.
+type Struct struct {
+	StructType *StructType
+	Values     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string  { return inspect(s, make(map[Object]bool)) }
+
+func (s *Struct) inspect(seen map[Object]bool) string {
+	fields := make([]string, len(s.Values))
+	for i, value := range s.Values {
+		fields[i] = s.StructType.Fields[i] + ": " + inspect(value, seen)
+	}
+
+	if len(fields) == 0 {
+		return s.StructType.Name + " {}"
+	}
+	return s.StructType.Name + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// Get returns the value of the field name.
+func (s *Struct) Get(name string) (Object, bool) {
+	i := s.StructType.FieldIndex(name)
+	if i < 0 {
+		return nil, false
+	}
+	return s.Values[i], true
+}
+
+// EnumType is a type declared with `enum`, made of Variants.
+type EnumType struct {
+	Name     string
+	Variants []*Variant
+}
+
+func (et *EnumType) Type() ObjectType { return ENUM_TYPE_OBJ }
+func (et *EnumType) Inspect() string  { return "<enum " + et.Name + ">" }
+
+// Variant returns the variant called name.
+func (et *EnumType) Variant(name string) (*Variant, bool) {
+	for _, variant := range et.Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return nil, false
+}
+
+// Variant is a variant of an EnumType. Calling a variant with Fields
+// constructs an Enum with its fields, in order.
+type Variant struct {
+	EnumType *EnumType
+	Name     string
+	Fields   []string
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string  { return "<variant " + v.EnumType.Name + "." + v.Name + ">" }
+
+// FieldIndex returns the position of the field name, or -1 if the variant
+// has no such field.
+func (v *Variant) FieldIndex(name string) int {
+	for i, field := range v.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Enum is a value of an enum variant. Values holds the value of each field,
+// in the order of the variant's Fields.
+type Enum struct {
+	Variant *Variant
+	Values  []Object
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string  { return inspect(e, make(map[Object]bool)) }
+
+func (e *Enum) inspect(seen map[Object]bool) string {
+	if len(e.Variant.Fields) == 0 {
+		return e.Variant.Name
+	}
+
+	values := make([]string, len(e.Values))
+	for i, value := range e.Values {
+		values[i] = inspect(value, seen)
+	}
+
+	return e.Variant.Name + "(" + strings.Join(values, ", ") + ")"
+}
+
+// Get returns the value of the field name.
+func (e *Enum) Get(name string) (Object, bool) {
+	i := e.Variant.FieldIndex(name)
+	if i < 0 {
+		return nil, false
+	}
+	return e.Values[i], true
+}
+
+// Class is a class declared with `class`. Calling it creates an Instance
+// and initializes it with the `init` method, if the class has one. Methods
+// are *Function values, or closures when the class is declared by the VM.
+type Class struct {
+	Name       string
+	Superclass *Class
+	Methods    map[string]Object
+}
+
+func (c *Class) Type() ObjectType { return CLASS_OBJ }
+func (c *Class) Inspect() string  { return "<class " + c.Name + ">" }
+
+// FindMethod looks up the method name in the class and its superclasses,
+// returning the class that defines it.
+func (c *Class) FindMethod(name string) (Object, *Class, bool) {
+	for class := c; class != nil; class = class.Superclass {
+		if method, ok := class.Methods[name]; ok {
+			return method, class, true
+		}
+	}
+	return nil, nil, false
+}
+
+// Instance is an object created by calling a Class. Fields are created by
+// assigning to them and are kept in the order they were first assigned. The
+// fields of a Frozen instance cannot be assigned.
+type Instance struct {
+	Class  *Class
+	Fields map[string]Object
+	Names  []string
+	Frozen bool
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{Class: class, Fields: make(map[string]Object)}
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string  { return inspect(i, make(map[Object]bool)) }
+
+func (i *Instance) inspect(seen map[Object]bool) string {
+	fields := make([]string, len(i.Names))
+	for n, name := range i.Names {
+		fields[n] = name + ": " + inspect(i.Fields[name], seen)
+	}
+
+	if len(fields) == 0 {
+		return i.Class.Name + " {}"
+	}
+	return i.Class.Name + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// Set assigns the field name, creating it if needed.
+func (i *Instance) Set(name string, value Object) {
+	if _, ok := i.Fields[name]; !ok {
+		i.Names = append(i.Names, name)
+	}
+	i.Fields[name] = value
+}
+
+// Super is bound to `super` in the methods of a class that extends
+// another. Its members are the methods of Class bound to Self.
+type Super struct {
+	Self  *Instance
+	Class *Class
+}
+
+func (s *Super) Type() ObjectType { return SUPER_OBJ }
+func (s *Super) Inspect() string  { return "<super " + s.Class.Name + ">" }
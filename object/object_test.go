@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +24,46 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestScopedEnvironment(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("x", &Number{Value: 1})
+
+	env := NewScopedEnvironment(global, ast.NewScope([]string{"x", "y"}))
+
+	if _, ok := env.GetAt(ast.Location{Depth: 0, Slot: 0}); ok {
+		t.Errorf("unbound slot reported as bound")
+	}
+	if obj, ok := env.Get("x"); !ok || obj.(*Number).Value != 1 {
+		t.Errorf("unbound slot does not fall back to the enclosing environment. got=%v", obj)
+	}
+
+	env.Set("x", &Number{Value: 2})
+	env.Set("z", &Number{Value: 3})
+
+	if obj, ok := env.GetAt(ast.Location{Depth: 0, Slot: 0}); !ok || obj.(*Number).Value != 2 {
+		t.Errorf("wrong value in slot 0. got=%v", obj)
+	}
+	if _, ok := env.GetAt(ast.Location{Depth: 0, Slot: 1}); ok {
+		t.Errorf("unbound slot 1 reported as bound")
+	}
+	if obj, ok := env.Get("z"); !ok || obj.(*Number).Value != 3 {
+		t.Errorf("name outside the scope not bound. got=%v", obj)
+	}
+
+	inner := NewScopedEnvironment(env, ast.NewScope(nil))
+	if obj, ok := inner.GetAt(ast.Location{Depth: 1, Slot: 0}); !ok || obj.(*Number).Value != 2 {
+		t.Errorf("wrong value at depth 1. got=%v", obj)
+	}
+	if !inner.Assign("x", &Number{Value: 4}) {
+		t.Fatalf("Assign failed")
+	}
+	if obj, _ := env.GetAt(ast.Location{Depth: 0, Slot: 0}); obj.(*Number).Value != 4 {
+		t.Errorf("Assign did not update the slot. got=%v", obj)
+	}
+
+	env.SetConst("y", &Number{Value: 5})
+	if inner.Assign("y", &Number{Value: 6}) {
+		t.Errorf("Assign replaced a constant slot")
+	}
+}
@@ -0,0 +1,260 @@
+package optimizer
+
+import (
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/token"
+)
+
+// trivial is a function whose calls can be replaced by its body.
+type trivial struct {
+	// at is the token of the declaration. Only calls after it are inlined,
+	// since calls before it fail at runtime.
+	at         token.Token
+	parameters []string
+	body       ast.Expression
+}
+
+// trivialFunctions returns the trivial functions declared as constants at
+// the top level of program by name. Other top-level bindings are globals
+// that a later program run in the same environment may assign or declare
+// again, after the calls to them have been inlined. Names bound more than
+// once anywhere in the program are left out, so that every identifier with
+// the name of a trivial function refers to it.
+func trivialFunctions(program *ast.Program) map[string]*trivial {
+	count := bindings(program)
+
+	functions := make(map[string]*trivial)
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Token.Type != token.CONST || let.Name == nil || count[let.Name.Value] != 1 {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+
+		if t := newTrivial(fn); t != nil {
+			t.at = let.Token
+			functions[let.Name.Value] = t
+		}
+	}
+
+	return functions
+}
+
+// newTrivial returns fn as a trivial function, or nil if it is not one.
+// The parameters of a trivial function are plain names, each first used in
+// the order they are declared, so that inlining a call evaluates its
+// arguments in the same order as the call.
+func newTrivial(fn *ast.FunctionLiteral) *trivial {
+	if len(fn.Body.Statements) != 1 {
+		return nil
+	}
+
+	var body ast.Expression
+	switch stmt := fn.Body.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		body = stmt.Expression
+	case *ast.ReturnStatement:
+		body = stmt.ReturnValue
+	}
+	if body == nil {
+		return nil
+	}
+
+	t := &trivial{}
+	index := make(map[string]int)
+	for i, param := range fn.Parameters {
+		if param.Name == nil || param.Default != nil || param.Variadic {
+			return nil
+		}
+		if _, ok := index[param.Name.Value]; ok {
+			return nil
+		}
+		index[param.Name.Value] = i
+		t.parameters = append(t.parameters, param.Name.Value)
+	}
+
+	var used []string
+	if !simple(body, index, &used) || len(used) != len(t.parameters) {
+		return nil
+	}
+	for i, name := range used {
+		if name != t.parameters[i] {
+			return nil
+		}
+	}
+
+	t.body = body
+	return t
+}
+
+// simple reports whether exp consists only of operators, literals and the
+// parameters in index, appending the parameters it uses to used in the
+// order they are first evaluated.
+func simple(exp ast.Expression, index map[string]int, used *[]string) bool {
+	switch exp := exp.(type) {
+	case *ast.NumberLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.Identifier:
+		if _, ok := index[exp.Value]; !ok {
+			return false
+		}
+		for _, name := range *used {
+			if name == exp.Value {
+				return true
+			}
+		}
+		*used = append(*used, exp.Value)
+		return true
+	case *ast.UnaryExpression:
+		return simple(exp.Right, index, used)
+	case *ast.BinaryExpression:
+		return simple(exp.Left, index, used) && simple(exp.Right, index, used)
+	case *ast.IndexExpression:
+		return simple(exp.Left, index, used) && simple(exp.Index, index, used)
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			if !simple(el, index, used) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// inlined returns the body of the trivial function called by call with its
+// parameters replaced by the arguments, or nil if the call cannot be
+// inlined.
+func (o *optimizer) inlined(call *ast.CallExpression) ast.Expression {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	t, ok := o.inline[ident.Value]
+	if !ok || len(call.Arguments) != len(t.parameters) || !after(call.Token, t.at) {
+		return nil
+	}
+
+	args := make(map[string]ast.Expression, len(t.parameters))
+	for i, arg := range call.Arguments {
+		switch arg.(type) {
+		case *ast.NumberLiteral, *ast.StringLiteral, *ast.Boolean, *ast.Identifier:
+			args[t.parameters[i]] = arg
+		default:
+			return nil
+		}
+	}
+
+	return substitute(t.body, args)
+}
+
+func after(tok, at token.Token) bool {
+	return tok.Line > at.Line || (tok.Line == at.Line && tok.Column > at.Column)
+}
+
+// substitute returns a copy of exp, a simple expression, with the
+// identifiers in args replaced by copies of their value. Nodes are copied
+// so that every inlined body has nodes of its own.
+func substitute(exp ast.Expression, args map[string]ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.NumberLiteral:
+		copied := *exp
+		return &copied
+	case *ast.StringLiteral:
+		copied := *exp
+		return &copied
+	case *ast.Boolean:
+		copied := *exp
+		return &copied
+	case *ast.Identifier:
+		if arg, ok := args[exp.Value]; ok {
+			return substitute(arg, nil)
+		}
+		copied := *exp
+		return &copied
+	case *ast.UnaryExpression:
+		return &ast.UnaryExpression{Token: exp.Token, Operator: exp.Operator, Right: substitute(exp.Right, args)}
+	case *ast.BinaryExpression:
+		return &ast.BinaryExpression{Token: exp.Token, Left: substitute(exp.Left, args), Operator: exp.Operator, Right: substitute(exp.Right, args)}
+	case *ast.IndexExpression:
+		return &ast.IndexExpression{Token: exp.Token, Left: substitute(exp.Left, args), Index: substitute(exp.Index, args)}
+	case *ast.ArrayLiteral:
+		elements := make([]ast.Expression, len(exp.Elements))
+		for i, el := range exp.Elements {
+			elements[i] = substitute(el, args)
+		}
+		return &ast.ArrayLiteral{Token: exp.Token, Elements: elements}
+	}
+	return exp
+}
+
+// bindings counts how many times each name is bound in program. An
+// assignment to a name counts as a binding.
+func bindings(program *ast.Program) map[string]int {
+	count := make(map[string]int)
+	bind := func(ident *ast.Identifier) {
+		if ident != nil {
+			count[ident.Value]++
+		}
+	}
+	bindPattern := func(pattern ast.Pattern) {
+		if ident, ok := pattern.(*ast.Identifier); ok {
+			bind(ident)
+		}
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			bind(n.Name)
+		case *ast.FunctionStatement:
+			bind(n.Name)
+		case *ast.Parameter:
+			bind(n.Name)
+		case *ast.ImportStatement:
+			bind(n.Alias)
+		case *ast.ImportName:
+			if n.Alias != nil {
+				bind(n.Alias)
+			} else {
+				bind(n.Name)
+			}
+		case *ast.StructStatement:
+			bind(n.Name)
+		case *ast.EnumStatement:
+			bind(n.Name)
+		case *ast.EnumVariant:
+			bind(n.Name)
+		case *ast.ClassStatement:
+			bind(n.Name)
+		case *ast.ArrayPattern:
+			bind(n.Rest)
+		case *ast.HashPattern:
+			bind(n.Rest)
+		case *ast.PatternElement:
+			bindPattern(n.Pattern)
+		case *ast.VariantPattern:
+			for _, arg := range n.Arguments {
+				bindPattern(arg)
+			}
+		case *ast.MatchArm:
+			bindPattern(n.Pattern)
+		case *ast.TryExpression:
+			bindPattern(n.Param)
+		case *ast.AssignExpression:
+			if ident, ok := n.Target.(*ast.Identifier); ok {
+				bind(ident)
+			}
+		}
+		return true
+	})
+
+	return count
+}
@@ -0,0 +1,433 @@
+// Package optimizer rewrites programs into equivalent programs that do less
+// work when they run.
+//
+// Optimize applies three rewrites:
+//
+//   - Operators applied to number, string and boolean literals are folded
+//     into the literal they evaluate to, so `4 / 24` and `"a" + "b"` are
+//     computed once. Operations that fail at runtime, like `"a" - 1`, are
+//     left for the engine to report.
+//   - Branches that cannot run are removed: the other branch of an `if`
+//     whose condition is a literal, and the statements of a block after a
+//     `return` or `throw`.
+//   - Calls to trivial functions are replaced by their body. A function is
+//     trivial when it is declared once as a constant at the top level of
+//     the program, so that no later program run in the same environment can
+//     replace it, and its body is a single expression of operators,
+//     literals and its own parameters. Calls are inlined when every argument
+//     is a literal or a variable.
+//
+// An optimized program computes the same values, prints the same output
+// and fails with the same errors as the original, but takes fewer steps
+// against the limits of a run, shows the optimized body when a function
+// is printed, and has no frames for inlined calls in its error traces.
+package optimizer
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/token"
+)
+
+// Optimize rewrites program in place and returns it. A program must be
+// optimized before it first runs.
+func Optimize(program *ast.Program) *ast.Program {
+	o := &optimizer{inline: trivialFunctions(program)}
+	program.Statements = o.statements(program.Statements)
+	return program
+}
+
+type optimizer struct {
+	inline map[string]*trivial
+}
+
+// statements optimizes stmts, splicing in the blocks of `if` statements
+// whose branch is known and dropping the statements that cannot run.
+func (o *optimizer) statements(stmts []ast.Statement) []ast.Statement {
+	out := make([]ast.Statement, 0, len(stmts))
+
+	for i, stmt := range stmts {
+		stmt = o.statement(stmt)
+
+		if block := spliceable(stmt); block != nil {
+			// An empty block still gives the statement list its value,
+			// nil, when it comes last.
+			if len(block.Statements) > 0 || i < len(stmts)-1 {
+				out = append(out, block.Statements...)
+				if terminates(block.Statements) {
+					break
+				}
+				continue
+			}
+		}
+
+		out = append(out, stmt)
+		if terminates(out[len(out)-1:]) {
+			break
+		}
+	}
+
+	return out
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		o.pattern(stmt.Pattern)
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		o.block(stmt)
+	case *ast.FunctionStatement:
+		o.function(stmt.Function)
+	case *ast.ExportStatement:
+		stmt.Statement = o.statement(stmt.Statement)
+	case *ast.ClassStatement:
+		stmt.Superclass = o.expression(stmt.Superclass)
+		for _, method := range stmt.Methods {
+			o.function(method)
+		}
+	}
+	return stmt
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements)
+	}
+}
+
+func (o *optimizer) function(fn *ast.FunctionLiteral) {
+	for _, param := range fn.Parameters {
+		o.pattern(param.Pattern)
+		param.Default = o.expression(param.Default)
+	}
+	o.block(fn.Body)
+}
+
+// pattern optimizes the defaults of the elements of pattern. The literals
+// tested by a pattern are left as they are.
+func (o *optimizer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			o.element(el)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			o.element(pair.Value)
+		}
+	case *ast.VariantPattern:
+		for _, arg := range pattern.Arguments {
+			o.pattern(arg)
+		}
+	}
+}
+
+func (o *optimizer) element(el *ast.PatternElement) {
+	o.pattern(el.Pattern)
+	el.Default = o.expression(el.Default)
+}
+
+func (o *optimizer) expression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.UnaryExpression:
+		exp.Right = o.expression(exp.Right)
+		if folded := foldUnary(exp); folded != nil {
+			return folded
+		}
+	case *ast.BinaryExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Right = o.expression(exp.Right)
+		if folded := foldBinary(exp); folded != nil {
+			return folded
+		}
+	case *ast.IfExpression:
+		return o.ifExpression(exp)
+	case *ast.FunctionLiteral:
+		o.function(exp)
+	case *ast.CallExpression:
+		exp.Function = o.expression(exp.Function)
+		o.expressions(exp.Arguments)
+		if body := o.inlined(exp); body != nil {
+			return o.expression(body)
+		}
+	case *ast.SpreadExpression:
+		exp.Value = o.expression(exp.Value)
+	case *ast.NamedArgument:
+		exp.Value = o.expression(exp.Value)
+	case *ast.ArrayLiteral:
+		o.expressions(exp.Elements)
+	case *ast.IndexExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Index = o.expression(exp.Index)
+	case *ast.MemberExpression:
+		exp.Object = o.expression(exp.Object)
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression, len(exp.Pairs))
+		keys := make([]ast.Expression, 0, len(exp.Pairs))
+		for _, key := range exp.OrderedKeys() {
+			value := exp.Pairs[key]
+			key = o.expression(key)
+			pairs[key] = o.expression(value)
+			keys = append(keys, key)
+		}
+		exp.Pairs, exp.Keys = pairs, keys
+	case *ast.MatchExpression:
+		exp.Subject = o.expression(exp.Subject)
+		for _, arm := range exp.Arms {
+			o.pattern(arm.Pattern)
+			arm.Guard = o.expression(arm.Guard)
+			o.block(arm.Body)
+		}
+	case *ast.ThrowExpression:
+		exp.Value = o.expression(exp.Value)
+	case *ast.TryExpression:
+		o.block(exp.Block)
+		o.pattern(exp.Param)
+		o.block(exp.Catch)
+		o.block(exp.Finally)
+	case *ast.WithExpression:
+		exp.Left = o.expression(exp.Left)
+		for _, field := range exp.Fields {
+			field.Value = o.expression(field.Value)
+		}
+	case *ast.AssignExpression:
+		// The target is a place, not a value, so only its parts are
+		// optimized.
+		switch target := exp.Target.(type) {
+		case *ast.IndexExpression:
+			target.Left = o.expression(target.Left)
+			target.Index = o.expression(target.Index)
+		case *ast.MemberExpression:
+			target.Object = o.expression(target.Object)
+		}
+		exp.Value = o.expression(exp.Value)
+	}
+	return exp
+}
+
+func (o *optimizer) expressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		exps[i] = o.expression(exp)
+	}
+}
+
+// ifExpression drops the branch of ie that cannot run when its condition
+// is a literal. An `if` whose remaining branch is a single expression is
+// replaced by the expression.
+func (o *optimizer) ifExpression(ie *ast.IfExpression) ast.Expression {
+	ie.Condition = o.expression(ie.Condition)
+
+	truthy, known := isTruthy(ie.Condition)
+	if !known {
+		o.block(ie.Consequence)
+		o.block(ie.Alternative)
+		return ie
+	}
+
+	switch {
+	case truthy:
+		ie.Alternative = nil
+	case ie.Alternative != nil:
+		ie.Condition = &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Line: ie.Token.Line, Column: ie.Token.Column}, Value: true}
+		ie.Consequence, ie.Alternative = ie.Alternative, nil
+	default:
+		ie.Consequence = &ast.BlockStatement{Token: ie.Consequence.Token}
+		return ie
+	}
+
+	o.block(ie.Consequence)
+	if len(ie.Consequence.Statements) == 1 {
+		if es, ok := ie.Consequence.Statements[0].(*ast.ExpressionStatement); ok && es.Expression != nil {
+			return es.Expression
+		}
+	}
+	return ie
+}
+
+// spliceable returns the block that the statement stmt always runs, when
+// it is an `if` with a literal condition whose block declares nothing, so
+// that its statements can run in the enclosing block instead.
+func spliceable(stmt ast.Statement) *ast.BlockStatement {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok || ie.Alternative != nil {
+		return nil
+	}
+	if truthy, known := isTruthy(ie.Condition); !known || (!truthy && len(ie.Consequence.Statements) > 0) {
+		return nil
+	}
+
+	for _, stmt := range ie.Consequence.Statements {
+		switch stmt.(type) {
+		case *ast.LetStatement, *ast.FunctionStatement, *ast.StructStatement, *ast.EnumStatement,
+			*ast.ClassStatement, *ast.ImportStatement, *ast.ExportStatement:
+			return nil
+		}
+	}
+	return ie.Consequence
+}
+
+// terminates reports whether the last of stmts always leaves the block,
+// so that the statements after it cannot run.
+func terminates(stmts []ast.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	switch stmt := stmts[len(stmts)-1].(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.ExpressionStatement:
+		_, ok := stmt.Expression.(*ast.ThrowExpression)
+		return ok
+	}
+	return false
+}
+
+// isTruthy reports whether exp counts as true in a condition, and whether
+// that is known before the program runs.
+func isTruthy(exp ast.Expression) (truthy, known bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.NumberLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// foldUnary returns the literal ue evaluates to, or nil.
+func foldUnary(ue *ast.UnaryExpression) ast.Expression {
+	switch right := ue.Right.(type) {
+	case *ast.NumberLiteral:
+		switch ue.Operator {
+		case "-":
+			return number(ue.Token, -right.Value)
+		case "!":
+			return boolean(ue.Token, false)
+		}
+	case *ast.StringLiteral:
+		if ue.Operator == "!" {
+			return boolean(ue.Token, false)
+		}
+	case *ast.Boolean:
+		if ue.Operator == "!" {
+			return boolean(ue.Token, !right.Value)
+		}
+	}
+	return nil
+}
+
+// foldBinary returns the literal be evaluates to, or nil. It follows the
+// interpreter's rules for each operator and operand type.
+func foldBinary(be *ast.BinaryExpression) ast.Expression {
+	if !isLiteral(be.Left) || !isLiteral(be.Right) {
+		return nil
+	}
+
+	switch left := be.Left.(type) {
+	case *ast.NumberLiteral:
+		if right, ok := be.Right.(*ast.NumberLiteral); ok {
+			return foldNumbers(be.Token, be.Operator, left.Value, right.Value)
+		}
+	case *ast.StringLiteral:
+		if right, ok := be.Right.(*ast.StringLiteral); ok {
+			if be.Operator != "+" {
+				return nil
+			}
+			return &ast.StringLiteral{Token: literalToken(be.Token, token.STRING, left.Value+right.Value), Value: left.Value + right.Value}
+		}
+	}
+
+	// Other operands are equal only when they are the same boolean.
+	equal := false
+	if left, ok := be.Left.(*ast.Boolean); ok {
+		if right, ok := be.Right.(*ast.Boolean); ok {
+			equal = left.Value == right.Value
+		}
+	}
+
+	switch be.Operator {
+	case "==":
+		return boolean(be.Token, equal)
+	case "!=":
+		return boolean(be.Token, !equal)
+	}
+	return nil
+}
+
+func foldNumbers(tok token.Token, operator string, left, right float64) ast.Expression {
+	var value float64
+
+	switch operator {
+	case "+":
+		value = left + right
+	case "-":
+		value = left - right
+	case "*":
+		value = left * right
+	case "**":
+		value = math.Pow(left, right)
+	case "/":
+		value = left / right
+	case "%":
+		if int64(right) == 0 {
+			return nil
+		}
+		value = float64(int64(left) % int64(right))
+	case "<":
+		return boolean(tok, left < right)
+	case ">":
+		return boolean(tok, left > right)
+	case "<=":
+		return boolean(tok, left <= right)
+	case ">=":
+		return boolean(tok, left >= right)
+	case "==":
+		return boolean(tok, left == right)
+	case "!=":
+		return boolean(tok, left != right)
+	default:
+		return nil
+	}
+
+	// Infinities and NaN have no literal, so they are computed at runtime.
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil
+	}
+	return number(tok, value)
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.NumberLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+func number(tok token.Token, value float64) *ast.NumberLiteral {
+	return &ast.NumberLiteral{Token: literalToken(tok, token.NUM, strconv.FormatFloat(value, 'f', -1, 64)), Value: value}
+}
+
+func boolean(tok token.Token, value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: literalToken(tok, token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: literalToken(tok, token.FALSE, "false"), Value: false}
+}
+
+// literalToken returns the token of a literal replacing the expression at
+// the position of tok.
+func literalToken(tok token.Token, typ token.TokenType, literal string) token.Token {
+	return token.Token{Type: typ, Literal: literal, Line: tok.Line, Column: tok.Column}
+}
@@ -0,0 +1,97 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Constant folding.
+		{"4 / 24 * 6", "1"},
+		{"1 + 2 * 3 - -4", "11"},
+		{"2 ** 10 % 7", "2"},
+		{"(1 + 2) * n", "(3 * n)"},
+		{"(2 * n) * (2 * n + 1)", "((2 * n) * ((2 * n) + 1))"},
+		{`"a" + "b" + "c"`, "abc"},
+		{"1 < 2 == true", "true"},
+		{"!(1 > 2)", "true"},
+		{`1 == "1"`, "false"},
+		{"true != false", "true"},
+		{"-(-2.5)", "2.5"},
+		// Operations that fail at runtime are kept.
+		{`"a" - "b"`, "(a - b)"},
+		{`"a" == "a"`, "(a == a)"},
+		{"1 + true", "(1 + true)"},
+		{"5 % 0", "(5 % 0)"},
+		{"1 / 0", "(1 / 0)"},
+		{"-true", "(-true)"},
+		// Dead branches.
+		{"if (true) { a } else { b }", "a"},
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (false) { a }; 1", "1"},
+		{"if (false) { a }", "iffalse "},
+		{"if (x) { 1 + 1 } else { 2 * 2 }", "ifx 2else 4"},
+		{"if (true) { print(1); print(2) }; 3", "print(1)print(2)3"},
+		{"let y = if (true) { 1; 2 } else { 3 };", "let y = iftrue 12;"},
+		{"if (true) { let a = 1; a }; 2", "iftrue let a = 1;a2"},
+		{"if (\"\") { a } else { b }", "a"},
+		// Statements after return and throw.
+		{"fn() { return 1; print(2) }", "fn() return 1;"},
+		{"fn() { if (true) { return 1 }; print(2) }", "fn() return 1;"},
+		{"fn() { throw 1; print(2) }", "fn() throw 1"},
+		{"try { throw 1; print(2) } catch (e) { e; 3 }", "try throw 1 catch (e) e3"},
+		// Trivial functions.
+		{"const double = fn(x) { x * 2 }; double(21)", "const double = fn(x) (x * 2);42"},
+		{"const sq = fn(x) { x * x }; sq(n)", "const sq = fn(x) (x * x);(n * n)"},
+		{"const sub = fn(a, b) { return a - b }; sub(10, 4)", "const sub = fn(a, b) return (a - b);;6"},
+		{`const greet = fn(name) { "hi " + name }; greet("bo")`, "const greet = fn(name) (hi  + name);hi bo"},
+		{"const pair = fn(a, b) { [a, b][0] }; pair(1, 2)", "const pair = fn(a, b) ([a, b][0]);([1, 2][0])"},
+		// Calls that cannot be inlined.
+		{"fn double(x) { x * 2 }; double(21)", "fn double(x) (x * 2)double(21)"},
+		{"let sq = fn(x) { x * x }; sq(n)", "let sq = fn(x) (x * x);sq(n)"},
+		{"double(1); const double = fn(x) { x * 2 }", "double(1)const double = fn(x) (x * 2);"},
+		{"const double = fn(x) { x * 2 }; double(f())", "const double = fn(x) (x * 2);double(f())"},
+		{"const swap = fn(a, b) { b - a }; swap(x, y)", "const swap = fn(a, b) (b - a);swap(x, y)"},
+		{"const first = fn(a, b) { a }; first(1, 2)", "const first = fn(a, b) a;first(1, 2)"},
+		{"const scale = fn(x) { x * k }; scale(2)", "const scale = fn(x) (x * k);scale(2)"},
+		{"const twice = fn(f) { f(1) }; twice(g)", "const twice = fn(f) f(1);twice(g)"},
+		{"const opt = fn(x = 1) { x }; opt(2)", "const opt = fn(x = 1) x;opt(2)"},
+		{"const inc = fn(x) { x + 1 }; fn(inc) { inc(1) }", "const inc = fn(x) (x + 1);fn(inc) inc(1)"},
+		{"fn() { const inc = fn(x) { x + 1 }; inc(1) }", "fn() const inc = fn(x) (x + 1);inc(1)"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizeCopiesInlinedNodes(t *testing.T) {
+	program := Optimize(parse(t, "const sq = fn(x) { x * x }; sq(a); sq(a)"))
+
+	first := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.BinaryExpression)
+	second := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.BinaryExpression)
+	if first == second || first.Left == first.Right || first.Left == second.Left {
+		t.Errorf("inlined bodies share nodes")
+	}
+}
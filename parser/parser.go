@@ -45,6 +45,11 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.registerUnaryParser(token.STRING, p.parseStringLiteral)
 	p.registerUnaryParser(token.LBRACKET, p.parseArrayLiteral)
 	p.registerUnaryParser(token.LBRACE, p.parseHashLiteral)
+	p.registerUnaryParser(token.ELLIPSIS, p.parseSpreadExpression)
+	p.registerUnaryParser(token.PIPE, p.parseLambdaLiteral)
+	p.registerUnaryParser(token.MATCH, p.parseMatchExpression)
+	p.registerUnaryParser(token.THROW, p.parseThrowExpression)
+	p.registerUnaryParser(token.TRY, p.parseTryExpression)
 
 	p.binaryParsers = make(map[token.TokenType]binaryParseFn)
 	p.registerBinaryParser(token.PLUS, p.parseBinaryExpression)
@@ -61,6 +66,9 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.registerBinaryParser(token.GTE, p.parseBinaryExpression)
 	p.registerBinaryParser(token.LPAREN, p.parseCallExpression)
 	p.registerBinaryParser(token.LBRACKET, p.parseIndexExpression)
+	p.registerBinaryParser(token.DOT, p.parseMemberExpression)
+	p.registerBinaryParser(token.WITH, p.parseWithExpression)
+	p.registerBinaryParser(token.ASSIGN, p.parseAssignExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -97,10 +105,25 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.CLASS:
+		return p.parseClassStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -109,19 +132,260 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.currToken}
 
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseImportStatement parses `import "path" as name`, `import "path"` and
+// `import { a, b as c } from "path"`. The words as and from are only
+// keywords in this position.
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+
+		stmt.Names = p.parseImportNames()
+		if stmt.Names == nil {
+			return nil
+		}
+
+		if !p.expectPeekWord("from") {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+	if stmt.Names == nil && p.peekWordIs("as") {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Alias = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportNames() []*ast.ImportName {
+	names := make([]*ast.ImportName, 0)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		name := &ast.ImportName{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+
+		if p.peekWordIs("as") {
+			p.nextToken()
+
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+
+			name.Alias = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		}
+		names = append(names, name)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return names
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.currToken}
+
+	p.nextToken()
+
+	switch {
+	case p.currTokenIs(token.LET), p.currTokenIs(token.CONST), p.currTokenIs(token.STRUCT), p.currTokenIs(token.ENUM), p.currTokenIs(token.CLASS):
+	case p.currTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+	default:
+		msg := fmt.Sprintf("expected declaration after export, got %s instead", p.currToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	stmt.Statement = p.parseStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.currToken}
+
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = p.parseFieldList(token.RBRACE, "struct "+stmt.Name.Value)
+	if stmt.Fields == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
 
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	p.nextToken()
+	stmt.Variants = make([]*ast.EnumVariant, 0)
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	stmt.Value = p.parseExpression(LOWEST)
+		variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+		if seen[variant.Name.Value] {
+			msg := fmt.Sprintf("duplicate variant %s in enum %s", variant.Name.Value, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[variant.Name.Value] = true
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			variant.Fields = p.parseFieldList(token.RPAREN, "variant "+variant.Name.Value)
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseClassStatement() ast.Statement {
+	stmt := &ast.ClassStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekWordIs("extends") {
+		p.nextToken()
+		p.nextToken()
+		stmt.Superclass = p.parseExpression(LOWEST)
+		if stmt.Superclass == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Methods = make([]*ast.FunctionLiteral, 0)
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		method := &ast.FunctionLiteral{Token: p.currToken, Name: p.currToken.Literal}
+		if seen[method.Name] {
+			msg := fmt.Sprintf("duplicate method %s in class %s", method.Name, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[method.Name] = true
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		method.Parameters = p.parseFunctionParameters()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		method.Body = p.parseBlockStatement()
+
+		stmt.Methods = append(stmt.Methods, method)
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -130,6 +394,38 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	return stmt
 }
 
+// parseFieldList parses comma-separated field names up to end, reporting
+// duplicates as fields of owner.
+func (p *Parser) parseFieldList(end token.TokenType, owner string) []*ast.Identifier {
+	fields := make([]*ast.Identifier, 0)
+	seen := make(map[string]bool)
+
+	for !p.peekTokenIs(end) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in %s", field.Value, owner)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[field.Value] = true
+		fields = append(fields, field)
+
+		if !p.peekTokenIs(end) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return fields
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.currToken}
 
@@ -300,94 +596,741 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := make([]*ast.Identifier, 0)
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.currToken}
 
-	if p.peekTokenIs(token.RPAREN) {
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+
+	lit.Token = stmt.Token
+	lit.Name = stmt.Name.Value
+	stmt.Function = lit
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
-		return identifiers
 	}
 
-	p.nextToken()
+	return stmt
+}
 
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-	identifiers = append(identifiers, ident)
+// parseLambdaLiteral parses `|params| body`, where body is either a block or
+// a single expression.
+func (p *Parser) parseLambdaLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.currToken}
 
-	for p.peekTokenIs(token.COMMA) {
+	lit.Parameters = make([]*ast.Parameter, 0)
+	if p.peekTokenIs(token.PIPE) {
 		p.nextToken()
+	} else {
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
+		lit.Parameters = append(lit.Parameters, p.parseParameter())
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			lit.Parameters = append(lit.Parameters, p.parseParameter())
+		}
+
+		if !p.expectPeek(token.PIPE) {
+			return nil
+		}
+		p.checkParameterOrder(lit.Parameters)
 	}
 
-	return identifiers
-}
+	lit.Body = p.parseBody()
 
-func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.currToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
-	return exp
+	return lit
 }
 
-func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
-}
+// parseBody parses the body of a lambda or match arm, which is either a
+// block or a single expression. A single expression is wrapped in a block
+// so that both forms evaluate the same way.
+//
+// A body starting with a brace is a hash literal if a key and a colon follow
+// the brace, since no statement starts with them, and a block otherwise.
+// Empty braces are an empty block, and a hash whose first key is computed
+// must be parenthesized. The block wrapping a hash takes the token before
+// it, so that only blocks in braces have a brace as their token.
+func (p *Parser) parseBody() *ast.BlockStatement {
+	before := p.currToken
+	p.nextToken()
 
-func (p *Parser) parseArrayLiteral() ast.Expression {
-	array := &ast.ArrayLiteral{Token: p.currToken}
+	if !p.currTokenIs(token.LBRACE) {
+		return p.parseExpressionBody()
+	}
 
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	switch p.peekToken.Type {
+	case token.IDENT, token.STRING, token.NUM, token.TRUE, token.FALSE:
+		// The lexer is copied to look at the token after the key without
+		// consuming it.
+		lexer := *p.lexer
+		if lexer.NextToken().Type == token.COLON {
+			body := p.parseExpressionBody()
+			body.Token = before
+			return body
+		}
+	}
 
-	return array
+	return p.parseBlockStatement()
 }
 
-func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
-	list := make([]ast.Expression, 0)
+func (p *Parser) parseExpressionBody() *ast.BlockStatement {
+	body := &ast.ExpressionStatement{Token: p.currToken, Expression: p.parseExpression(LOWEST)}
+	return &ast.BlockStatement{Token: body.Token, Statements: []ast.Statement{body}}
+}
 
-	if p.peekTokenIs(end) {
+func (p *Parser) parseFunctionParameters() []*ast.Parameter {
+	params := make([]*ast.Parameter, 0)
+
+	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return list
+		return params
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	params = append(params, p.parseParameter())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		params = append(params, p.parseParameter())
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return list
+	p.checkParameterOrder(params)
+
+	return params
 }
 
-func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+func (p *Parser) parseParameter() *ast.Parameter {
+	param := &ast.Parameter{Token: p.currToken}
 
-	p.nextToken()
+	if p.currTokenIs(token.ELLIPSIS) {
+		param.Variadic = true
+		p.nextToken()
+	}
 
-	exp.Index = p.parseExpression(LOWEST)
+	switch {
+	case p.currTokenIs(token.IDENT):
+		param.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	case !param.Variadic && (p.currTokenIs(token.LBRACKET) || p.currTokenIs(token.LBRACE)):
+		param.Pattern = p.parsePattern()
+		if param.Pattern == nil {
+			return param
+		}
+	default:
+		msg := fmt.Sprintf("expected parameter name, got %s instead", p.currToken.Type)
+		p.errors = append(p.errors, msg)
+		return param
+	}
 
-	if !p.expectPeek(token.RBRACKET) {
-		return nil
+	if !param.Variadic && p.peekTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		param.Default = p.parseExpression(LOWEST)
 	}
 
-	return exp
+	return param
 }
 
-func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Token: p.currToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+// checkParameterOrder requires parameters with defaults to follow the
+// required ones and a variadic parameter to come last.
+func (p *Parser) checkParameterOrder(params []*ast.Parameter) {
+	seenDefault := false
 
-	for !p.peekTokenIs(token.RBRACE) {
+	for i, param := range params {
+		if param.Name == nil && param.Pattern == nil {
+			continue
+		}
+
+		switch {
+		case param.Variadic && i != len(params)-1:
+			msg := fmt.Sprintf("variadic parameter %s must be the last parameter", param.Name.Value)
+			p.errors = append(p.errors, msg)
+		case param.Default != nil:
+			seenDefault = true
+		case !param.Variadic && seenDefault:
+			msg := fmt.Sprintf("required parameter %s follows a parameter with a default value", param)
+			p.errors = append(p.errors, msg)
+		}
+	}
+}
+
+// parsePattern parses the target of a destructuring binding or match arm:
+// an identifier, the wildcard `_`, a literal, a range `1..=9`, an array
+// pattern `[a, b = 0, ...rest]` or a hash pattern `{name, age: years,
+// ...rest}`. Patterns nest.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currToken.Type {
+	case token.IDENT:
+		if p.currToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.currToken}
+		}
+		if p.peekTokenIs(token.LPAREN) || p.peekTokenIs(token.DOT) {
+			return p.parseVariantPattern()
+		}
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	case token.NUM, token.MINUS, token.STRING, token.TRUE, token.FALSE:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		msg := fmt.Sprintf("expected pattern, got %s instead", p.currToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseVariantPattern() ast.Pattern {
+	pattern := &ast.VariantPattern{Token: p.currToken}
+	pattern.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekTokenIs(token.DOT) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		pattern.Enum = pattern.Name
+		pattern.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return pattern
+	}
+	p.nextToken()
+
+	pattern.Arguments = make([]ast.Pattern, 0)
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+
+		arg := p.parsePattern()
+		if arg == nil {
+			return nil
+		}
+		pattern.Arguments = append(pattern.Arguments, arg)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseLiteralPattern parses a literal pattern, or a range pattern when the
+// literal is a number followed by `..` or `..=`.
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	tok := p.currToken
+
+	var value ast.Expression
+	switch tok.Type {
+	case token.STRING:
+		value = p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		value = p.parseBoolean()
+	default:
+		value = p.parseSignedNumber()
+	}
+	if value == nil {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RANGE) && !p.peekTokenIs(token.RANGE_EQ) {
+		return &ast.LiteralPattern{Token: tok, Value: value}
+	}
+
+	p.nextToken()
+	pattern := &ast.RangePattern{Token: p.currToken, Low: value, Inclusive: p.currTokenIs(token.RANGE_EQ)}
+
+	if tok.Type != token.NUM && tok.Type != token.MINUS {
+		msg := fmt.Sprintf("range pattern bounds must be numbers, got %s", tok.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	p.nextToken()
+	if !p.currTokenIs(token.NUM) && !p.currTokenIs(token.MINUS) {
+		msg := fmt.Sprintf("range pattern bounds must be numbers, got %s", p.currToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	pattern.High = p.parseSignedNumber()
+	if pattern.High == nil {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseSignedNumber parses a number literal with an optional minus sign.
+func (p *Parser) parseSignedNumber() ast.Expression {
+	if !p.currTokenIs(token.MINUS) {
+		return p.parseNumberLiteral()
+	}
+
+	exp := &ast.UnaryExpression{Token: p.currToken, Operator: p.currToken.Literal}
+	if !p.expectPeek(token.NUM) {
+		return nil
+	}
+
+	exp.Right = p.parseNumberLiteral()
+	if exp.Right == nil {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currToken}
+	pattern.Elements = make([]*ast.PatternElement, 0)
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.currTokenIs(token.ELLIPSIS) {
+			pattern.Rest = p.parseRestPattern(token.RBRACKET)
+			if pattern.Rest == nil {
+				return nil
+			}
+			break
+		}
+
+		element := p.parsePatternElement()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currToken}
+	pattern.Pairs = make([]*ast.HashPatternPair, 0)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		if p.currTokenIs(token.ELLIPSIS) {
+			pattern.Rest = p.parseRestPattern(token.RBRACE)
+			if pattern.Rest == nil {
+				return nil
+			}
+			break
+		}
+
+		if !p.currTokenIs(token.IDENT) && !p.currTokenIs(token.STRING) {
+			msg := fmt.Sprintf("expected hash pattern key, got %s instead", p.currToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+
+		pair := &ast.HashPatternPair{Token: p.currToken, Key: p.currToken.Literal}
+
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			pair.Value = p.parsePatternElement()
+			if pair.Value == nil {
+				return nil
+			}
+		} else {
+			if p.currTokenIs(token.STRING) {
+				msg := fmt.Sprintf("expected next token to be %s, got %s instead", token.COLON, p.peekToken.Type)
+				p.errors = append(p.errors, msg)
+				return nil
+			}
+
+			pair.Value = &ast.PatternElement{Pattern: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+			pair.Value.Default = p.parsePatternDefault()
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+func (p *Parser) parsePatternElement() *ast.PatternElement {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+
+	return &ast.PatternElement{Pattern: pattern, Default: p.parsePatternDefault()}
+}
+
+func (p *Parser) parsePatternDefault() ast.Expression {
+	if !p.peekTokenIs(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	p.nextToken()
+
+	return p.parseExpression(LOWEST)
+}
+
+// parseRestPattern parses `...name`, which must be the last element of the
+// pattern closed by end.
+func (p *Parser) parseRestPattern(end token.TokenType) *ast.Identifier {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	rest := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.peekTokenIs(end) {
+		msg := fmt.Sprintf("rest element %s must be the last element of a pattern", rest.Value)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return rest
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Arms = make([]*ast.MatchArm, 0)
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		// Arms are separated by commas, which are optional after a block.
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(token.RBRACE) && arm.Body.Token.Type != token.LBRACE {
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.currToken}
+
+	arm.Pattern = p.parsePattern()
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	arm.Body = p.parseBody()
+
+	return arm
+}
+
+func (p *Parser) parseThrowExpression() ast.Expression {
+	exp := &ast.ThrowExpression{Token: p.currToken}
+
+	p.nextToken()
+
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			p.nextToken()
+
+			exp.Param = p.parsePattern()
+			if exp.Param == nil {
+				return nil
+			}
+
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		p.errors = append(p.errors, "try expression needs a catch or finally block")
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.currToken, Function: function}
+	exp.Arguments = p.parseCallArguments()
+	return exp
+}
+
+// parseCallArguments parses an argument list in which positional arguments
+// may be followed by named arguments such as `eps: 0.001`.
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := make([]ast.Expression, 0)
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	seenNamed := false
+	for {
+		p.nextToken()
+
+		var arg ast.Expression
+		if p.currTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			named := &ast.NamedArgument{Token: p.currToken}
+			named.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			p.nextToken()
+			p.nextToken()
+			named.Value = p.parseExpression(LOWEST)
+
+			arg = named
+			seenNamed = true
+		} else {
+			arg = p.parseExpression(LOWEST)
+			if seenNamed {
+				p.errors = append(p.errors, "positional argument follows named argument")
+			}
+		}
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return args
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	exp := &ast.SpreadExpression{Token: p.currToken}
+
+	p.nextToken()
+
+	exp.Value = p.parseExpression(UNARY)
+
+	return exp
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+
+	return array
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := make([]ast.Expression, 0)
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+
+	p.nextToken()
+
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.currToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	return exp
+}
+
+// parseAssignExpression parses an assignment, which is right associative so
+// that `a = b = 0` assigns 0 to both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.currToken, Target: target}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.MemberExpression:
+	default:
+		msg := fmt.Sprintf("invalid assignment target %s", target)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
+func (p *Parser) parseWithExpression(left ast.Expression) ast.Expression {
+	exp := &ast.WithExpression{Token: p.currToken, Left: left}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Fields = make([]*ast.FieldValue, 0)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.FieldValue{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		field.Value = p.parseExpression(LOWEST)
+		exp.Fields = append(exp.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
@@ -399,6 +1342,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -438,18 +1382,28 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
+// peekWordIs reports whether the next token is the identifier word, for
+// words that are only keywords in some positions.
+func (p *Parser) peekWordIs(word string) bool {
+	return p.peekTokenIs(token.IDENT) && p.peekToken.Literal == word
+}
+
+func (p *Parser) expectPeekWord(word string) bool {
+	if p.peekWordIs(word) {
+		p.nextToken()
+		return true
 	}
-	return LOWEST
+	msg := fmt.Sprintf("expected next token to be %s, got %s instead", word, p.peekToken.Literal)
+	p.errors = append(p.errors, msg)
+	return false
+}
+
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) currPrecedence() int {
-	if p, ok := precedences[p.currToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.currToken.Type)
 }
 
 func (p *Parser) Errors() []string {
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/darwin1224/saphire/ast"
@@ -560,8 +561,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].Name, "x")
+	testLiteralExpression(t, function.Parameters[1].Name, "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
@@ -598,7 +599,7 @@ func TestFunctionParameterParsing(t *testing.T) {
 		}
 
 		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+			testLiteralExpression(t, function.Parameters[i].Name, ident)
 		}
 	}
 }
@@ -803,3 +804,707 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestDefaultAndVariadicParameterParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x, eps = 0.001) {}", "fn(x, eps = 0.001) "},
+		{"fn(first, ...rest) {}", "fn(first, ...rest) "},
+		{"fn(a, b = a * 2, ...more) {}", "fn(a, b = (a * 2), ...more) "},
+		{"fn(...all) {}", "fn(...all) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if function.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, function.String())
+		}
+	}
+
+	last := func(input string) *ast.Parameter {
+		program := New(lexer.New(input)).ParseProgram()
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		return function.Parameters[len(function.Parameters)-1]
+	}
+
+	if param := last("fn(x, ...rest) {}"); !param.Variadic || param.Name.Value != "rest" {
+		t.Errorf("last parameter is not variadic rest. got=%+v", param)
+	}
+	if param := last("fn(x, eps = y) {}"); param.Default == nil || !testIdentifier(t, param.Default, "y") {
+		t.Errorf("last parameter has wrong default. got=%+v", param)
+	}
+}
+
+func TestCallArgumentParsing(t *testing.T) {
+	input := "solve(f, ...guesses, eps: 1e-9, steps: 10);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 4 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+
+	testIdentifier(t, call.Arguments[0], "f")
+
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 is not ast.SpreadExpression. got=%T", call.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "guesses")
+
+	named, ok := call.Arguments[2].(*ast.NamedArgument)
+	if !ok {
+		t.Fatalf("argument 2 is not ast.NamedArgument. got=%T", call.Arguments[2])
+	}
+	if named.Name.Value != "eps" {
+		t.Errorf("named argument has wrong name. got=%q", named.Name.Value)
+	}
+	if number, ok := named.Value.(*ast.NumberLiteral); !ok || number.Value != 1e-9 {
+		t.Errorf("named argument has wrong value. got=%s", named.Value)
+	}
+
+	if call.String() != "solve(f, ...guesses, eps: 1e-9, steps: 10)" {
+		t.Errorf("call.String() wrong. got=%q", call.String())
+	}
+}
+
+func TestParameterAndArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(...rest, x) {}", "variadic parameter rest must be the last parameter"},
+		{"fn(x = 1, y) {}", "required parameter y follows a parameter with a default value"},
+		{"fn(1) {}", "expected parameter name, got NUM instead"},
+		{"f(x: 1, 2)", "positional argument follows named argument"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	input := `fn add(x, y) { x + y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "add" || stmt.Function.Name != "add" {
+		t.Errorf("function name wrong. got=%q, %q", stmt.Name.Value, stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function has wrong parameters. got=%d", len(stmt.Function.Parameters))
+	}
+	if stmt.String() != "fn add(x, y) (x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestLambdaParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expected       string
+	}{
+		{"|x| x * 2", []string{"x"}, "|x| (x * 2)"},
+		{"|a, b| a + b", []string{"a", "b"}, "|a, b| (a + b)"},
+		{"|| 42", []string{}, "|| 42"},
+		{"|x| { let y = x; y }", []string{"x"}, "|x| let y = x;y"},
+		{"map(xs, |x| x + 1)", nil, "map(xs, |x| (x + 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if exp.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, exp.String())
+		}
+
+		if tt.expectedParams == nil {
+			continue
+		}
+
+		lambda, ok := exp.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.FunctionLiteral. got=%T", exp)
+		}
+		if len(lambda.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(lambda.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, lambda.Parameters[i].Name, ident)
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = xs;", "let [a, b, ...rest] = xs;"},
+		{"let {name, age: years} = person;", "let {name, age: years} = person;"},
+		{"let [[x, y], {z = 1}] = pair;", "let [[x, y], {z = 1}] = pair;"},
+		{`let {"first name": first, ...others} = h;`, `let {"first name": first, ...others} = h;`},
+		{"let [a = 1, b = a + 1] = [];", "let [a = 1, b = (a + 1)] = [];"},
+		{"fn([a, b], {scale = 2}) { a }", "fn([a, b], {scale = 2}) a"},
+		{"fn(point = [0, 0]) { point }", "fn(point = [0, 0]) point"},
+		{"|[k, v]| k", "|[k, v]| k"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("let [a, b] = xs;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	if stmt.Name != nil {
+		t.Errorf("stmt.Name is not nil. got=%+v", stmt.Name)
+	}
+	pattern, ok := stmt.Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("stmt.Pattern is not ast.ArrayPattern. got=%T", stmt.Pattern)
+	}
+	if len(pattern.Elements) != 2 {
+		t.Fatalf("pattern has wrong number of elements. got=%d", len(pattern.Elements))
+	}
+	testIdentifier(t, pattern.Elements[0].Pattern.(*ast.Identifier), "a")
+	testIdentifier(t, pattern.Elements[1].Pattern.(*ast.Identifier), "b")
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, ...rest, b] = xs;", "rest element rest must be the last element of a pattern"},
+		{"let [fn] = xs;", "expected pattern, got FUNCTION instead"},
+		{"let {1: a} = h;", "expected hash pattern key, got NUM instead"},
+		{`let {"a"} = h;`, "expected next token to be :, got } instead"},
+		{"fn(...[a]) {}", "expected parameter name, got [ instead"},
+		{"fn([a] = [1], b) {}", "required parameter b follows a parameter with a default value"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) {
+	0 => "zero",
+	-5..=-1 => "negative",
+	[a, _] if a > 0 => { a },
+	{kind: "circle", r} => r,
+	_ => false,
+}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, exp.Subject, "x")
+
+	expectedArms := []string{
+		`0 => zero`,
+		`-5..=-1 => negative`,
+		`[a, _] if (a > 0) => a`,
+		`{kind: "circle", r} => r`,
+		`_ => false`,
+	}
+	if len(exp.Arms) != len(expectedArms) {
+		t.Fatalf("exp.Arms does not contain %d arms. got=%d", len(expectedArms), len(exp.Arms))
+	}
+	for i, expected := range expectedArms {
+		if exp.Arms[i].String() != expected {
+			t.Errorf("arms[%d] wrong. expected=%q, got=%q", i, expected, exp.Arms[i].String())
+		}
+	}
+
+	if _, ok := exp.Arms[1].Pattern.(*ast.RangePattern); !ok {
+		t.Errorf("arms[1].Pattern is not ast.RangePattern. got=%T", exp.Arms[1].Pattern)
+	}
+	if _, ok := exp.Arms[4].Pattern.(*ast.WildcardPattern); !ok {
+		t.Errorf("arms[4].Pattern is not ast.WildcardPattern. got=%T", exp.Arms[4].Pattern)
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { "a".."z" => 1 }`, "range pattern bounds must be numbers, got STRING"},
+		{`match (x) { 1..y => 1 }`, "range pattern bounds must be numbers, got IDENT"},
+		{`match (x) { 1 => 1 2 => 2 }`, "expected next token to be ,, got NUM instead"},
+		{`match (x) { 1 -> 1 }`, "expected next token to be =>, got - instead"},
+		{`match x { 1 => 1 }`, "expected next token to be (, got IDENT instead"},
+		{`match (x) { 1 => {"a": 1} 2 => 2 }`, "expected next token to be ,, got NUM instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+// TestBodyHashLiterals checks that lambda and match arm bodies starting
+// with a brace are hash literals when they parse as one.
+func TestBodyHashLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		hash  bool
+	}{
+		{`match (x) { _ => {"k": 1} }`, true},
+		{`match (x) { 1 => {k: x}, _ => 2 }`, true},
+		{`match (x) { _ => {"k": 1}["k"] }`, false},
+		{`match (x) { _ => { x } }`, false},
+		{`match (x) { _ => {} }`, false},
+		{`|x| {"k": x}`, true},
+		{`|x| {1: x, true: x}`, true},
+		{`|x| { let y = x; y }`, false},
+		{`|x| { x }`, false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var body *ast.BlockStatement
+		switch exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.MatchExpression:
+			body = exp.Arms[0].Body
+		case *ast.FunctionLiteral:
+			body = exp.Body
+		}
+
+		var hash bool
+		if len(body.Statements) == 1 {
+			if stmt, ok := body.Statements[0].(*ast.ExpressionStatement); ok {
+				_, hash = stmt.Expression.(*ast.HashLiteral)
+			}
+		}
+		if hash != tt.hash {
+			t.Errorf("wrong body for %q. hash=%t, got %q", tt.input, tt.hash, body)
+		}
+		if hash && body.TokenLiteral() == "{" {
+			t.Errorf("body of %q has the token of a block", tt.input)
+		}
+	}
+}
+
+// TestNestedBodies checks that bodies in braces nested deeply parse in time
+// linear in their depth.
+func TestNestedBodies(t *testing.T) {
+	const depth = 64
+	input := strings.Repeat("|x| { f(", depth) + "x" + strings.Repeat(") }", depth)
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if got := strings.Count(program.String(), "|x|"); got != depth {
+		t.Errorf("wrong number of nested lambdas. expected=%d, got=%d", depth, got)
+	}
+}
+
+func TestTryAndThrowParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "bad"`, "throw bad"},
+		{"try { f() } catch (e) { 0 }", "try f() catch (e) 0"},
+		{"try { f() } catch { 0 } finally { g() }", "try f() catch 0 finally g()"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"try { f() } catch ({message}) { message }", "try f() catch ({message}) message"},
+		{"let x = try { f() } catch (e) { throw e };", "let x = try f() catch (e) throw e;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("try { f() }"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "try expression needs a catch or finally block" {
+		t.Errorf("wrong parser errors. got=%q", errors)
+	}
+}
+
+func TestImportAndExportParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/geometry.sp" as geo`, `import "lib/geometry.sp" as geo;`},
+		{`import "setup.sp";`, `import "setup.sp";`},
+		{`import { area, pi as PI } from "lib/geometry"`, `import { area, pi as PI } from "lib/geometry";`},
+		{`export let pi = 3.14;`, `export let pi = 3.14;`},
+		{`export let [a, b] = pair;`, `export let [a, b] = pair;`},
+		{`export fn area(r) { r }`, `export fn area(r) r`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`import { a as b } from "m.sp"`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Path.Value != "m.sp" || stmt.Alias != nil || len(stmt.Names) != 1 {
+		t.Fatalf("import statement wrong. got=%+v", stmt)
+	}
+	testIdentifier(t, stmt.Names[0].Name, "a")
+	testIdentifier(t, stmt.Names[0].Alias, "b")
+}
+
+func TestImportAndExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import geometry`, "expected next token to be STRING, got IDENT instead"},
+		{`import { a } "m.sp"`, "expected next token to be from, got m.sp instead"},
+		{`import { a, 1 } from "m.sp"`, "expected next token to be IDENT, got NUM instead"},
+		{`import "m.sp" as 1`, "expected next token to be IDENT, got NUM instead"},
+		{`export 1`, "expected declaration after export, got NUM instead"},
+		{`export fn(x) { x }`, "expected declaration after export, got FUNCTION instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"person.name", "(person.name)"},
+		{"math.sqrt(16)", "(math.sqrt)(16)"},
+		{"xs.map(f).filter(g)", "((xs.map)(f).filter)(g)"},
+		{"a.b.c", "((a.b).c)"},
+		{"a.b[0]", "((a.b)[0])"},
+		{"-p.x", "(-(p.x))"},
+		{"p.x * 2", "((p.x) * 2)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("person.1"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "expected next token to be IDENT, got NUM instead" {
+		t.Errorf("wrong parser errors. got=%q", errors)
+	}
+}
+
+func TestStructParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Point { x, y, };", "struct Point { x, y }"},
+		{"struct Unit {}", "struct Unit {}"},
+		{"export struct Point { x, y }", "export struct Point { x, y }"},
+		{"p with { x: 3 }", "(p with { x: 3 })"},
+		{"p with { x: p.x + 1, y: 0 }.x", "((p with { x: ((p.x) + 1), y: 0 }).x)"},
+		{"p with { x: 1 } == q", "((p with { x: 1 }) == q)"},
+		{"-p with { x: 1 }", "(-(p with { x: 1 }))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestStructParsingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+		{"struct Point { x, 1 }", "expected next token to be IDENT, got NUM instead"},
+		{"struct Point { x, x }", "duplicate field x in struct Point"},
+		{`p with { "x": 1 }`, "expected next token to be IDENT, got STRING instead"},
+		{"p with x", "expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestEnumParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }", "enum Shape { Circle(r), Rect(w, h), Empty }"},
+		{"enum Result { Ok(value), Err(error), };", "enum Result { Ok(value), Err(error) }"},
+		{"enum Never {}", "enum Never {}"},
+		{"export enum Unit { Unit }", "export enum Unit { Unit }"},
+		{"match (s) { Circle(r) => r, Shape.Rect(w, _) => w, Shape.Empty => 0 }", "match (s) { Circle(r) => r, Shape.Rect(w, _) => w, Shape.Empty => 0 }"},
+		{"match (r) { Ok([a, b]) => a, Err(Some(e)) if e => e, Empty() => 0 }", "match (r) { Ok([a, b]) => a, Err(Some(e)) if e => e, Empty() => 0 }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestEnumParsingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum { A }", "expected next token to be IDENT, got { instead"},
+		{"enum Shape { Circle(1) }", "expected next token to be IDENT, got NUM instead"},
+		{"enum Shape { A, A }", "duplicate variant A in enum Shape"},
+		{"enum Shape { Rect(w, w) }", "duplicate field w in variant Rect"},
+		{"match (s) { Shape.1 => 0 }", "expected next token to be IDENT, got NUM instead"},
+		{"match (s) { Circle(r => 0 }", "expected next token to be ,, got => instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "(x = 1)"},
+		{"x = y = 2 + 3", "(x = (y = (2 + 3)))"},
+		{"xs[0] = x == 1", "((xs[0]) = (x == 1))"},
+		{"self.balance = self.balance + x", "((self.balance) = ((self.balance) + x))"},
+		{"let f = fn(x, eps = 0.1) { x = eps }", "let f = fn(x, eps = 0.1) (x = eps);"},
+		{"let {a, b = 2} = h;", "let {a, b = 2} = h;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "invalid assignment target 1"},
+		{"f() = 1", "invalid assignment target f()"},
+		{"x + y = 1", "invalid assignment target (x + y)"},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestClassParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"class Account { init(b) { self.balance = b } deposit(x) { self.balance = self.balance + x; } }",
+			"class Account { init(b) ((self.balance) = b), deposit(x) ((self.balance) = ((self.balance) + x)) }",
+		},
+		{"class Empty {}", "class Empty {}"},
+		{"class Savings extends Account { rate() { 0.5 } }", "class Savings extends Account { rate() 0.5 }"},
+		{"class Square extends geo.Shape {}", "class Square extends (geo.Shape) {}"},
+		{"export class Empty {}", "export class Empty {}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestClassParsingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"class { }", "expected next token to be IDENT, got { instead"},
+		{"class A { 1 }", "expected next token to be IDENT, got NUM instead"},
+		{"class A { f { 1 } }", "expected next token to be (, got { instead"},
+		{"class A { f() { 1 } f() { 2 } }", "duplicate method f in class A"},
+		{"class A extends { }", "expected next token to be {, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestConstParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1;", "const x = 1;"},
+		{"const [a, b] = pair", "const [a, b] = pair;"},
+		{"export const config = {};", "export const config = {};"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
@@ -5,6 +5,7 @@ import "github.com/darwin1224/saphire/token"
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
 	EQUALS
 	LESSGREATER
 	SUM
@@ -15,6 +16,7 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:   ASSIGN,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
@@ -28,5 +30,16 @@ var precedences = map[token.TokenType]int{
 	token.ASTERISK: PRODUCT,
 	token.POWER:    PRODUCT,
 	token.LPAREN:   CALL,
+	token.WITH:     CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// Precedence returns the precedence of the binary operator t, or LOWEST if
+// t is not one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
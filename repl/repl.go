@@ -2,31 +2,60 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/compiler"
 	"github.com/darwin1224/saphire/interpreter"
 	"github.com/darwin1224/saphire/lexer"
 	"github.com/darwin1224/saphire/object"
 	"github.com/darwin1224/saphire/parser"
+	"github.com/darwin1224/saphire/vm"
 )
 
 const (
 	Prompt = ">>"
 )
 
+// Start reads lines from in and prints their results to out, evaluating
+// them with the interpreter. Calls to `input` read the lines that follow.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	reader := bufio.NewReader(in)
+	interp := interpreter.New(interpreter.WithStdin(reader), interpreter.WithStdout(out))
+	start(reader, out, func(program *ast.Program, env *object.Environment) object.Object {
+		return interp.Eval(context.Background(), program, env)
+	})
+}
+
+// StartVM is like Start, but compiles each line and runs it on the VM.
+func StartVM(in io.Reader, out io.Writer) {
+	reader := bufio.NewReader(in)
+	machine := vm.New(interpreter.New(interpreter.WithStdin(reader), interpreter.WithStdout(out)))
+	start(reader, out, func(program *ast.Program, env *object.Environment) object.Object {
+		bc, err := compiler.Compile(program)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return machine.Run(context.Background(), bc, env)
+	})
+}
+
+// start reads the lines to evaluate from in, which `input` shares, so that
+// no lines are read ahead of the ones it is given.
+func start(in *bufio.Reader, out io.Writer, eval func(*ast.Program, *object.Environment) object.Object) {
 	env := object.NewEnvironment()
 
 	for {
-		fmt.Printf(Prompt)
-		scanned := scanner.Scan()
-		if !scanned {
+		fmt.Fprint(out, Prompt)
+		line, err := in.ReadString('\n')
+		if line == "" && err != nil {
 			return
 		}
 
-		line := scanner.Text()
+		line = strings.TrimRight(line, "\r\n")
 		lexer := lexer.New(line)
 		parser := parser.New(lexer)
 
@@ -36,11 +65,17 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		result := interpreter.Eval(program, env)
+		result := eval(program, env)
 		if result != nil {
 			io.WriteString(out, result.Inspect())
 			io.WriteString(out, "\n")
 		}
+
+		if errObj, ok := result.(*object.Error); ok {
+			for _, line := range errObj.Trace {
+				io.WriteString(out, "\t"+line+"\n")
+			}
+		}
 	}
 }
 
@@ -0,0 +1,22 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStartInput(t *testing.T) {
+	starts := map[string]func(io.Reader, io.Writer){"tree": Start, "vm": StartVM}
+
+	for name, start := range starts {
+		var out bytes.Buffer
+		start(strings.NewReader("let name = input(\"name? \")\nAda\n\"hi \" + name\n"), &out)
+
+		expected := ">>name? >>hi Ada\n>>"
+		if got := out.String(); got != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Package resolver binds the identifiers of a program to the variables they
+// refer to before the program runs.
+//
+// Every scope of the interpreter other than the global one, that is every
+// function body, `if` branch, match arm and `try`, `catch` or `finally`
+// block, gets a fixed layout of slots, one per name declared in it. An
+// identifier that refers to a local variable is resolved to an ast.Location:
+// how many environments out from the one it is evaluated in the variable
+// lives, and in which slot. Resolve records locations and layouts on the
+// nodes of the program, so they last as long as the program does. Globals stay in named environments, since the host,
+// the REPL and imports can define them at any time.
+//
+// Function bodies are resolved at the end of the enclosing function or
+// program, so that they can refer to names declared after them.
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+)
+
+// Diagnostic is a problem found in a program before it runs. Warnings do not
+// prevent a program from running.
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+	Warning bool
+}
+
+func (d Diagnostic) String() string {
+	if d.Warning {
+		return fmt.Sprintf("warning: line %d: %s", d.Line, d.Message)
+	}
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+// Result holds the problems found in a resolved program.
+type Result struct {
+	// Diagnostics reports undefined variables and unused local variables,
+	// in source order.
+	Diagnostics []Diagnostic
+}
+
+// Errors returns the diagnostics of r that are not warnings, formatted
+// with String.
+func (r *Result) Errors() []string {
+	var errs []string
+	for _, d := range r.Diagnostics {
+		if !d.Warning {
+			errs = append(errs, d.String())
+		}
+	}
+	return errs
+}
+
+var (
+	selfScope  = ast.NewScope([]string{"self"})
+	superScope = ast.NewScope([]string{"self", "super"})
+)
+
+// MethodScope returns the layout of the scope binding `self`, and `super`
+// if the class of the method extends another, around the body of a bound
+// method.
+func MethodScope(super bool) *ast.Scope {
+	if super {
+		return superScope
+	}
+	return selfScope
+}
+
+// Resolve resolves the identifiers of program, setting Local on those that
+// refer to local variables and Scope on the block of each local scope: the
+// body of a function, including its parameters, an `if` branch, a match
+// arm, including the names bound by its pattern, and the blocks of `try`,
+// `catch`, including its parameter, and `finally`. The top level of program
+// is its global scope; defined reports whether a name is defined there, or
+// as a builtin, before the program runs.
+func Resolve(program *ast.Program, defined func(name string) bool) *Result {
+	r := &resolver{
+		defined: defined,
+		result:  &Result{},
+	}
+
+	global := r.push(true)
+	global.global = true
+	r.statements(program.Statements)
+	r.drain(global)
+	r.pop()
+
+	for _, b := range r.bindings {
+		if b.check && !b.used && !strings.HasPrefix(b.ident.Value, "_") {
+			r.warn(b.ident, "unused variable `%s`", b.ident.Value)
+		}
+	}
+
+	sort.SliceStable(r.result.Diagnostics, func(i, j int) bool {
+		a, b := r.result.Diagnostics[i], r.result.Diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return r.result
+}
+
+type resolver struct {
+	defined  func(name string) bool
+	result   *Result
+	scopes   []*scope
+	bindings []*binding
+}
+
+type scope struct {
+	names    map[string]*binding
+	slots    []string
+	global   bool
+	function bool
+	// pending holds the functions defined in a function or program scope,
+	// resolved once all of its names are declared.
+	pending []pending
+}
+
+type binding struct {
+	ident *ast.Identifier
+	slot  int
+	used  bool
+	// check marks local variables reported if they are never read.
+	check bool
+}
+
+type pending struct {
+	fn     *ast.FunctionLiteral
+	scopes []*scope
+	method bool
+	super  bool
+}
+
+func (r *resolver) push(function bool) *scope {
+	s := &scope{names: make(map[string]*binding), function: function}
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+func (r *resolver) pop() *scope {
+	s := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return s
+}
+
+// block resolves the statements of block in a scope of its own.
+func (r *resolver) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	r.push(false)
+	r.statements(block.Statements)
+	r.close(block)
+}
+
+// close ends the innermost scope, recording its layout for block.
+func (r *resolver) close(block *ast.BlockStatement) {
+	s := r.pop()
+	block.Scope = ast.NewScope(s.slots)
+}
+
+// declare binds ident in the innermost scope. A name declared again in the
+// same scope keeps its slot.
+func (r *resolver) declare(ident *ast.Identifier, check bool) {
+	s := r.scopes[len(r.scopes)-1]
+
+	b := &binding{ident: ident, check: check && !s.global}
+	if prev, ok := s.names[ident.Value]; ok {
+		b.slot = prev.slot
+	} else {
+		b.slot = len(s.slots)
+		s.slots = append(s.slots, ident.Value)
+	}
+
+	s.names[ident.Value] = b
+	r.bindings = append(r.bindings, b)
+}
+
+// lookup resolves ident to the innermost binding of its name. Only reads
+// count as uses of a variable.
+func (r *resolver) lookup(ident *ast.Identifier, read bool) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		b, ok := s.names[ident.Value]
+		if !ok {
+			continue
+		}
+
+		if read {
+			b.used = true
+		}
+		if s.global {
+			ident.Local = nil
+		} else {
+			ident.Local = &ast.Location{Depth: len(r.scopes) - 1 - i, Slot: b.slot}
+		}
+		return
+	}
+
+	ident.Local = nil
+	if r.defined == nil || !r.defined(ident.Value) {
+		r.error(ident, "undefined variable `%s`", ident.Value)
+	}
+}
+
+func (r *resolver) error(ident *ast.Identifier, format string, a ...interface{}) {
+	r.result.Diagnostics = append(r.result.Diagnostics, Diagnostic{
+		Line:    ident.Token.Line,
+		Column:  ident.Token.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (r *resolver) warn(ident *ast.Identifier, format string, a ...interface{}) {
+	r.error(ident, format, a...)
+	r.result.Diagnostics[len(r.result.Diagnostics)-1].Warning = true
+}
+
+// later queues fn to be resolved at the end of the innermost function or
+// program scope, with the scopes visible where it is defined.
+func (r *resolver) later(p pending) {
+	p.scopes = append([]*scope(nil), r.scopes...)
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if r.scopes[i].function {
+			r.scopes[i].pending = append(r.scopes[i].pending, p)
+			return
+		}
+	}
+}
+
+// drain resolves the functions pending in s.
+func (r *resolver) drain(s *scope) {
+	for len(s.pending) > 0 {
+		p := s.pending[0]
+		s.pending = s.pending[1:]
+
+		saved := r.scopes
+		r.scopes = p.scopes
+		r.function(p)
+		r.scopes = saved
+	}
+}
+
+// function resolves the parameters and body of a function. Methods are
+// resolved inside the scope binding `self` and `super`.
+func (r *resolver) function(p pending) {
+	if p.method {
+		r.push(false)
+		for _, name := range MethodScope(p.super).Names {
+			r.declare(&ast.Identifier{Value: name}, false)
+		}
+	}
+
+	s := r.push(true)
+	for _, param := range p.fn.Parameters {
+		if param.Default != nil {
+			r.expression(param.Default)
+		}
+		if param.Pattern != nil {
+			r.pattern(param.Pattern, false)
+		} else {
+			r.declare(param.Name, false)
+		}
+	}
+	r.statements(p.fn.Body.Statements)
+	r.close(p.fn.Body)
+	r.drain(s)
+
+	if p.method {
+		r.pop()
+	}
+}
+
+func (r *resolver) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+	case *ast.BlockStatement:
+		r.statements(stmt.Statements)
+	case *ast.LetStatement:
+		r.expression(stmt.Value)
+		if stmt.Pattern != nil {
+			r.pattern(stmt.Pattern, true)
+		} else {
+			r.declare(stmt.Name, true)
+		}
+	case *ast.FunctionStatement:
+		r.declare(stmt.Name, true)
+		r.expression(stmt.Function)
+	case *ast.StructStatement:
+		r.declare(stmt.Name, false)
+	case *ast.EnumStatement:
+		r.declare(stmt.Name, false)
+		for _, variant := range stmt.Variants {
+			r.declare(variant.Name, false)
+		}
+	case *ast.ClassStatement:
+		if stmt.Superclass != nil {
+			r.expression(stmt.Superclass)
+		}
+		for _, method := range stmt.Methods {
+			r.later(pending{fn: method, method: true, super: stmt.Superclass != nil})
+		}
+		r.declare(stmt.Name, false)
+	case *ast.ImportStatement:
+		if stmt.Alias != nil {
+			r.declare(stmt.Alias, false)
+		}
+		for _, name := range stmt.Names {
+			if name.Alias != nil {
+				r.declare(name.Alias, false)
+			} else {
+				r.declare(name.Name, false)
+			}
+		}
+	case *ast.ExportStatement:
+		r.statement(stmt.Statement)
+	}
+}
+
+func (r *resolver) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.lookup(exp, true)
+	case *ast.UnaryExpression:
+		r.expression(exp.Right)
+	case *ast.BinaryExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Right)
+	case *ast.IfExpression:
+		r.expression(exp.Condition)
+		r.block(exp.Consequence)
+		r.block(exp.Alternative)
+	case *ast.FunctionLiteral:
+		r.later(pending{fn: exp})
+	case *ast.CallExpression:
+		r.expression(exp.Function)
+		r.expressions(exp.Arguments)
+	case *ast.SpreadExpression:
+		r.expression(exp.Value)
+	case *ast.NamedArgument:
+		r.expression(exp.Value)
+	case *ast.ArrayLiteral:
+		r.expressions(exp.Elements)
+	case *ast.HashLiteral:
+		for key, value := range exp.Pairs {
+			r.expression(key)
+			r.expression(value)
+		}
+	case *ast.IndexExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Index)
+	case *ast.MemberExpression:
+		r.expression(exp.Object)
+	case *ast.WithExpression:
+		r.expression(exp.Left)
+		for _, field := range exp.Fields {
+			r.expression(field.Value)
+		}
+	case *ast.AssignExpression:
+		r.expression(exp.Value)
+		if ident, ok := exp.Target.(*ast.Identifier); ok {
+			r.lookup(ident, false)
+		} else {
+			r.expression(exp.Target)
+		}
+	case *ast.MatchExpression:
+		r.expression(exp.Subject)
+		for _, arm := range exp.Arms {
+			r.push(false)
+			r.pattern(arm.Pattern, false)
+			if arm.Guard != nil {
+				r.expression(arm.Guard)
+			}
+			r.statements(arm.Body.Statements)
+			r.close(arm.Body)
+		}
+	case *ast.ThrowExpression:
+		r.expression(exp.Value)
+	case *ast.TryExpression:
+		r.block(exp.Block)
+		if exp.Catch != nil {
+			r.push(false)
+			if exp.Param != nil {
+				r.pattern(exp.Param, false)
+			}
+			r.statements(exp.Catch.Statements)
+			r.close(exp.Catch)
+		}
+		r.block(exp.Finally)
+	}
+}
+
+func (r *resolver) expressions(exps []ast.Expression) {
+	for _, exp := range exps {
+		r.expression(exp)
+	}
+}
+
+// pattern declares the names bound by pattern in the innermost scope and
+// resolves the expressions it contains, in the order they are evaluated.
+func (r *resolver) pattern(pattern ast.Pattern, check bool) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		r.declare(pattern, check)
+	case *ast.LiteralPattern:
+		r.expression(pattern.Value)
+	case *ast.RangePattern:
+		r.expression(pattern.Low)
+		r.expression(pattern.High)
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			r.element(el, check)
+		}
+		if pattern.Rest != nil {
+			r.declare(pattern.Rest, check)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			r.element(pair.Value, check)
+		}
+		if pattern.Rest != nil {
+			r.declare(pattern.Rest, check)
+		}
+	case *ast.VariantPattern:
+		if pattern.Enum != nil {
+			r.lookup(pattern.Enum, true)
+		} else {
+			r.lookup(pattern.Name, true)
+		}
+		for _, arg := range pattern.Arguments {
+			r.pattern(arg, check)
+		}
+	}
+}
+
+func (r *resolver) element(el *ast.PatternElement, check bool) {
+	if el.Default != nil {
+		r.expression(el.Default)
+	}
+	r.pattern(el.Pattern, check)
+}
@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// locations returns the locations of the identifiers of program resolved
+// to local variables, as "name@depth:slot" in source order.
+func locations(program *ast.Program) []string {
+	var all []*ast.Identifier
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Local != nil {
+			all = append(all, ident)
+		}
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i].Token, all[j].Token
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	var out []string
+	for _, ident := range all {
+		out = append(out, fmt.Sprintf("%s@%d:%d", ident.Value, ident.Local.Depth, ident.Local.Slot))
+	}
+	return out
+}
+
+func TestResolveLocations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let g = 1; fn(a, b) { a + b + g }", "a@0:0 b@0:1"},
+		{"fn(a) { let b = a; if (b) { let c = b; a + c } }", "a@0:0 b@0:1 b@1:1 a@1:0 c@0:0"},
+		{"fn(a) { fn() { fn() { a } } }", "a@2:0"},
+		{"fn() { let f = fn() { g() }; let g = fn() { 1 }; f }", "g@1:1 f@0:0"},
+		{"fn(x) { if (true) { let y = x; let x = 2; x + y } }", "x@1:0 x@0:1 y@0:0"},
+		{"fn(x) { let x = x + 1; x }", "x@0:0 x@0:0"},
+		{"fn(xs) { match (xs) { [h, ...t] if h > 0 => t, n => n } }", "xs@0:0 h@0:0 t@0:1 n@0:0"},
+		{"fn() { try { let a = 1; a } catch (e) { e } finally { 0 } }", "a@0:0 e@0:0"},
+		{"class A { get() { self.x } } class B extends A { get() { super.get() + self.y } }", "self@1:0 super@1:1 self@1:0"},
+		{"fn(a, b = a) { b }", "a@0:0 b@0:1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		Resolve(program, nil)
+
+		got := strings.Join(locations(program), " ")
+		if got != tt.expected {
+			t.Errorf("wrong locations for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestResolveScopes(t *testing.T) {
+	program := parse(t, "fn(a, [b, ...c]) { let d = 1; let a = 2; if (d) { let e = 3; e } }")
+
+	Resolve(program, nil)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+	scope := fn.Body.Scope
+	if scope == nil {
+		t.Fatalf("no scope for the function body")
+	}
+	if got := strings.Join(scope.Names, ","); got != "a,b,c,d" {
+		t.Errorf("wrong function scope. expected=%q, got=%q", "a,b,c,d", got)
+	}
+
+	ie := fn.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if got := strings.Join(ie.Consequence.Scope.Names, ","); got != "e" {
+		t.Errorf("wrong if scope. expected=%q, got=%q", "e", got)
+	}
+}
+
+func TestResolveDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x + y", []string{"line 1: undefined variable `y`"}},
+		{"y = 1", []string{"line 1: undefined variable `y`"}},
+		{"print(len([]))", nil},
+		{"let f = fn() { g() }; let g = fn() { f() };", nil},
+		{"x; let x = 1;", []string{"line 1: undefined variable `x`"}},
+		{"fn() { let unused = 1; let _ignored = 2; 0 }", []string{"warning: line 1: unused variable `unused`"}},
+		{"let top = 1; fn(param) { let [a, b] = [1, 2]; a }", []string{"warning: line 1: unused variable `b`"}},
+		{"fn() { let x = 1; x = 2; }", []string{"warning: line 1: unused variable `x`"}},
+		{"fn() { let x = 1; fn() { x } }", nil},
+		{"fn() { self }", []string{"line 1: undefined variable `self`"}},
+		{"class A { m() { super.m() } }", []string{"line 1: undefined variable `super`"}},
+		{"enum E { A(x), B } fn(e) { match (e) { E.A(x) => x, B => 0 } }", nil},
+		{"import \"lib\" as lib; import { f, g as h } from \"lib\"; [lib, f, h, g]", []string{"line 1: undefined variable `g`"}},
+		{"fn() {\n  let a = b;\n  a\n}\nc", []string{"line 2: undefined variable `b`", "line 5: undefined variable `c`"}},
+	}
+
+	builtins := map[string]bool{"print": true, "len": true}
+
+	for _, tt := range tests {
+		result := Resolve(parse(t, tt.input), func(name string) bool { return builtins[name] })
+
+		var got []string
+		for _, d := range result.Diagnostics {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Package saphire embeds the Saphire programming language in Go programs.
+//
+// A Runtime owns its global environment, builtins and configuration, so
+// several runtimes can live in one process without sharing state:
+//
+//	rt := saphire.New(saphire.WithStdout(&buf))
+//	rt.Set("limit", 10)
+//	rt.RegisterFunc("hypot", math.Hypot)
+//	if _, err := rt.Run(`let double = fn(x) { x * 2 }`); err != nil {
+//		return err
+//	}
+//	result, err := rt.Call("double", 21)
+package saphire
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/format"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+	"github.com/darwin1224/saphire/vm"
+)
+
+// Option configures a Runtime created with New.
+type Option = interpreter.Option
+
+var (
+	// WithStdout sets the writer used by `print`.
+	WithStdout = interpreter.WithStdout
+	// WithStderr sets the writer used by `eprint`.
+	WithStderr = interpreter.WithStderr
+	// WithStdin sets the reader used by `input`.
+	WithStdin = interpreter.WithStdin
+	// WithLimits bounds the steps, time, allocations and call depth of each
+	// Run or Call.
+	WithLimits = interpreter.WithLimits
+	// WithModulePath sets the directories searched for imported modules.
+	WithModulePath = interpreter.WithModulePath
+	// WithShadowWarnings reports declarations that shadow an enclosing
+	// variable on stderr.
+	WithShadowWarnings = interpreter.WithShadowWarnings
+	// WithStaticChecks reports undefined variables before a program runs,
+	// and unused local variables on stderr.
+	WithStaticChecks = interpreter.WithStaticChecks
+	// WithOptimizations folds constants, removes dead code and inlines
+	// trivial functions before programs run. See the optimizer package.
+	WithOptimizations = interpreter.WithOptimizations
+)
+
+// Limits bounds the resources of a single Run or Call. See
+// interpreter.Limits.
+type Limits = interpreter.Limits
+
+var (
+	// ErrLimitExceeded matches errors returned when a Run or Call exceeds one
+	// of the runtime's Limits.
+	ErrLimitExceeded = interpreter.ErrLimitExceeded
+	// ErrThrown matches errors raised by an uncaught `throw`.
+	ErrThrown = interpreter.ErrThrown
+)
+
+// Engine is the backend a Runtime runs programs with.
+type Engine int
+
+const (
+	// Tree evaluates programs by walking their syntax tree.
+	Tree Engine = iota
+	// VM compiles programs to bytecode and runs them on a stack-based
+	// virtual machine.
+	VM
+)
+
+// ParseEngine returns the engine called name, "tree" or "vm".
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "tree":
+		return Tree, nil
+	case "vm":
+		return VM, nil
+	default:
+		return Tree, fmt.Errorf("saphire: unknown engine %q (expected tree or vm)", name)
+	}
+}
+
+func (e Engine) String() string {
+	if e == VM {
+		return "vm"
+	}
+	return "tree"
+}
+
+// Runtime is an isolated Saphire execution context. It is not safe for
+// concurrent use; create one runtime per goroutine instead.
+type Runtime struct {
+	interp *interpreter.Interpreter
+	env    *object.Environment
+
+	engine Engine
+	vm     *vm.VM
+	cache  *compiler.Cache
+}
+
+func New(opts ...Option) *Runtime {
+	return &Runtime{
+		interp: interpreter.New(opts...),
+		env:    object.NewEnvironment(),
+	}
+}
+
+// ParseError is returned when the source passed to Run does not parse.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError is returned when evaluation produces a Saphire error.
+type RuntimeError struct {
+	Object *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Object.Message
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Object.Cause
+}
+
+// Run evaluates source in the runtime's global environment and returns the
+// value of the last statement. Bindings made by source stay visible to later
+// calls of Run, Call and Get.
+func (r *Runtime) Run(source string) (object.Object, error) {
+	return r.RunContext(context.Background(), source)
+}
+
+// RunContext is like Run, but stops the evaluation when ctx is done.
+func (r *Runtime) RunContext(ctx context.Context, source string) (object.Object, error) {
+	p := parser.New(lexer.New(source))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	if r.engine == VM {
+		return r.runVM(ctx, "", nil, program)
+	}
+	return result(r.interp.Eval(ctx, program, r.env))
+}
+
+// RunFile is like Run for the source file at path. Imports in the file
+// resolve relative to its directory, and modules it imports stay cached
+// for later runs. Files with the .spc extension hold programs compiled with
+// Compile, which run on the VM whatever the runtime's engine.
+func (r *Runtime) RunFile(path string) (object.Object, error) {
+	return r.RunFileContext(context.Background(), path)
+}
+
+// RunFileContext is like RunFile, but stops the evaluation when ctx is done.
+func (r *Runtime) RunFileContext(ctx context.Context, path string) (object.Object, error) {
+	if filepath.Ext(path) == compiler.FileExt {
+		bc, err := compiler.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if r.vm == nil {
+			r.vm = vm.New(r.interp)
+			r.vm.SetCache(r.cache)
+		}
+		return result(r.vm.RunFile(ctx, path, bc, r.env))
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.engine == VM && r.cache != nil && !r.interp.StaticChecks() {
+		if bc, ok := r.cache.Load(source, r.interp.Optimizes()); ok {
+			return result(r.vm.RunFile(ctx, path, bc, r.env))
+		}
+	}
+
+	p := parser.New(lexer.New(string(source)))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	if r.engine == VM {
+		return r.runVM(ctx, path, source, program)
+	}
+	return result(r.interp.EvalFile(ctx, path, program, r.env))
+}
+
+// SetEngine selects the engine of later runs. Select it before the first
+// run, since the VM cannot call functions defined by the tree engine.
+func (r *Runtime) SetEngine(engine Engine) {
+	r.engine = engine
+	if engine == VM && r.vm == nil {
+		r.vm = vm.New(r.interp)
+		r.vm.SetCache(r.cache)
+	}
+}
+
+// SetCacheDir makes the VM keep the programs it compiles from files and
+// imported modules in dir, keyed by the hash of their source, and load them
+// from there instead of compiling unchanged sources again. An empty dir
+// disables the cache.
+func (r *Runtime) SetCacheDir(dir string) {
+	r.cache = nil
+	if dir != "" {
+		r.cache = compiler.NewCache(dir)
+	}
+	if r.vm != nil {
+		r.vm.SetCache(r.cache)
+	}
+}
+
+// Compile compiles source for the VM. The result can be saved with
+// compiler.WriteFile and run with RunFile.
+func Compile(source string) (*compiler.Bytecode, error) {
+	p := parser.New(lexer.New(source))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	return compiler.Compile(program)
+}
+
+// Format returns source laid out in the canonical format, with its
+// comments kept. See package format for the layout.
+func Format(source string) (string, error) {
+	p := parser.New(lexer.New(source))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return "", &ParseError{Errors: p.Errors()}
+	}
+
+	return format.Program(program, source), nil
+}
+
+// runVM compiles program and runs it on the runtime's VM, as the file at
+// path unless path is empty. The compiled program is cached under source
+// unless it is nil.
+func (r *Runtime) runVM(ctx context.Context, path string, source []byte, program *ast.Program) (object.Object, error) {
+	r.interp.Optimize(program)
+	if err := r.interp.Verify(program, r.env); err != nil {
+		return result(err)
+	}
+
+	bc, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cache != nil && source != nil {
+		// The cache only saves work, so failing to fill it is not an error.
+		r.cache.Store(source, r.interp.Optimizes(), bc)
+	}
+
+	if path != "" {
+		return result(r.vm.RunFile(ctx, path, bc, r.env))
+	}
+	return result(r.vm.Run(ctx, bc, r.env))
+}
+
+// Call invokes the function bound to name with args, which are converted
+// with ToObject.
+func (r *Runtime) Call(name string, args ...any) (object.Object, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is like Call, but stops the evaluation when ctx is done.
+func (r *Runtime) CallContext(ctx context.Context, name string, args ...any) (object.Object, error) {
+	fn, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("saphire: function %q not found", name)
+	}
+
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := r.ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = obj
+	}
+
+	if r.engine == VM {
+		return result(r.vm.Apply(ctx, fn, objects))
+	}
+	return result(r.interp.Apply(ctx, fn, objects))
+}
+
+// Set converts value with ToObject and binds it to name in the runtime's
+// global environment.
+func (r *Runtime) Set(name string, value any) error {
+	obj, err := r.ToObject(value)
+	if err != nil {
+		return err
+	}
+
+	r.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the global or builtin bound to name.
+func (r *Runtime) Get(name string) (object.Object, bool) {
+	if value, ok := r.env.Get(name); ok {
+		return value, true
+	}
+
+	if builtin, ok := r.interp.Builtin(name); ok {
+		return builtin, true
+	}
+
+	if namespace, ok := r.interp.Namespace(name); ok {
+		return namespace, true
+	}
+
+	return nil, false
+}
+
+// RegisterBuiltin makes fn callable as name from scripts run by this runtime
+// only.
+func (r *Runtime) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	r.interp.RegisterBuiltin(name, fn)
+}
+
+// RegisterMethod makes fn callable as `value.name(args)` on values of type
+// typ. fn receives the value as its first argument.
+func (r *Runtime) RegisterMethod(typ object.ObjectType, name string, fn object.BuiltinFunction) {
+	r.interp.RegisterMethod(typ, name, fn)
+}
+
+// RegisterNamespace makes members accessible as `name.member` from scripts
+// run by this runtime.
+func (r *Runtime) RegisterNamespace(name string, members map[string]object.Object) {
+	r.interp.RegisterNamespace(name, members)
+}
+
+// RegisterFunc converts fn with ToObject and registers it as a builtin, so
+// that plain Go functions can be exposed without hand-written argument
+// checks:
+//
+//	rt.RegisterFunc("hypot", math.Hypot)
+func (r *Runtime) RegisterFunc(name string, fn any) error {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		return fmt.Errorf("saphire: RegisterFunc expects a func, got %T", fn)
+	}
+
+	r.interp.RegisterBuiltin(name, funcToBuiltin(name, rv, r.apply).Fn)
+	return nil
+}
+
+// ToObject is like the package-level ToObject, but converted funcs can call
+// back into Saphire functions defined in this runtime.
+func (r *Runtime) ToObject(v any) (object.Object, error) {
+	if v == nil {
+		return interpreter.NIL, nil
+	}
+	return toObject(reflect.ValueOf(v), r.apply)
+}
+
+// FromObject is like the package-level FromObject, but Saphire functions
+// defined in this runtime can be converted to Go funcs.
+func (r *Runtime) FromObject(obj object.Object, target any) error {
+	return fromObject(obj, target, r.apply)
+}
+
+// apply calls fn for converted funcs. When called back from a host function
+// it joins the evaluation in progress and its limits.
+func (r *Runtime) apply(fn object.Object, args []object.Object) object.Object {
+	if r.engine == VM {
+		return r.vm.Apply(context.Background(), fn, args)
+	}
+	return r.interp.Apply(context.Background(), fn, args)
+}
+
+func result(obj object.Object) (object.Object, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		return nil, &RuntimeError{Object: errObj}
+	}
+	return obj, nil
+}
@@ -0,0 +1,408 @@
+package saphire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/object"
+)
+
+func TestRuntimeRun(t *testing.T) {
+	rt := New()
+
+	if _, err := rt.Run(`let double = fn(x) { x * 2 };`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	result, err := rt.Run(`double(21)`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	testNumber(t, result, 42)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Run(`let = 5;`)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected ParseError. got=%T (%v)", err, err)
+	}
+
+	_, err = rt.Run(`1 + true`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Error() != "type mismatch: NUMBER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Error())
+	}
+
+	if _, err := rt.Call("missing"); err == nil {
+		t.Errorf("expected error calling missing function")
+	}
+}
+
+func TestRuntimeCall(t *testing.T) {
+	rt := New()
+
+	if _, err := rt.Run(`let add = fn(x, y) { return x + y; };`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	result, err := rt.Call("add", &object.Number{Value: 1}, &object.Number{Value: 2})
+	if err != nil {
+		t.Fatalf("Call returned error: %s", err)
+	}
+	testNumber(t, result, 3)
+
+	result, err = rt.Call("len", &object.String{Value: "four"})
+	if err != nil {
+		t.Fatalf("Call returned error: %s", err)
+	}
+	testNumber(t, result, 4)
+}
+
+func TestRuntimeGlobals(t *testing.T) {
+	rt := New()
+	rt.Set("limit", &object.Number{Value: 10})
+
+	if _, err := rt.Run(`let doubled = limit * 2;`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	doubled, ok := rt.Get("doubled")
+	if !ok {
+		t.Fatalf("global doubled not found")
+	}
+	testNumber(t, doubled, 20)
+}
+
+func TestRuntimeIsolation(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	rt1 := New(WithStdout(&out1))
+	rt2 := New(WithStdout(&out2))
+
+	rt1.RegisterBuiltin("answer", func(args ...object.Object) object.Object {
+		return &object.Number{Value: 42}
+	})
+
+	if _, err := rt1.Run(`let x = answer(); print(x);`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	if _, err := rt2.Run(`answer()`); err == nil {
+		t.Errorf("builtin registered on one runtime leaked into another")
+	}
+	if _, ok := rt2.Get("x"); ok {
+		t.Errorf("global set in one runtime leaked into another")
+	}
+
+	if out1.String() != "42.00\n" {
+		t.Errorf("wrong output for first runtime. got=%q", out1.String())
+	}
+	if out2.Len() != 0 {
+		t.Errorf("second runtime wrote output. got=%q", out2.String())
+	}
+}
+
+func testNumber(t *testing.T, obj object.Object, expected float64) {
+	t.Helper()
+
+	number, ok := obj.(*object.Number)
+	if !ok {
+		t.Fatalf("object is not Number. got=%T (%+v)", obj, obj)
+	}
+	if number.Value != expected {
+		t.Errorf("object has wrong value. got=%f, want=%f", number.Value, expected)
+	}
+}
+
+func TestRuntimeLimits(t *testing.T) {
+	rt := New(WithLimits(Limits{MaxSteps: 500}))
+
+	_, err := rt.Run(`let loop = fn(n) { loop(n + 1) }; loop(0)`)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected limit error. got=%v", err)
+	}
+
+	// Limits apply per call, so the runtime stays usable afterwards.
+	result, err := rt.Run(`1 + 1`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	testNumber(t, result, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rt.CallContext(ctx, "loop", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+}
+
+func TestRuntimeThrow(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Run(`throw "bad record"`)
+	if !errors.Is(err, ErrThrown) {
+		t.Fatalf("expected thrown error. got=%v", err)
+	}
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("error is not *RuntimeError. got=%T", err)
+	}
+	if runtimeErr.Error() != "bad record" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Error())
+	}
+	if value, ok := runtimeErr.Object.Value.(*object.String); !ok || value.Value != "bad record" {
+		t.Errorf("wrong thrown value. got=%+v", runtimeErr.Object.Value)
+	}
+}
+
+func TestRuntimeRunFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/math.sp": `export fn square(x) { x * x }`,
+		"main.sp":     `import { square } from "lib/math"; let nine = square(3);`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt := New()
+	if _, err := rt.RunFile(filepath.Join(dir, "main.sp")); err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	nine, ok := rt.Get("nine")
+	if !ok {
+		t.Fatalf("global nine not set")
+	}
+	testNumber(t, nine, 9)
+
+	if _, err := rt.RunFile(filepath.Join(dir, "missing.sp")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist. got=%v", err)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRuntimeRunCompiledFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib/math.sp": `export fn square(x) { x * x }`,
+	})
+
+	bc, err := Compile(`import { square } from "lib/math"; let nine = square(3);`)
+	if err != nil {
+		t.Fatalf("Compile returned error: %s", err)
+	}
+	path := filepath.Join(dir, "main.spc")
+	if err := compiler.WriteFile(path, bc); err != nil {
+		t.Fatalf("WriteFile returned error: %s", err)
+	}
+
+	rt := New()
+	if _, err := rt.RunFile(path); err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	nine, ok := rt.Get("nine")
+	if !ok {
+		t.Fatalf("global nine not set")
+	}
+	testNumber(t, nine, 9)
+
+	if _, err := Compile(`let = 1;`); err == nil {
+		t.Errorf("expected parse error")
+	} else if _, ok := err.(*ParseError); !ok {
+		t.Errorf("wrong error type. got=%T", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"bad.spc": "let nine = 9;"})
+	if _, err := rt.RunFile(filepath.Join(dir, "bad.spc")); !errors.Is(err, compiler.ErrFormat) {
+		t.Errorf("expected compiler.ErrFormat. got=%v", err)
+	}
+}
+
+func TestRuntimeCompileCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	main := `import { square } from "lib/math"; let nine = square(3);`
+	writeFiles(t, dir, map[string]string{
+		"lib/math.sp": `export fn square(x) { x * x }`,
+		"main.sp":     main,
+	})
+
+	rt := New()
+	rt.SetEngine(VM)
+	rt.SetCacheDir(cacheDir)
+	if _, err := rt.RunFile(filepath.Join(dir, "main.sp")); err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("cache directory not created: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("wrong number of cached programs. want=2, got=%d", len(entries))
+	}
+
+	// Replace the cached program of main.sp, so that a later run shows
+	// whether it was loaded from the cache.
+	bc, err := Compile(`let nine = 10;`)
+	if err != nil {
+		t.Fatalf("Compile returned error: %s", err)
+	}
+	if err := compiler.NewCache(cacheDir).Store([]byte(main), false, bc); err != nil {
+		t.Fatalf("Store returned error: %s", err)
+	}
+
+	// Optimized programs are cached apart from the others.
+	for _, tt := range []struct {
+		cacheDir string
+		opts     []Option
+		expected float64
+	}{
+		{cacheDir, nil, 10},
+		{"", nil, 9},
+		{cacheDir, []Option{WithOptimizations()}, 9},
+	} {
+		rt := New(tt.opts...)
+		rt.SetEngine(VM)
+		rt.SetCacheDir(tt.cacheDir)
+		if _, err := rt.RunFile(filepath.Join(dir, "main.sp")); err != nil {
+			t.Fatalf("RunFile returned error: %s", err)
+		}
+
+		nine, _ := rt.Get("nine")
+		testNumber(t, nine, tt.expected)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	formatted, err := Format("let x=1 // one\nfn f(a){a*2}")
+	if err != nil {
+		t.Fatalf("Format returned error: %s", err)
+	}
+
+	expected := "let x = 1; // one\nfn f(a) {\n  a * 2\n}\n"
+	if formatted != expected {
+		t.Errorf("wrong format.\nexpected:\n%s\ngot:\n%s", expected, formatted)
+	}
+
+	_, err = Format("let = 1")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+}
+
+func TestRuntimeNamespaces(t *testing.T) {
+	rt := New()
+	rt.RegisterMethod(object.STRING_OBJ, "shout", func(args ...object.Object) object.Object {
+		return &object.String{Value: args[0].(*object.String).Value + "!"}
+	})
+
+	result, err := rt.Run(`"hi".shout()`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result.Inspect() != "hi!" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+
+	if _, ok := rt.Get("math"); !ok {
+		t.Errorf("math namespace not found")
+	}
+}
+
+// TestRuntimeOptimizedRuns checks that calls are not inlined when a later
+// run may replace the function called.
+func TestRuntimeOptimizedRuns(t *testing.T) {
+	for _, engine := range []Engine{Tree, VM} {
+		rt := New(WithOptimizations())
+		rt.SetEngine(engine)
+
+		if _, err := rt.Run(`let f = fn(a) { a * 2 }; let h = fn() { f(5) };`); err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+
+		result, err := rt.Run(`f = fn(a) { 0 }; h()`)
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+		testNumber(t, result, 0)
+	}
+}
+
+func TestRuntimeEngines(t *testing.T) {
+	for _, name := range []string{"tree", "vm"} {
+		engine, err := ParseEngine(name)
+		if err != nil {
+			t.Fatalf("ParseEngine(%q) returned error: %s", name, err)
+		}
+		if engine.String() != name {
+			t.Errorf("wrong engine name. want=%q, got=%q", name, engine)
+		}
+
+		rt := New()
+		rt.SetEngine(engine)
+
+		if _, err := rt.Run(`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`); err != nil {
+			t.Fatalf("%s: Run returned error: %s", name, err)
+		}
+
+		result, err := rt.Call("fib", 15)
+		if err != nil {
+			t.Fatalf("%s: Call returned error: %s", name, err)
+		}
+		testNumber(t, result, 610)
+
+		var apply func(float64) float64
+		fn, _ := rt.Get("fib")
+		if err := rt.FromObject(fn, &apply); err != nil {
+			t.Fatalf("%s: FromObject returned error: %s", name, err)
+		}
+		if got := apply(10); got != 55 {
+			t.Errorf("%s: wrong result of converted func. got=%f", name, got)
+		}
+
+		_, err = rt.Run(`[1, 2].map(fn(x) { x + true })`)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Error() != "type mismatch: NUMBER + BOOLEAN" {
+			t.Errorf("%s: wrong error. got=%v", name, err)
+		}
+	}
+
+	if _, err := ParseEngine("jit"); err == nil {
+		t.Errorf("expected error for unknown engine")
+	}
+}
@@ -5,6 +5,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
 }
 
 const (
@@ -39,6 +41,12 @@ const (
 	LBRACKET  = "["
 	RBRACKET  = "]"
 	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	PIPE      = "|"
+	ARROW     = "=>"
+	RANGE     = ".."
+	RANGE_EQ  = "..="
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -47,16 +55,40 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MATCH    = "MATCH"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	STRUCT   = "STRUCT"
+	WITH     = "WITH"
+	ENUM     = "ENUM"
+	CLASS    = "CLASS"
+	CONST    = "CONST"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"match":   MATCH,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"struct":  STRUCT,
+	"with":    WITH,
+	"enum":    ENUM,
+	"class":   CLASS,
+	"const":   CONST,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,414 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+// maxTraceFrames is the number of innermost frames kept in error traces.
+const maxTraceFrames = 10
+
+// namedArg is a call argument passed by parameter name.
+type namedArg struct {
+	name  string
+	value object.Object
+}
+
+// callClosure calls cl with the argc arguments on top of the stack, which
+// become the first local variables of its frame. Calls that do not fill
+// the parameters exactly take the slower path of enter.
+func (vm *VM) callClosure(cl *Closure, argc int, caller *compiler.Function, site int) *object.Error {
+	params := cl.Fn.Parameters
+	if argc != len(params) || (argc > 0 && params[argc-1].Variadic) {
+		args := make([]object.Object, argc)
+		copy(args, vm.stack[vm.sp-argc:vm.sp])
+		vm.sp -= argc + 1
+		return vm.enter(cl, args, nil, caller, site, "")
+	}
+
+	f := frame{cl: cl, bp: vm.sp - argc, sp: vm.sp - argc - 1, kind: functionFrame, caller: caller, site: site}
+	if max := vm.maxDepth(); max > 0 && vm.depth >= max {
+		return vm.recursionError(f.callName(), max)
+	}
+	if err := vm.alloc(1); err != nil {
+		return err
+	}
+
+	vm.frames = append(vm.frames, f)
+	vm.depth++
+	vm.reserve(len(cl.Fn.Locals) - argc)
+	return nil
+}
+
+// callValue calls fn, popped from the stack with its arguments, from the
+// call at site of the frame f. A closure called in tail position replaces
+// f instead of nesting.
+func (vm *VM) callValue(f *frame, fn object.Object, args []object.Object, named []namedArg, site int, tail bool) *object.Error {
+	caller := f.cl.Fn
+
+	cl, ok := fn.(*Closure)
+	if !ok {
+		result, err := vm.applyNative(fn, args, named, caller, site)
+		if err != nil {
+			return err
+		}
+		vm.push(result)
+		return nil
+	}
+
+	if tail && f.kind == functionFrame {
+		vm.leave()
+	}
+	return vm.enter(cl, args, named, caller, site, "")
+}
+
+// enter pushes a frame for a call of cl and binds its arguments. The frame
+// is left on the frame stack when binding fails, so that the error's trace
+// includes the call.
+func (vm *VM) enter(cl *Closure, args []object.Object, named []namedArg, caller *compiler.Function, site int, name string) *object.Error {
+	f := frame{cl: cl, bp: vm.sp, sp: vm.sp, kind: functionFrame, caller: caller, site: site, name: name}
+	if max := vm.maxDepth(); max > 0 && vm.depth >= max {
+		return vm.recursionError(f.callName(), max)
+	}
+	if err := vm.alloc(1); err != nil {
+		return err
+	}
+
+	vm.frames = append(vm.frames, f)
+	vm.depth++
+	vm.reserve(len(cl.Fn.Locals))
+
+	return vm.bind(cl.Fn, f.bp, args, named, f.callName())
+}
+
+// bind stores the arguments of a call of fn, named name, in the parameter
+// slots from bp. Positional arguments fill the parameters in order and any
+// surplus is collected by the variadic parameter. Named arguments then fill
+// parameters by name. Parameters left without a value stay empty, and the
+// function's prologue evaluates their defaults.
+func (vm *VM) bind(fn *compiler.Function, bp int, args []object.Object, named []namedArg, name string) *object.Error {
+	params := fn.Parameters
+
+	var variadic *compiler.Parameter
+	if len(params) > 0 && params[len(params)-1].Variadic {
+		variadic = &params[len(params)-1]
+		params = params[:len(params)-1]
+	}
+
+	required := 0
+	for _, param := range params {
+		if !param.Default {
+			required++
+		}
+	}
+
+	maxArgs := len(params)
+	if variadic != nil {
+		maxArgs = -1
+	}
+	if err := interpreter.CheckArgCount(name, len(args)+len(named), required, maxArgs); err != nil {
+		return err
+	}
+
+	slots := vm.stack[bp : bp+len(params)]
+	copy(slots, args)
+
+	for _, arg := range named {
+		idx := -1
+		for i, param := range params {
+			if param.Name != "" && param.Name == arg.name {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			return newError("function `%s` has no parameter `%s`", name, arg.name)
+		}
+		if slots[idx] != nil {
+			return newError("function `%s` got multiple values for parameter `%s`", name, arg.name)
+		}
+		slots[idx] = arg.value
+	}
+
+	for i, param := range params {
+		if slots[i] == nil && !param.Default {
+			return newError("function `%s` missing argument for parameter `%s`", name, param.Source)
+		}
+	}
+
+	if variadic != nil {
+		rest := make([]object.Object, 0)
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+
+		if err := vm.alloc(len(rest) + 1); err != nil {
+			return err
+		}
+		vm.stack[bp+len(params)] = &object.Array{Elements: rest}
+	}
+
+	return nil
+}
+
+// applyNative calls fn, which is not a closure, from the call at site of
+// caller.
+func (vm *VM) applyNative(fn object.Object, args []object.Object, named []namedArg, caller *compiler.Function, site int) (object.Object, *object.Error) {
+	var result object.Object
+
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		if len(named) > 0 {
+			return nil, newError("function `%s` does not accept named arguments", fn.Name)
+		}
+
+		result = fn.Fn(args...)
+		if err := vm.allocResult(result); err != nil {
+			return nil, err
+		}
+	case *object.StructType:
+		values, err := vm.fieldValues("struct", fn.Name, fn.Fields, args, named)
+		if err != nil {
+			return nil, err
+		}
+		result = &object.Struct{StructType: fn, Values: values}
+	case *object.Variant:
+		values, err := vm.fieldValues("variant", fn.Name, fn.Fields, args, named)
+		if err != nil {
+			return nil, err
+		}
+		result = &object.Enum{Variant: fn, Values: values}
+	case *object.Class:
+		return vm.instantiate(fn, args, named, caller, site)
+	case object.Callable:
+		if len(named) > 0 {
+			return nil, newError("function `%s` does not accept named arguments", siteName(caller, site))
+		}
+		result = fn.Call(args)
+	default:
+		return nil, newError("not a function: %s", fn.Type())
+	}
+
+	switch result := result.(type) {
+	case nil:
+		return interpreter.NIL, nil
+	case *object.Error:
+		return nil, result
+	}
+	return result, nil
+}
+
+// fieldValues orders the arguments of a call to the constructor of a struct
+// or variant, called name, by fields.
+func (vm *VM) fieldValues(kind, name string, fields []string, args []object.Object, named []namedArg) ([]object.Object, *object.Error) {
+	if err := interpreter.CheckArgCount(name, len(args)+len(named), len(fields), len(fields)); err != nil {
+		return nil, err
+	}
+
+	values := make([]object.Object, len(fields))
+	copy(values, args)
+
+	for _, arg := range named {
+		i := fieldIndex(fields, arg.name)
+		if i < 0 {
+			return nil, interpreter.FieldError(kind, name, arg.name)
+		}
+		if values[i] != nil {
+			return nil, newError("%s %s got multiple values for field `%s`", kind, name, arg.name)
+		}
+		values[i] = arg.value
+	}
+
+	if err := vm.alloc(len(values) + 1); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// instantiate creates an instance of class and initializes it with the
+// `init` method, which receives the arguments of the call.
+func (vm *VM) instantiate(class *object.Class, args []object.Object, named []namedArg, caller *compiler.Function, site int) (object.Object, *object.Error) {
+	if err := vm.alloc(1); err != nil {
+		return nil, err
+	}
+	instance := object.NewInstance(class)
+
+	init, owner, ok := class.FindMethod("init")
+	if !ok {
+		if err := interpreter.CheckArgCount(class.Name, len(args)+len(named), 0, 0); err != nil {
+			return nil, err
+		}
+		return instance, nil
+	}
+
+	bound, err := vm.bindInstanceMethod(instance, init, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := len(vm.frames)
+	if err := vm.enter(bound, args, named, caller, site, ""); err != nil {
+		return nil, vm.unwind(err, stop)
+	}
+	if errObj, ok := vm.execute(stop).(*object.Error); ok {
+		return nil, errObj
+	}
+
+	return instance, nil
+}
+
+// callBlock runs a block of a try expression, passing the catch block its
+// argument.
+func (vm *VM) callBlock(cl *Closure, arg object.Object) object.Object {
+	stop := len(vm.frames)
+	vm.frames = append(vm.frames, frame{cl: cl, bp: vm.sp, sp: vm.sp, kind: blockFrame})
+	vm.reserve(len(cl.Fn.Locals))
+	if arg != nil {
+		vm.stack[vm.frames[stop].bp] = arg
+	}
+
+	return vm.execute(stop)
+}
+
+// try runs the blocks of a try expression, popped from the stack, and
+// returns the result of the expression. The catch block runs if the try
+// block fails with a catchable error. The finally block runs afterwards and
+// its result is discarded unless it returns or fails itself.
+func (vm *VM) try(flags int) object.Object {
+	var catch, finally *Closure
+	if flags&compiler.TryFinally != 0 {
+		finally = vm.pop().(*Closure)
+	}
+	if flags&compiler.TryCatch != 0 {
+		catch = vm.pop().(*Closure)
+	}
+	block := vm.pop().(*Closure)
+
+	result := vm.callBlock(block, nil)
+
+	if errObj, ok := result.(*object.Error); ok && interpreter.IsCatchable(errObj) && catch != nil {
+		value, err := vm.errorValue(errObj)
+		if err != nil {
+			result = err
+		} else {
+			result = vm.callBlock(catch, value)
+		}
+	}
+
+	if errObj, ok := result.(*object.Error); ok && !interpreter.IsCatchable(errObj) {
+		return result
+	}
+
+	if finally != nil {
+		final := vm.callBlock(finally, nil)
+		if rt := final.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return final
+		}
+	}
+
+	return result
+}
+
+// errorValue returns the hash a catch block receives for err.
+func (vm *VM) errorValue(err *object.Error) (object.Object, *object.Error) {
+	trace := err.Trace
+	if trace == nil {
+		trace = vm.trace()
+	}
+
+	if allocErr := vm.alloc(len(trace) + 5); allocErr != nil {
+		return nil, allocErr
+	}
+
+	return interpreter.ErrorValue(err, trace), nil
+}
+
+// tailPosition reports whether the instruction at ip, following jumps,
+// returns from the function.
+func tailPosition(ins compiler.Instructions, ip int) bool {
+	for compiler.Opcode(ins[ip]) == compiler.OpJump {
+		ip = read16(ins, ip+1)
+	}
+	return compiler.Opcode(ins[ip]) == compiler.OpReturnValue
+}
+
+// callName returns the name of the function a frame runs, as it appears in
+// traces: the function's own name, or else the name it was called by.
+func (f *frame) callName() string {
+	if f.cl.Fn.Name != "" {
+		return f.cl.Fn.Name
+	}
+	if f.name != "" {
+		return f.name
+	}
+	return siteName(f.caller, f.site)
+}
+
+func (f *frame) String() string {
+	line := 0
+	if f.caller != nil {
+		if call, ok := f.caller.CallSite(f.site); ok {
+			line = call.Line
+		}
+	}
+
+	if line == 0 {
+		return "at " + f.callName()
+	}
+	return fmt.Sprintf("at %s (line %d)", f.callName(), line)
+}
+
+// siteName returns the name of the call at site of caller.
+func siteName(caller *compiler.Function, site int) string {
+	if caller != nil {
+		if call, ok := caller.CallSite(site); ok {
+			return call.Name
+		}
+	}
+	return "<anonymous>"
+}
+
+// trace renders the innermost function calls, most recent first.
+func (vm *VM) trace() []string {
+	trace := make([]string, 0, maxTraceFrames+1)
+
+	calls := 0
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		f := &vm.frames[i]
+		if f.kind != functionFrame {
+			continue
+		}
+
+		if calls < maxTraceFrames {
+			trace = append(trace, f.String())
+		}
+		calls++
+	}
+
+	if hidden := calls - maxTraceFrames; hidden > 0 {
+		trace = append(trace, fmt.Sprintf("... %d more frames", hidden))
+	}
+
+	return trace
+}
+
+func (vm *VM) recursionError(name string, max int) *object.Error {
+	err := newLimitError("depth", max)
+	err.Message = fmt.Sprintf("maximum recursion depth exceeded (%d) calling `%s`", max, name)
+	err.Trace = vm.trace()
+	return err
+}
+
+func fieldIndex(fields []string, name string) int {
+	for i, field := range fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
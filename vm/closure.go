@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/object"
+)
+
+// Closure is a compiled function with the variables it captured. It is the
+// value of function literals run by the VM.
+type Closure struct {
+	Fn   *compiler.Function
+	Free []*Upvalue
+
+	globals *object.Environment
+	vm      *VM
+}
+
+func (c *Closure) Type() object.ObjectType { return object.FUNCTION_OBJ }
+func (c *Closure) Inspect() string         { return c.Fn.Inspect() }
+
+// Call calls the closure from Go, such as from a builtin like `arr.map`.
+func (c *Closure) Call(args []object.Object) object.Object {
+	if c.vm.active == 0 {
+		defer c.vm.begin(context.Background())()
+	}
+	return c.vm.call(c, args, "<anonymous>")
+}
+
+// Upvalue is a variable captured by a closure. While the frame declaring
+// the variable runs, the upvalue is open and refers to its stack slot;
+// when the frame returns, the upvalue is closed and keeps the value.
+type Upvalue struct {
+	index  int
+	value  object.Object
+	closed bool
+}
+
+func (uv *Upvalue) get(vm *VM) object.Object {
+	if uv.closed {
+		return uv.value
+	}
+	return vm.stack[uv.index]
+}
+
+func (uv *Upvalue) set(vm *VM, value object.Object) {
+	if uv.closed {
+		uv.value = value
+		return
+	}
+	vm.stack[uv.index] = value
+}
+
+// closedUpvalue returns an upvalue holding value, for `self` and `super`.
+func closedUpvalue(value object.Object) *Upvalue {
+	return &Upvalue{value: value, closed: true}
+}
+
+// captureUpvalue returns the open upvalue of the stack slot index, sharing
+// it with the closures that captured the slot before.
+func (vm *VM) captureUpvalue(index int) *Upvalue {
+	i := len(vm.open)
+	for i > 0 && vm.open[i-1].index >= index {
+		if vm.open[i-1].index == index {
+			return vm.open[i-1]
+		}
+		i--
+	}
+
+	uv := &Upvalue{index: index}
+	vm.open = append(vm.open, nil)
+	copy(vm.open[i+1:], vm.open[i:])
+	vm.open[i] = uv
+	return uv
+}
+
+// closeUpvalues closes the open upvalues of the slots from index up.
+func (vm *VM) closeUpvalues(index int) {
+	for n := len(vm.open); n > 0 && vm.open[n-1].index >= index; n-- {
+		uv := vm.open[n-1]
+		uv.value = vm.stack[uv.index]
+		uv.closed = true
+		vm.open = vm.open[:n-1]
+	}
+}
+
+// newClosure creates a closure of fn in the frame f.
+func (vm *VM) newClosure(fn *compiler.Function, f *frame) *Closure {
+	cl := &Closure{Fn: fn, globals: f.cl.globals, vm: vm}
+	if len(fn.Free) > 0 {
+		cl.Free = make([]*Upvalue, len(fn.Free))
+	}
+
+	for i, capture := range fn.Free {
+		switch capture.Kind {
+		case compiler.CaptureLocal:
+			cl.Free[i] = vm.captureUpvalue(f.bp + capture.Index)
+		case compiler.CaptureFree:
+			cl.Free[i] = f.cl.Free[capture.Index]
+		}
+	}
+
+	return cl
+}
+
+// bindMethod returns method with `self` bound to instance and, if owner,
+// the class defining the method, extends another, `super` bound to the
+// superclass.
+func (vm *VM) bindMethod(instance *object.Instance, method *Closure, owner *object.Class) (*Closure, *object.Error) {
+	if err := vm.alloc(2); err != nil {
+		return nil, err
+	}
+
+	bound := &Closure{Fn: method.Fn, Free: make([]*Upvalue, len(method.Free)), globals: method.globals, vm: vm}
+	copy(bound.Free, method.Free)
+
+	for i, capture := range method.Fn.Free {
+		switch capture.Kind {
+		case compiler.CaptureSelf:
+			bound.Free[i] = closedUpvalue(instance)
+		case compiler.CaptureSuper:
+			if owner.Superclass != nil {
+				bound.Free[i] = closedUpvalue(&object.Super{Self: instance, Class: owner.Superclass})
+			}
+		}
+	}
+
+	return bound, nil
+}
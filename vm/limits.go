@@ -0,0 +1,91 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+// contextCheckInterval is the number of instructions run between checks of
+// the context of a run.
+const contextCheckInterval = 1024
+
+// run holds the bookkeeping of the run in progress. The VM applies the
+// Limits of its interpreter, counting instructions as steps.
+type run struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	parent context.Context
+
+	steps  int64
+	allocs int64
+}
+
+// begin starts tracking a run and returns the function ending it. Nested
+// runs, such as a host builtin calling back into Saphire, share the limits
+// of the outermost run.
+func (vm *VM) begin(ctx context.Context) func() {
+	vm.active++
+	if vm.active > 1 {
+		return func() { vm.active-- }
+	}
+
+	vm.run = run{ctx: ctx, parent: ctx}
+	if vm.limits.Timeout > 0 {
+		vm.run.ctx, vm.run.cancel = context.WithTimeout(ctx, vm.limits.Timeout)
+	}
+
+	return func() {
+		vm.active--
+		if vm.run.cancel != nil {
+			vm.run.cancel()
+		}
+		vm.run = run{}
+	}
+}
+
+// checkContext reports whether the run must stop because its context is
+// done.
+func (vm *VM) checkContext() *object.Error {
+	if vm.run.ctx == nil {
+		return nil
+	}
+
+	select {
+	case <-vm.run.ctx.Done():
+		if vm.run.parent.Err() == nil {
+			return newLimitError("timeout", vm.limits.Timeout)
+		}
+		err := vm.run.parent.Err()
+		return &object.Error{Message: "evaluation stopped: " + err.Error(), Cause: err}
+	default:
+		return nil
+	}
+}
+
+// alloc accounts for n newly allocated values.
+func (vm *VM) alloc(n int) *object.Error {
+	vm.run.allocs += int64(n)
+	if max := vm.limits.MaxAllocations; max > 0 && vm.run.allocs > max {
+		return newLimitError("allocations", max)
+	}
+	return nil
+}
+
+// allocResult accounts for the values allocated by a builtin call.
+func (vm *VM) allocResult(obj object.Object) *object.Error {
+	return vm.alloc(interpreter.ResultAllocations(obj))
+}
+
+func (vm *VM) maxDepth() int {
+	if vm.limits.MaxDepth == 0 {
+		return interpreter.DefaultMaxDepth
+	}
+	return vm.limits.MaxDepth
+}
+
+func newLimitError(limit string, max any) *object.Error {
+	err := &interpreter.LimitError{Limit: limit, Max: max}
+	return &object.Error{Message: err.Error(), Cause: err}
+}
@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+)
+
+// module is a source file loaded by the VM. Modules are compiled and run
+// once and cached by absolute path.
+type module struct {
+	path     string
+	env      *object.Environment
+	object   *object.Module
+	importer *module
+	loading  bool
+}
+
+// RunFile runs bc, compiled from the file at path, in env. Imports in bc
+// resolve relative to the file, and the file can be told apart from the
+// modules it imports, directly or through a cycle.
+func (vm *VM) RunFile(ctx context.Context, path string, bc *compiler.Bytecode, env *object.Environment) object.Object {
+	defer vm.begin(ctx)()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return newError("cannot evaluate %q: %s", path, err)
+	}
+
+	m := vm.newModule(abs, env)
+	result := vm.runModule(m, bc)
+	if _, ok := result.(*object.Error); ok {
+		delete(vm.modules, abs)
+	}
+
+	return result
+}
+
+func (vm *VM) newModule(path string, env *object.Environment) *module {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	m := &module{
+		path:     path,
+		env:      env,
+		object:   &object.Module{Name: name, Path: path, Exports: make(map[string]object.Object)},
+		importer: vm.module,
+		loading:  true,
+	}
+	vm.modules[path] = m
+
+	return m
+}
+
+func (vm *VM) runModule(m *module, bc *compiler.Bytecode) object.Object {
+	prev := vm.module
+	vm.module = m
+	defer func() {
+		vm.module = prev
+		m.loading = false
+	}()
+
+	return vm.runMain(bc, m.env)
+}
+
+// importModule returns the module for the import path name, loading and
+// running it on first use.
+func (vm *VM) importModule(name string) (*object.Module, *object.Error) {
+	dir := "."
+	if vm.module != nil {
+		dir = filepath.Dir(vm.module.path)
+	}
+
+	path, err := interpreter.FindModule(name, dir, vm.in.ModulePath())
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := vm.modules[path]; ok {
+		if m.loading {
+			return nil, vm.importCycleError(m)
+		}
+		return m.object, nil
+	}
+
+	src, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, newError("cannot import %q: %s", name, readErr)
+	}
+
+	env := object.NewEnvironment()
+	bc, compileErr := vm.compile(name, src, env)
+	if compileErr != nil {
+		return nil, compileErr
+	}
+
+	m := vm.newModule(path, env)
+
+	if result := vm.runModule(m, bc); result != nil && result.Type() == object.ERROR_OBJ {
+		// A module that failed to load is not cached, so that a later
+		// import reports the failure again instead of a partial module.
+		delete(vm.modules, path)
+		return nil, result.(*object.Error)
+	}
+
+	return m.object, nil
+}
+
+// SetCache makes the VM keep the programs compiled from imported modules in
+// cache. A nil cache disables caching.
+func (vm *VM) SetCache(cache *compiler.Cache) {
+	vm.cache = cache
+}
+
+// compile compiles the source of the module imported as name, or loads it
+// from the cache. Sources are parsed anyway when static checks are enabled,
+// since they run on the syntax tree.
+func (vm *VM) compile(name string, src []byte, env *object.Environment) (*compiler.Bytecode, *object.Error) {
+	if vm.cache != nil && !vm.in.StaticChecks() {
+		if bc, ok := vm.cache.Load(src, vm.in.Optimizes()); ok {
+			return bc, nil
+		}
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, newError("cannot import %q: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	vm.in.Optimize(program)
+	if err := vm.in.Verify(program, env); err != nil {
+		return nil, err
+	}
+
+	bc, err := compiler.Compile(program)
+	if err != nil {
+		return nil, newError("cannot import %q: %s", name, err)
+	}
+
+	if vm.cache != nil {
+		// The cache only saves work, so failing to fill it is not an error.
+		vm.cache.Store(src, vm.in.Optimizes(), bc)
+	}
+
+	return bc, nil
+}
+
+func (vm *VM) importCycleError(target *module) *object.Error {
+	chain := []string{filepath.Base(target.path)}
+	for m := vm.module; m != nil; m = m.importer {
+		chain = append(chain, filepath.Base(m.path))
+		if m == target {
+			break
+		}
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return newError("import cycle: %s", strings.Join(chain, " -> "))
+}
@@ -0,0 +1,318 @@
+package vm
+
+import (
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+var binaryOperators = map[compiler.Opcode]string{
+	compiler.OpAdd:          "+",
+	compiler.OpSub:          "-",
+	compiler.OpMul:          "*",
+	compiler.OpDiv:          "/",
+	compiler.OpMod:          "%",
+	compiler.OpPow:          "**",
+	compiler.OpEqual:        "==",
+	compiler.OpNotEqual:     "!=",
+	compiler.OpLess:         "<",
+	compiler.OpGreater:      ">",
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreaterEqual: ">=",
+}
+
+func (vm *VM) binary(op compiler.Opcode, left, right object.Object) (object.Object, *object.Error) {
+	result := interpreter.BinaryOp(binaryOperators[op], left, right)
+
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+	if err := vm.allocResult(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// buildHash pops the n key-value pairs of a hash literal and pushes the
+// hash.
+func (vm *VM) buildHash(n int) *object.Error {
+	if err := vm.alloc(n + 1); err != nil {
+		return err
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair, n)
+	for i := vm.sp - 2*n; i < vm.sp; i += 2 {
+		key, value := vm.stack[i], vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	vm.sp -= 2 * n
+	vm.push(&object.Hash{Pairs: pairs})
+	return nil
+}
+
+// member looks up a hash key, a struct, enum or instance field, an enum
+// variant, a class method, a module export or a method of the object's
+// type. Keys and fields take precedence over methods.
+func (vm *VM) member(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Module:
+		return interpreter.Index(obj, &object.String{Value: name})
+	case *object.Hash:
+		if pair, ok := obj.Pairs[(&object.String{Value: name}).HashKey()]; ok {
+			return pair.Value
+		}
+	case *object.Struct:
+		if value, ok := obj.Get(name); ok {
+			return value
+		}
+	case *object.Enum:
+		if value, ok := obj.Get(name); ok {
+			return value
+		}
+	case *object.EnumType:
+		variant, ok := obj.Variant(name)
+		if !ok {
+			return newError("enum %s has no variant `%s`", obj.Name, name)
+		}
+		return interpreter.VariantObject(variant)
+	case *object.Instance:
+		if value, ok := obj.Fields[name]; ok {
+			return value
+		}
+
+		if method, owner, ok := obj.Class.FindMethod(name); ok {
+			return vm.boundMethod(obj, method, owner)
+		}
+	case *object.Super:
+		method, owner, ok := obj.Class.FindMethod(name)
+		if !ok {
+			return newError("superclass %s has no method `%s`", obj.Class.Name, name)
+		}
+		return vm.boundMethod(obj.Self, method, owner)
+	}
+
+	method, ok := vm.in.Method(obj.Type(), name)
+	if !ok {
+		switch obj := obj.(type) {
+		case *object.Struct:
+			return interpreter.FieldError("struct", obj.StructType.Name, name)
+		case *object.Enum:
+			return interpreter.FieldError("variant", obj.Variant.Name, name)
+		case *object.Instance:
+			return newError("%s has no member `%s`", obj.Class.Name, name)
+		}
+		return newError("%s has no member `%s`", obj.Type(), name)
+	}
+
+	if err := vm.alloc(1); err != nil {
+		return err
+	}
+
+	// The method receives its receiver as the first argument.
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		result := vm.call(method, append([]object.Object{obj}, args...), name)
+		return interpreter.UncountReceiver(result, method, len(args))
+	}}
+}
+
+func (vm *VM) boundMethod(instance *object.Instance, method object.Object, owner *object.Class) object.Object {
+	bound, err := vm.bindInstanceMethod(instance, method, owner)
+	if err != nil {
+		return err
+	}
+	return bound
+}
+
+// bindInstanceMethod binds method, a method of the class owner, to
+// instance.
+func (vm *VM) bindInstanceMethod(instance *object.Instance, method object.Object, owner *object.Class) (*Closure, *object.Error) {
+	cl, ok := method.(*Closure)
+	if !ok {
+		return nil, newError("cannot bind method of class %s, got %s", owner.Name, method.Type())
+	}
+	return vm.bindMethod(instance, cl, owner)
+}
+
+func (vm *VM) assignIndex(left, index, value object.Object) *object.Error {
+	switch left := left.(type) {
+	case *object.Array:
+		if left.Frozen {
+			return interpreter.FrozenError(left)
+		}
+
+		number, ok := index.(*object.Number)
+		if !ok {
+			return newError("array index must be NUMBER, got %s", index.Type())
+		}
+
+		i := int(number.Value)
+		if float64(i) != number.Value || i < 0 || i >= len(left.Elements) {
+			return newError("index %s out of range for array of length %d", number.Inspect(), len(left.Elements))
+		}
+
+		left.Elements[i] = value
+		return nil
+	case *object.Hash:
+		return vm.setHashPair(left, index, value)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) assignMember(obj object.Object, name string, value object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Instance:
+		if obj.Frozen {
+			return interpreter.FrozenError(obj)
+		}
+
+		if _, ok := obj.Fields[name]; !ok {
+			if err := vm.alloc(1); err != nil {
+				return err
+			}
+		}
+
+		obj.Set(name, value)
+		return nil
+	case *object.Hash:
+		return vm.setHashPair(obj, &object.String{Value: name}, value)
+	case *object.Struct:
+		return newError("cannot assign to field `%s` of struct %s, use with to update it", name, obj.StructType.Name)
+	default:
+		return newError("cannot assign to member `%s` of %s", name, obj.Type())
+	}
+}
+
+func (vm *VM) setHashPair(hash *object.Hash, key, value object.Object) *object.Error {
+	if hash.Frozen {
+		return interpreter.FrozenError(hash)
+	}
+
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", key.Type())
+	}
+
+	hashKey := hashable.HashKey()
+	if _, ok := hash.Pairs[hashKey]; !ok {
+		if err := vm.alloc(1); err != nil {
+			return err
+		}
+	}
+
+	hash.Pairs[hashKey] = object.HashPair{Key: key, Value: value}
+	return nil
+}
+
+// checkWith checks that the left side of a with expression is a struct
+// with the fields being replaced.
+func checkWith(left object.Object, fields []object.Object) *object.Error {
+	s, ok := left.(*object.Struct)
+	if !ok {
+		return newError("with expects STRUCT, got %s", left.Type())
+	}
+
+	for _, field := range fields {
+		name := field.(*object.String).Value
+		if s.StructType.FieldIndex(name) < 0 {
+			return interpreter.FieldError("struct", s.StructType.Name, name)
+		}
+	}
+	return nil
+}
+
+// with pops the values of fields and the struct below them, and pushes a
+// copy of the struct with the fields replaced.
+func (vm *VM) with(fields []object.Object) *object.Error {
+	n := len(fields)
+	s := vm.stack[vm.sp-n-1].(*object.Struct)
+
+	values := make([]object.Object, len(s.Values))
+	copy(values, s.Values)
+	for i, field := range fields {
+		values[s.StructType.FieldIndex(field.(*object.String).Value)] = vm.stack[vm.sp-n+i]
+	}
+
+	if err := vm.alloc(len(values) + 1); err != nil {
+		return err
+	}
+
+	vm.sp -= n + 1
+	vm.push(&object.Struct{StructType: s.StructType, Values: values})
+	return nil
+}
+
+// defineStruct pushes the struct type described by its name and fields.
+func (vm *VM) defineStruct(desc []object.Object) *object.Error {
+	st := &object.StructType{Name: desc[0].(*object.String).Value}
+	for _, field := range desc[1:] {
+		st.Fields = append(st.Fields, field.(*object.String).Value)
+	}
+
+	if err := vm.alloc(1); err != nil {
+		return err
+	}
+
+	vm.push(st)
+	return nil
+}
+
+// defineEnum pushes the enum type described by its name and the name and
+// fields of each variant.
+func (vm *VM) defineEnum(desc []object.Object) *object.Error {
+	et := &object.EnumType{Name: desc[0].(*object.String).Value}
+
+	for _, v := range desc[1:] {
+		names := v.(*object.Array).Elements
+
+		variant := &object.Variant{EnumType: et, Name: names[0].(*object.String).Value}
+		for _, field := range names[1:] {
+			variant.Fields = append(variant.Fields, field.(*object.String).Value)
+		}
+		et.Variants = append(et.Variants, variant)
+	}
+
+	if err := vm.alloc(len(et.Variants) + 1); err != nil {
+		return err
+	}
+
+	vm.push(et)
+	return nil
+}
+
+// defineClass pops the closures of the methods named by desc, and the
+// superclass if super is set, and pushes the class.
+func (vm *VM) defineClass(desc []object.Object, super bool) *object.Error {
+	class := &object.Class{Name: desc[0].(*object.String).Value, Methods: make(map[string]object.Object)}
+
+	names := desc[1:]
+	methods := vm.stack[vm.sp-len(names) : vm.sp]
+	for i, name := range names {
+		class.Methods[name.(*object.String).Value] = methods[i]
+	}
+	vm.sp -= len(names)
+
+	if super {
+		superclass := vm.pop()
+
+		sc, ok := superclass.(*object.Class)
+		if !ok {
+			return newError("class %s cannot extend %s, expected CLASS", class.Name, superclass.Type())
+		}
+		class.Superclass = sc
+	}
+
+	// The closures of the methods are accounted for as they are created.
+	if err := vm.alloc(1); err != nil {
+		return err
+	}
+
+	vm.push(class)
+	return nil
+}
@@ -0,0 +1,193 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+// missing stands for an array element or hash key a pattern expects but the
+// value lacks, until the pattern's default replaces it.
+var missing object.Object = &object.Nil{}
+
+// matchPattern runs a pattern test. A value that does not match jumps to
+// the test's fail target, dropping the values pushed since the match arm
+// began, or raises a match error when the test has no target.
+func (vm *VM) matchPattern(f *frame, op compiler.Opcode, ins compiler.Instructions) *object.Error {
+	pattern := read16(ins, f.ip)
+	fail := read16(ins, f.ip+2)
+
+	// Tests refer to the source of their pattern, except for variant
+	// patterns, which also name their variant.
+	var source string
+	if op != compiler.OpMatchVariant {
+		source = f.constantString(pattern)
+	}
+
+	var err *object.Error
+
+	switch op {
+	case compiler.OpMatchEqual:
+		literal := vm.pop()
+		value := vm.pop()
+		f.ip += 4
+
+		if !interpreter.IsEqual(value, literal) {
+			err = newMatchError("%s does not match pattern %s", value.Inspect(), source)
+		}
+	case compiler.OpMatchRange:
+		inclusive := ins[f.ip+4] == 1
+		high := vm.pop()
+		low := vm.pop()
+		value := vm.pop()
+		f.ip += 5
+
+		err = matchRange(source, value, low, high, inclusive)
+	case compiler.OpMatchArray:
+		required := read16(ins, f.ip+4)
+		total := read16(ins, f.ip+6)
+		rest := ins[f.ip+8] == 1
+		f.ip += 9
+
+		err = matchArray(source, vm.stack[vm.sp-1], required, total, rest)
+	case compiler.OpMatchHash:
+		f.ip += 4
+
+		if value := vm.stack[vm.sp-1]; value.Type() != object.HASH_OBJ {
+			err = newMatchError("cannot destructure %s with hash pattern %s", value.Type(), source)
+		}
+	case compiler.OpField:
+		key := f.constantString(read16(ins, f.ip+2))
+		fail = read16(ins, f.ip+4)
+		hasDefault := ins[f.ip+6] == 1
+		f.ip += 7
+
+		hash := vm.pop().(*object.Hash)
+		if pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]; ok {
+			vm.push(pair.Value)
+		} else if hasDefault {
+			vm.push(missing)
+		} else {
+			err = newMatchError("hash pattern %s missing key %q", source, key)
+		}
+	case compiler.OpMatchVariant:
+		desc := f.constantArray(pattern)
+		args := read16(ins, f.ip+4)
+		f.ip += 6
+
+		source = desc[0].(*object.String).Value
+		err = matchVariant(source, desc[1].(*object.String).Value, vm.pop(), vm.stack[vm.sp-1], args)
+	}
+
+	if err == nil || err.Cause != interpreter.ErrNoMatch || fail == compiler.NoMatch {
+		return err
+	}
+
+	mark := f.marks[len(f.marks)-1]
+	f.marks = f.marks[:len(f.marks)-1]
+	vm.sp = mark
+	f.ip = fail
+	return nil
+}
+
+func matchRange(source string, value, low, high object.Object, inclusive bool) *object.Error {
+	number, ok := value.(*object.Number)
+	if !ok {
+		return newMatchError("%s does not match range pattern %s", value.Type(), source)
+	}
+
+	lowNum, lowOk := low.(*object.Number)
+	highNum, highOk := high.(*object.Number)
+	if !lowOk || !highOk {
+		return newError("range pattern %s expects NUMBER bounds", source)
+	}
+
+	v := number.Value
+	if v < lowNum.Value || v > highNum.Value || (v == highNum.Value && !inclusive) {
+		return newMatchError("%s does not match range pattern %s", value.Inspect(), source)
+	}
+	return nil
+}
+
+func matchArray(source string, value object.Object, required, total int, rest bool) *object.Error {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return newMatchError("cannot destructure %s with array pattern %s", value.Type(), source)
+	}
+
+	got := len(array.Elements)
+	if got >= required && (rest || got <= total) {
+		return nil
+	}
+
+	var want string
+	switch {
+	case rest:
+		want = "at least " + pluralize(required, "element")
+	case required == total:
+		want = pluralize(required, "element")
+	default:
+		want = fmt.Sprintf("%d to %d elements", required, total)
+	}
+
+	return newMatchError("array pattern %s expects %s, got %d", source, want, got)
+}
+
+// matchVariant matches value against the variant named name, looked up as
+// obj. A pattern with args arguments must have one for each field of the
+// variant.
+func matchVariant(source, name string, obj, value object.Object, args int) *object.Error {
+	var variant *object.Variant
+	switch obj := obj.(type) {
+	case *object.Variant:
+		variant = obj
+	case *object.Enum:
+		variant = obj.Variant
+	default:
+		return newError("%s is not an enum variant, got %s", name, obj.Type())
+	}
+
+	if args != compiler.NoMatch && args != len(variant.Fields) {
+		return newError("variant pattern %s expects %s, got %d", source, pluralize(len(variant.Fields), "field"), args)
+	}
+
+	enum, ok := value.(*object.Enum)
+	if !ok || enum.Variant != variant {
+		return newMatchError("%s does not match pattern %s", value.Inspect(), source)
+	}
+	return nil
+}
+
+// hashRest pops a hash and pushes a hash of its pairs whose keys are not
+// among keys.
+func (vm *VM) hashRest(keys []object.Object) *object.Error {
+	hash := vm.pop().(*object.Hash)
+
+	used := make(map[object.HashKey]bool, len(keys))
+	for _, key := range keys {
+		used[key.(*object.String).HashKey()] = true
+	}
+
+	rest := make(map[object.HashKey]object.HashPair)
+	for key, pair := range hash.Pairs {
+		if !used[key] {
+			rest[key] = pair
+		}
+	}
+
+	if err := vm.alloc(len(rest) + 1); err != nil {
+		return err
+	}
+
+	vm.push(&object.Hash{Pairs: rest})
+	return nil
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
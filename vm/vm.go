@@ -0,0 +1,676 @@
+// Package vm runs programs compiled by package compiler on a stack-based
+// virtual machine.
+//
+// The VM keeps the values being computed on an operand stack. Each call
+// pushes a frame whose local variables are slots of the stack above the
+// caller's values, and closures reach the variables of enclosing calls
+// through upvalues. Globals, builtins and methods come from an
+// interpreter.Interpreter, so that programs behave the same on the VM as
+// on the interpreter and can share a global environment with it.
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/object"
+)
+
+const initialStackSize = 1024
+
+// VM runs compiled programs. Like an interpreter, it is not safe for
+// concurrent use.
+type VM struct {
+	in     *interpreter.Interpreter
+	limits interpreter.Limits
+
+	stack  []object.Object
+	sp     int
+	frames []frame
+	open   []*Upvalue
+	// depth is the number of function calls on the frame stack.
+	depth int
+
+	modules map[string]*module
+	module  *module
+	cache   *compiler.Cache
+
+	active int
+	run    run
+}
+
+// New returns a VM using the builtins, methods, I/O streams, limits and
+// module path of in.
+func New(in *interpreter.Interpreter) *VM {
+	return &VM{
+		in:      in,
+		limits:  in.Limits(),
+		stack:   make([]object.Object, initialStackSize),
+		modules: make(map[string]*module),
+	}
+}
+
+type frameKind byte
+
+const (
+	mainFrame frameKind = iota
+	functionFrame
+	blockFrame
+)
+
+// frame is a running closure. Its local variables are the stack slots from
+// bp, and the stack is cut back to sp when it returns.
+type frame struct {
+	cl   *Closure
+	ip   int
+	bp   int
+	sp   int
+	kind frameKind
+	// marks are the stack heights at the start of the match arms being
+	// tried.
+	marks []int
+
+	// caller and site locate the call that created a function frame, and
+	// name names frames created by calls from Go.
+	caller *compiler.Function
+	site   int
+	name   string
+}
+
+// Run runs bc in env and returns the value of its last statement. The run
+// stops with an *object.Error when ctx is done or when one of the limits of
+// the VM's interpreter is exceeded.
+func (vm *VM) Run(ctx context.Context, bc *compiler.Bytecode, env *object.Environment) object.Object {
+	defer vm.begin(ctx)()
+	return vm.runMain(bc, env)
+}
+
+// Apply calls fn, a Saphire function or builtin, with args under the same
+// rules as Run.
+func (vm *VM) Apply(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	defer vm.begin(ctx)()
+	return vm.call(fn, args, "<host>")
+}
+
+func (vm *VM) runMain(bc *compiler.Bytecode, env *object.Environment) object.Object {
+	cl := &Closure{Fn: bc.Main, globals: env, vm: vm}
+
+	stop := len(vm.frames)
+	vm.frames = append(vm.frames, frame{cl: cl, bp: vm.sp, sp: vm.sp, kind: mainFrame})
+	vm.reserve(len(bc.Main.Locals))
+
+	return vm.execute(stop)
+}
+
+// call calls fn with args from Go. Frames of closures called this way are
+// named name in traces, unless their function has a name.
+func (vm *VM) call(fn object.Object, args []object.Object, name string) object.Object {
+	cl, ok := fn.(*Closure)
+	if !ok {
+		result, err := vm.applyNative(fn, args, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		return result
+	}
+
+	stop := len(vm.frames)
+	if err := vm.enter(cl, args, nil, nil, 0, name); err != nil {
+		return vm.unwind(err, stop)
+	}
+	return vm.execute(stop)
+}
+
+// execute runs the frame on top of the frame stack, and the frames it
+// calls, until it returns. Errors unwind the frames it runs and are
+// returned.
+func (vm *VM) execute(stop int) object.Object {
+	f := &vm.frames[len(vm.frames)-1]
+	ins := f.cl.Fn.Instructions
+	maxSteps := vm.limits.MaxSteps
+
+	for {
+		vm.run.steps++
+		if maxSteps > 0 && vm.run.steps > maxSteps {
+			return vm.unwind(newLimitError("steps", maxSteps), stop)
+		}
+		if vm.run.steps%contextCheckInterval == 1 {
+			if err := vm.checkContext(); err != nil {
+				return vm.unwind(err, stop)
+			}
+		}
+
+		op := compiler.Opcode(ins[f.ip])
+		f.ip++
+
+		var err *object.Error
+
+		switch op {
+		case compiler.OpConstant:
+			vm.push(f.cl.Fn.Constants[read16(ins, f.ip)])
+			f.ip += 2
+		case compiler.OpTrue:
+			vm.push(interpreter.TRUE)
+		case compiler.OpFalse:
+			vm.push(interpreter.FALSE)
+		case compiler.OpNil:
+			vm.push(interpreter.NIL)
+		case compiler.OpPop:
+			vm.sp--
+		case compiler.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod, compiler.OpPow,
+			compiler.OpEqual, compiler.OpNotEqual, compiler.OpLess, compiler.OpGreater,
+			compiler.OpLessEqual, compiler.OpGreaterEqual:
+			right := vm.stack[vm.sp-1]
+			left := vm.stack[vm.sp-2]
+			vm.sp -= 2
+
+			var result object.Object
+			if result, err = vm.binary(op, left, right); err == nil {
+				vm.push(result)
+			}
+		case compiler.OpMinus, compiler.OpBang:
+			operator := "-"
+			if op == compiler.OpBang {
+				operator = "!"
+			}
+
+			result := interpreter.UnaryOp(operator, vm.pop())
+			if errObj, ok := result.(*object.Error); ok {
+				err = errObj
+				break
+			}
+			vm.push(result)
+
+		case compiler.OpJump:
+			f.ip = read16(ins, f.ip)
+		case compiler.OpJumpIfFalse:
+			if interpreter.IsTruthy(vm.pop()) {
+				f.ip += 2
+			} else {
+				f.ip = read16(ins, f.ip)
+			}
+
+		case compiler.OpGetGlobal:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			var value object.Object
+			if value, err = vm.global(f, name); err == nil {
+				vm.push(value)
+			}
+		case compiler.OpDefineGlobal:
+			f.cl.globals.Set(f.constantString(read16(ins, f.ip)), vm.pop())
+			f.ip += 2
+		case compiler.OpConstGlobal:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			value, _ := f.cl.globals.Get(name)
+			f.cl.globals.SetConst(name, value)
+		case compiler.OpAssignGlobal:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			if f.cl.globals.IsConst(name) {
+				err = newError("cannot assign to constant `%s`", name)
+			} else if !f.cl.globals.Assign(name, vm.stack[vm.sp-1]) {
+				err = newError("cannot assign to undefined variable `%s`", name)
+			}
+		case compiler.OpCheckGlobal:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			if f.cl.globals.Has(name) && f.cl.globals.IsConst(name) {
+				err = newError("cannot redeclare constant `%s`", name)
+			}
+
+		case compiler.OpGetLocal:
+			slot := read16(ins, f.ip)
+			f.ip += 2
+
+			value := vm.stack[f.bp+slot]
+			if value == nil {
+				// The declaration has not run yet, as for a function
+				// referring to one declared after it, so the name is
+				// looked up as a global instead.
+				value, err = vm.global(f, f.cl.Fn.Locals[slot])
+			}
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpSetLocal:
+			vm.stack[f.bp+read16(ins, f.ip)] = vm.pop()
+			f.ip += 2
+		case compiler.OpGetFree:
+			i := read16(ins, f.ip)
+			f.ip += 2
+
+			var value object.Object
+			if uv := f.cl.Free[i]; uv != nil {
+				value = uv.get(vm)
+			}
+			if value == nil {
+				value, err = vm.global(f, f.cl.Fn.Free[i].Name)
+			}
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpSetFree:
+			i := read16(ins, f.ip)
+			f.ip += 2
+
+			if uv := f.cl.Free[i]; uv != nil {
+				uv.set(vm, vm.pop())
+			} else {
+				f.cl.Free[i] = closedUpvalue(vm.pop())
+			}
+
+		case compiler.OpClosure:
+			fn := f.cl.Fn.Constants[read16(ins, f.ip)].(*compiler.Function)
+			f.ip += 2
+
+			if !fn.Block {
+				if err = vm.alloc(1); err != nil {
+					break
+				}
+			}
+			vm.push(vm.newClosure(fn, f))
+
+		case compiler.OpCall:
+			argc := int(ins[f.ip])
+			site := f.ip - 1
+			f.ip++
+
+			callee := vm.stack[vm.sp-1-argc]
+			if cl, ok := callee.(*Closure); ok && !(f.kind == functionFrame && tailPosition(ins, f.ip)) {
+				err = vm.callClosure(cl, argc, f.cl.Fn, site)
+			} else {
+				args := make([]object.Object, argc)
+				copy(args, vm.stack[vm.sp-argc:vm.sp])
+				vm.sp -= argc + 1
+				err = vm.callValue(f, callee, args, nil, site, tailPosition(ins, f.ip))
+			}
+
+			if err == nil {
+				f = &vm.frames[len(vm.frames)-1]
+				ins = f.cl.Fn.Instructions
+			}
+		case compiler.OpCallArgs:
+			nnamed := int(ins[f.ip])
+			names := f.cl.Fn.Constants[read16(ins, f.ip+1)].(*object.Array)
+			site := f.ip - 1
+			f.ip += 3
+
+			named := make([]namedArg, nnamed)
+			for i := range named {
+				named[i] = namedArg{name: names.Elements[i].(*object.String).Value, value: vm.stack[vm.sp-nnamed+i]}
+			}
+			vm.sp -= nnamed
+
+			args := vm.pop().(*object.Array).Elements
+			callee := vm.pop()
+			err = vm.callValue(f, callee, args, named, site, tailPosition(ins, f.ip))
+
+			if err == nil {
+				f = &vm.frames[len(vm.frames)-1]
+				ins = f.cl.Fn.Instructions
+			}
+
+		case compiler.OpReturnValue:
+			value := vm.pop()
+			vm.leave()
+			if len(vm.frames) == stop {
+				return value
+			}
+
+			vm.push(value)
+			f = &vm.frames[len(vm.frames)-1]
+			ins = f.cl.Fn.Instructions
+		case compiler.OpReturn:
+			vm.leave()
+			if len(vm.frames) == stop {
+				return nil
+			}
+
+			vm.push(interpreter.NIL)
+			f = &vm.frames[len(vm.frames)-1]
+			ins = f.cl.Fn.Instructions
+
+		case compiler.OpArray:
+			n := read16(ins, f.ip)
+			f.ip += 2
+
+			if err = vm.alloc(n + 1); err != nil {
+				break
+			}
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elements})
+		case compiler.OpAppend:
+			if err = vm.alloc(1); err != nil {
+				break
+			}
+			value := vm.pop()
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, value)
+		case compiler.OpSpread:
+			value := vm.pop()
+			spread, ok := value.(*object.Array)
+			if !ok {
+				err = newError("cannot spread %s, expected ARRAY", value.Type())
+				break
+			}
+			if err = vm.alloc(len(spread.Elements)); err != nil {
+				break
+			}
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, spread.Elements...)
+		case compiler.OpHash:
+			n := read16(ins, f.ip)
+			f.ip += 2
+			err = vm.buildHash(n)
+		case compiler.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			result := interpreter.Index(left, index)
+			if errObj, ok := result.(*object.Error); ok {
+				err = errObj
+				break
+			}
+			vm.push(result)
+		case compiler.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			if err = vm.assignIndex(left, index, value); err == nil {
+				vm.push(value)
+			}
+		case compiler.OpMember:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			result := vm.member(vm.pop(), name)
+			if errObj, ok := result.(*object.Error); ok {
+				err = errObj
+				break
+			}
+			vm.push(result)
+		case compiler.OpSetMember:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			value := vm.pop()
+			obj := vm.pop()
+			if err = vm.assignMember(obj, name, value); err == nil {
+				vm.push(value)
+			}
+		case compiler.OpCheckWith:
+			fields := f.constantArray(read16(ins, f.ip))
+			f.ip += 2
+			err = checkWith(vm.stack[vm.sp-1], fields)
+		case compiler.OpWith:
+			fields := f.constantArray(read16(ins, f.ip))
+			f.ip += 2
+			err = vm.with(fields)
+
+		case compiler.OpStruct:
+			err = vm.defineStruct(f.constantArray(read16(ins, f.ip)))
+			f.ip += 2
+		case compiler.OpEnum:
+			err = vm.defineEnum(f.constantArray(read16(ins, f.ip)))
+			f.ip += 2
+		case compiler.OpVariant:
+			et := vm.pop().(*object.EnumType)
+			vm.push(interpreter.VariantObject(et.Variants[read16(ins, f.ip)]))
+			f.ip += 2
+		case compiler.OpClass:
+			desc := f.constantArray(read16(ins, f.ip))
+			super := ins[f.ip+2] == 1
+			f.ip += 3
+			err = vm.defineClass(desc, super)
+
+		case compiler.OpThrow:
+			err = interpreter.ThrownError(vm.pop())
+		case compiler.OpTry:
+			flags := int(ins[f.ip])
+			f.ip++
+
+			result := vm.try(flags)
+			f = &vm.frames[len(vm.frames)-1]
+			ins = f.cl.Fn.Instructions
+
+			switch result := result.(type) {
+			case *object.Error:
+				err = result
+			case *object.ReturnValue:
+				// A return in the blocks returns from the enclosing
+				// function, through the blocks enclosing the try.
+				var value object.Object = result
+				if f.kind != blockFrame {
+					value = result.Value
+				}
+
+				vm.leave()
+				if len(vm.frames) == stop {
+					return value
+				}
+
+				vm.push(value)
+				f = &vm.frames[len(vm.frames)-1]
+				ins = f.cl.Fn.Instructions
+			default:
+				vm.push(result)
+			}
+		case compiler.OpWrapReturn:
+			vm.push(&object.ReturnValue{Value: vm.pop()})
+		case compiler.OpFail:
+			err = newError("%s", f.constantString(read16(ins, f.ip)))
+
+		case compiler.OpShadow:
+			name := f.constantString(read16(ins, f.ip))
+			line, column := read16(ins, f.ip+2), read16(ins, f.ip+4)
+			global := ins[f.ip+6] == 1
+			f.ip += 7
+
+			if !global || f.cl.globals.Has(name) {
+				path := ""
+				if vm.module != nil {
+					path = vm.module.path
+				}
+				vm.in.ShadowWarning(path, line, column, name)
+			}
+
+		case compiler.OpMark:
+			f.marks = append(f.marks, vm.sp)
+		case compiler.OpUnmark:
+			f.marks = f.marks[:len(f.marks)-1]
+		case compiler.OpMatchEqual, compiler.OpMatchRange, compiler.OpMatchArray,
+			compiler.OpMatchHash, compiler.OpMatchVariant, compiler.OpField:
+			err = vm.matchPattern(f, op, ins)
+		case compiler.OpElement:
+			i := read16(ins, f.ip)
+			f.ip += 2
+
+			switch value := vm.stack[vm.sp-1].(type) {
+			case *object.Array:
+				if i < len(value.Elements) {
+					vm.stack[vm.sp-1] = value.Elements[i]
+				} else {
+					vm.stack[vm.sp-1] = missing
+				}
+			case *object.Enum:
+				vm.stack[vm.sp-1] = value.Values[i]
+			}
+		case compiler.OpArrayRest:
+			start := read16(ins, f.ip)
+			f.ip += 2
+
+			array := vm.pop().(*object.Array)
+			rest := make([]object.Object, 0)
+			if len(array.Elements) > start {
+				rest = append(rest, array.Elements[start:]...)
+			}
+			if err = vm.alloc(len(rest) + 1); err == nil {
+				vm.push(&object.Array{Elements: rest})
+			}
+		case compiler.OpHashRest:
+			keys := f.constantArray(read16(ins, f.ip))
+			f.ip += 2
+			err = vm.hashRest(keys)
+		case compiler.OpDefault:
+			if vm.stack[vm.sp-1] == missing {
+				vm.sp--
+				f.ip += 2
+			} else {
+				f.ip = read16(ins, f.ip)
+			}
+		case compiler.OpParamDefault:
+			if vm.stack[f.bp+read16(ins, f.ip)] != nil {
+				f.ip = read16(ins, f.ip+2)
+			} else {
+				f.ip += 4
+			}
+		case compiler.OpNoMatch:
+			err = newMatchError("no match arm matches %s", vm.pop().Inspect())
+
+		case compiler.OpImport:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			var mod *object.Module
+			if mod, err = vm.importModule(name); err == nil {
+				vm.push(mod)
+
+				// Running the module may have moved the frame stack.
+				f = &vm.frames[len(vm.frames)-1]
+				ins = f.cl.Fn.Instructions
+			}
+		case compiler.OpImportName:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			mod := vm.pop().(*object.Module)
+			value, ok := mod.Exports[name]
+			if !ok {
+				err = newError("module %s does not export `%s`", mod.Name, name)
+				break
+			}
+			vm.push(value)
+		case compiler.OpExport:
+			name := f.constantString(read16(ins, f.ip))
+			f.ip += 2
+
+			if vm.module != nil && vm.module.env == f.cl.globals {
+				value, _ := f.cl.globals.Get(name)
+				vm.module.object.Exports[name] = value
+			}
+
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			return vm.unwind(err, stop)
+		}
+	}
+}
+
+// leave pops the frame on top of the frame stack.
+func (vm *VM) leave() {
+	f := &vm.frames[len(vm.frames)-1]
+	vm.closeUpvalues(f.bp)
+	vm.sp = f.sp
+	if f.kind == functionFrame {
+		vm.depth--
+	}
+	vm.frames = vm.frames[:len(vm.frames)-1]
+}
+
+// unwind pops the frames of the run started at stop and returns err, with
+// a trace of the calls it was raised in.
+func (vm *VM) unwind(err *object.Error, stop int) *object.Error {
+	if err.Trace == nil && vm.depth > 0 {
+		err.Trace = vm.trace()
+	}
+
+	for len(vm.frames) > stop {
+		vm.leave()
+	}
+	return err
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp == len(vm.stack) {
+		vm.grow(vm.sp + 1)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// reserve makes room for n local variables above the stack and clears
+// them.
+func (vm *VM) reserve(n int) {
+	if vm.sp+n > len(vm.stack) {
+		vm.grow(vm.sp + n)
+	}
+	clear(vm.stack[vm.sp : vm.sp+n])
+	vm.sp += n
+}
+
+func (vm *VM) grow(size int) {
+	stack := make([]object.Object, max(2*len(vm.stack), size))
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+}
+
+// global returns the global, builtin or namespace name.
+func (vm *VM) global(f *frame, name string) (object.Object, *object.Error) {
+	if value, ok := f.cl.globals.Get(name); ok {
+		return value, nil
+	}
+
+	if builtin, ok := vm.in.Builtin(name); ok {
+		return builtin, nil
+	}
+
+	if namespace, ok := vm.in.Namespace(name); ok {
+		return namespace, nil
+	}
+
+	return nil, newError("identifier not found: %s", name)
+}
+
+func (f *frame) constantString(i int) string {
+	return f.cl.Fn.Constants[i].(*object.String).Value
+}
+
+func (f *frame) constantArray(i int) []object.Object {
+	return f.cl.Fn.Constants[i].(*object.Array).Elements
+}
+
+func read16(ins compiler.Instructions, ip int) int {
+	return int(ins[ip])<<8 | int(ins[ip+1])
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func newMatchError(format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Cause = interpreter.ErrNoMatch
+	return err
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/darwin1224/saphire/ast"
+	"github.com/darwin1224/saphire/compiler"
+	"github.com/darwin1224/saphire/internal/enginetest"
+	"github.com/darwin1224/saphire/interpreter"
+	"github.com/darwin1224/saphire/lexer"
+	"github.com/darwin1224/saphire/object"
+	"github.com/darwin1224/saphire/parser"
+)
+
+// engine compiles programs and runs them on a VM, standing in for the
+// interpreter in the tests shared with package interpreter.
+type engine struct {
+	*interpreter.Interpreter
+	vm *VM
+}
+
+func newEngine(opts ...interpreter.Option) *engine {
+	in := interpreter.New(opts...)
+	return &engine{Interpreter: in, vm: New(in)}
+}
+
+func (e *engine) compile(program *ast.Program, env *object.Environment) (*compiler.Bytecode, *object.Error) {
+	e.Optimize(program)
+	if err := e.Verify(program, env); err != nil {
+		return nil, err
+	}
+
+	bc, err := compiler.Compile(program)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+	return bc, nil
+}
+
+func (e *engine) Eval(ctx context.Context, program *ast.Program, env *object.Environment) object.Object {
+	bc, err := e.compile(program, env)
+	if err != nil {
+		return err
+	}
+	return e.vm.Run(ctx, bc, env)
+}
+
+func (e *engine) EvalFile(ctx context.Context, path string, program *ast.Program, env *object.Environment) object.Object {
+	bc, err := e.compile(program, env)
+	if err != nil {
+		return err
+	}
+	return e.vm.RunFile(ctx, path, bc, env)
+}
+
+func TestEngine(t *testing.T) {
+	enginetest.Run(t, func(opts ...interpreter.Option) enginetest.Engine {
+		return newEngine(opts...)
+	})
+}
+
+func testEval(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return newEngine().Eval(context.Background(), program, object.NewEnvironment())
+}
+
+func testNumberObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Number)
+	if !ok {
+		t.Errorf("object is not Number. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	result := testEval(input)
+	cl, ok := result.(*Closure)
+	if !ok {
+		t.Fatalf("object is not Closure. got=%T (%+v)", result, result)
+	}
+
+	if len(cl.Fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", cl.Fn.Parameters)
+	}
+
+	if cl.Fn.Parameters[0].Source != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", cl.Fn.Parameters[0].Source)
+	}
+
+	expectedBody := "(x + 2)"
+
+	if cl.Fn.Body != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, cl.Fn.Body)
+	}
+}
+
+func TestApply(t *testing.T) {
+	in := newEngine()
+	env := object.NewEnvironment()
+
+	program := parser.New(lexer.New("let add = fn(a, b = 10) { a + b };")).ParseProgram()
+	in.Eval(context.Background(), program, env)
+
+	add, _ := env.Get("add")
+	testNumberObject(t, in.vm.Apply(context.Background(), add, []object.Object{&object.Number{Value: 1}}), 11)
+
+	errObj, ok := in.vm.Apply(context.Background(), add, nil).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if errObj.Message != "function `add` expects 1 to 2 arguments, got 0" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if len(errObj.Trace) != 1 || errObj.Trace[0] != "at add" {
+		t.Errorf("wrong trace. got=%q", errObj.Trace)
+	}
+
+	testNumberObject(t, add.(object.Callable).Call([]object.Object{&object.Number{Value: 2}}), 12)
+}